@@ -1,7 +1,7 @@
 #!/bin/bash
 
 cd csrc
-gcc -I./ -o main patient.c patient_metrics.c
+gcc -I./ -o main patient.c patient_metrics.c patient_wal.c patient_file.c
 mv main ../
 cd ../
 ./main
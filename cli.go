@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"ffi-test/src/models"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the headless commands, one per family of csrc/errors.h codes.
+// The exact code is in the JSON error printed on stderr.
+const (
+	exitOK         = 0
+	exitFailure    = 1 // any other error
+	exitUsage      = 2 // bad arguments
+	exitValidation = 3 // ERR_FIELD_*
+	exitNotFound   = 4 // ERR_NOT_FOUND
+	exitDuplicate  = 5 // ERR_DUPLICATE
+	exitIO         = 6 // ERR_IO
+	exitCorrupt    = 7 // ERR_PARSE_LINE, ERR_FORMAT, ERR_VERSION, ERR_CHECKSUM
+	exitBooking    = 8 // ERR_APPOINTMENT_CONFLICT, ERR_SLOT_FULL
+)
+
+// command is a headless subcommand. run returns what to print as JSON on
+// success. Changes are kept in the store's log and only checkpointed into
+// the data files by `save`, or whenever a later open replays them.
+type command struct {
+	usage string
+	run   func(service models.PatientStore, args []string) (any, error)
+}
+
+var commands = map[string]command{
+	"get":      {usage: "get CI", run: cmdGet},
+	"add":      {usage: "add --ci CI --name NAME --age AGE --diagnosis TEXT --gender M|F [--disability] --specialty TEXT --date YYYY-MM-DD", run: cmdAdd},
+	"update":   {usage: "update CI [--name NAME] [--age AGE] [--diagnosis TEXT] [--gender M|F] [--disability=true|false] [--specialty TEXT] [--date YYYY-MM-DD]", run: cmdUpdate},
+	"delete":   {usage: "delete CI", run: cmdDelete},
+	"schedule": {usage: "schedule CI YYYY-MM-DD HH:MM [--duration MINUTES] [--specialty TEXT]", run: cmdSchedule},
+	"list":     {usage: "list [--filter disabled|female|male|date=YYYY-MM-DD|specialty=NAME|under-age=N]", run: cmdList},
+	"stats":    {usage: "stats", run: cmdStats},
+	"save":     {usage: "save", run: cmdSave},
+}
+
+// usageError is a command called with bad arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+// cliError is the JSON printed for a failed command. Code and Name are the
+// csrc/errors.h code behind the error, when there is one.
+type cliError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Usage   string `json:"usage,omitempty"`
+}
+
+// RunCommand runs a headless command against the store, prints its result
+// as JSON to stdout or its error to stderr and returns the process exit code.
+func RunCommand(service models.PatientStore, openErr error, name string, args []string, stdout, stderr io.Writer) int {
+	cmd := commands[name]
+	if openErr != nil {
+		return printError(stderr, cmd, openErr)
+	}
+	result, err := cmd.run(service, args)
+	if err != nil {
+		return printError(stderr, cmd, err)
+	}
+	printJSON(stdout, result)
+	return exitOK
+}
+
+func printJSON(w io.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// printError prints err as {"error": {...}} and returns its exit code.
+func printError(w io.Writer, cmd command, err error) int {
+	out := cliError{Message: err.Error()}
+	var usage *usageError
+	if errors.As(err, &usage) {
+		out.Usage = cmd.usage
+		printJSON(w, map[string]cliError{"error": out})
+		return exitUsage
+	}
+	if code := models.ErrorCode(err); code != 0 {
+		out.Code = code
+		out.Name = models.CodeName(code)
+	}
+	var validation *models.ValidationError
+	if errors.As(err, &validation) {
+		out.Field = validation.Field
+	}
+	printJSON(w, map[string]cliError{"error": out})
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrValidation):
+		return exitValidation
+	case errors.Is(err, models.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, models.ErrDuplicate):
+		return exitDuplicate
+	case errors.Is(err, models.ErrIO):
+		return exitIO
+	case errors.Is(err, models.ErrCorrupt):
+		return exitCorrupt
+	case errors.Is(err, models.ErrBooking):
+		return exitBooking
+	}
+	return exitFailure
+}
+
+// positional checks that args holds exactly n arguments before any flags.
+func positional(args []string, n int) error {
+	if len(args) < n {
+		return &usageError{msg: fmt.Sprintf("expected %d arguments, got %d", n, len(args))}
+	}
+	for _, arg := range args[:n] {
+		if strings.HasPrefix(arg, "-") {
+			return &usageError{msg: fmt.Sprintf("expected %d arguments before the flags", n)}
+		}
+	}
+	return nil
+}
+
+// parseFlags parses flags, reporting problems as a usageError instead of
+// printing them.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if flags.NArg() > 0 {
+		return &usageError{msg: fmt.Sprintf("unexpected argument %q", flags.Arg(0))}
+	}
+	return nil
+}
+
+func cmdGet(service models.PatientStore, args []string) (any, error) {
+	if err := positional(args, 1); err != nil {
+		return nil, err
+	}
+	if err := parseFlags(flag.NewFlagSet("get", flag.ContinueOnError), args[1:]); err != nil {
+		return nil, err
+	}
+	response, err := service.GetPatient(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return response.Patient, nil
+}
+
+// patientFlags binds the flags of add and update to the fields of p.
+func patientFlags(name string, p *models.Patient) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&p.ID, "ci", p.ID, "CI, 8 digits")
+	flags.StringVar(&p.Name, "name", p.Name, "name")
+	flags.IntVar(&p.Age, "age", p.Age, "age")
+	flags.StringVar(&p.Diagnosis, "diagnosis", p.Diagnosis, "diagnosis")
+	flags.Func("gender", "M or F", func(value string) error {
+		if len(value) != 1 {
+			return fmt.Errorf("gender must be M or F")
+		}
+		p.Gender = value[0]
+		return nil
+	})
+	flags.BoolVar(&p.Disability, "disability", p.Disability, "has a disability")
+	flags.StringVar(&p.DocSpecialty, "specialty", p.DocSpecialty, "doctor's specialty")
+	flags.StringVar(&p.AppointmentDate, "date", p.AppointmentDate, "appointment date, YYYY-MM-DD")
+	return flags
+}
+
+func cmdAdd(service models.PatientStore, args []string) (any, error) {
+	var p models.Patient
+	if err := parseFlags(patientFlags("add", &p), args); err != nil {
+		return nil, err
+	}
+	if err := service.AddPatient(p); err != nil {
+		return nil, err
+	}
+	return storedPatient(service, p.ID)
+}
+
+// cmdUpdate changes the fields given as flags and keeps the others.
+func cmdUpdate(service models.PatientStore, args []string) (any, error) {
+	if err := positional(args, 1); err != nil {
+		return nil, err
+	}
+	response, err := service.GetPatient(args[0])
+	if err != nil {
+		return nil, err
+	}
+	p := response.Patient
+	flags := patientFlags("update", &p)
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return nil, err
+	}
+	if p.ID != args[0] {
+		return nil, &usageError{msg: "the CI of a patient can't be changed"}
+	}
+	if err := service.UpdatePatient(p); err != nil {
+		return nil, err
+	}
+	return storedPatient(service, p.ID)
+}
+
+func cmdDelete(service models.PatientStore, args []string) (any, error) {
+	if err := positional(args, 1); err != nil {
+		return nil, err
+	}
+	if err := parseFlags(flag.NewFlagSet("delete", flag.ContinueOnError), args[1:]); err != nil {
+		return nil, err
+	}
+	if err := service.DeletePatient(args[0]); err != nil {
+		return nil, err
+	}
+	return map[string]string{"deleted": args[0]}, nil
+}
+
+// cmdSchedule books the slot and prints the appointment.
+func cmdSchedule(service models.PatientStore, args []string) (any, error) {
+	if err := positional(args, 3); err != nil {
+		return nil, err
+	}
+	a := models.Appointment{CI: args[0], Date: args[1], Time: args[2]}
+	flags := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	flags.IntVar(&a.Duration, "duration", 0, "length in minutes, by default the specialty's")
+	flags.StringVar(&a.Specialty, "specialty", "", "specialty, by default the patient's")
+	if err := parseFlags(flags, args[3:]); err != nil {
+		return nil, err
+	}
+	return service.ScheduleAppointment(a)
+}
+
+// storedPatient is the patient as the store kept it, after truncation.
+func storedPatient(service models.PatientStore, ci string) (any, error) {
+	response, err := service.GetPatient(ci)
+	if err != nil {
+		return nil, err
+	}
+	return response.Patient, nil
+}
+
+func cmdList(service models.PatientStore, args []string) (any, error) {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	filter := flags.String("filter", "", "which patients to list")
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	patients, err := listFiltered(service, *filter)
+	if err != nil {
+		return nil, err
+	}
+	if patients == nil {
+		patients = []models.Patient{}
+	}
+	return patients, nil
+}
+
+// listFiltered runs the List method named by filter, which is empty for all
+// patients or one of the filters in the list usage.
+func listFiltered(service models.PatientStore, filter string) ([]models.Patient, error) {
+	name, value, hasValue := strings.Cut(filter, "=")
+	switch {
+	case filter == "":
+		return service.ListPatients()
+	case filter == "disabled":
+		return service.ListDisabledPatients()
+	case filter == "female":
+		return service.ListFemalePatients()
+	case filter == "male":
+		return service.ListMalePatients()
+	case name == "date" && hasValue:
+		if err := models.ValidateAppointmentDate(value); err != nil {
+			return nil, err
+		}
+		return service.ListPatientsByAppointmentDate(value)
+	case name == "specialty" && hasValue:
+		return service.ListPatientsBySpecialty(value)
+	case name == "under-age" && hasValue:
+		age, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &usageError{msg: fmt.Sprintf("invalid age %q", value)}
+		}
+		return service.ListPatientsUnderAge(age)
+	}
+	return nil, &usageError{msg: fmt.Sprintf("unknown filter %q", filter)}
+}
+
+func cmdStats(service models.PatientStore, args []string) (any, error) {
+	if err := parseFlags(flag.NewFlagSet("stats", flag.ContinueOnError), args); err != nil {
+		return nil, err
+	}
+	patients, err := service.ListPatients()
+	if err != nil {
+		return nil, err
+	}
+	return models.ComputeStats(patients), nil
+}
+
+// cmdSave checkpoints the logged changes into the data files.
+func cmdSave(service models.PatientStore, args []string) (any, error) {
+	if err := parseFlags(flag.NewFlagSet("save", flag.ContinueOnError), args); err != nil {
+		return nil, err
+	}
+	if err := service.Save(); err != nil {
+		return nil, err
+	}
+	return map[string]string{"saved": service.DataDir()}, nil
+}
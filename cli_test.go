@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"ffi-test/src/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var aliceArgs = []string{"--ci", "12345678", "--name", "Alice Johnson", "--age", "34", "--diagnosis", "Hypertension",
+	"--gender", "F", "--specialty", "Cardiology", "--date", "2024-02-15"}
+
+const aliceOut = `{"ci": "12345678", "name": "Alice Johnson", "age": 34, "diagnosis": "Hypertension", "gender": "F", "disability": false, "doc_specialty": "Cardiology", "appointment_date": "2024-02-15"}`
+
+// openCLIStore opens a Go store in dir, closed when the test ends, and
+// returns it with the error of its Open.
+func openCLIStore(t *testing.T, dir string) (models.PatientStore, error) {
+	t.Helper()
+	store, err := models.NewPatientStore("go", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store, store.Open()
+}
+
+// newCLIStore opens a Go store in a fresh directory holding Alice.
+func newCLIStore(t *testing.T) models.PatientStore {
+	t.Helper()
+	store, err := openCLIStore(t, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := run(store, nil, "add", aliceArgs...); code != exitOK {
+		t.Fatalf("add = %d %s", code, stderr)
+	}
+	return store
+}
+
+func run(store models.PatientStore, openErr error, name string, args ...string) (code int, stdout string, stderr string) {
+	var out, errOut bytes.Buffer
+	code = RunCommand(store, openErr, name, args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// checkJSON compares the JSON printed by a command with want.
+func checkJSON(t *testing.T, what string, got string, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("%s printed %q: %v", what, got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("bad want for %s: %v", what, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("%s printed %s, want %s", what, got, want)
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	store := newCLIStore(t)
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"get", []string{"12345678"}, aliceOut},
+		{"list", nil, "[" + aliceOut + "]"},
+		{"list", []string{"--filter", "male"}, "[]"},
+		{"list", []string{"--filter", "specialty=Cardiology"}, "[" + aliceOut + "]"},
+		{"stats", nil, `{"total": 1, "disabled": 0, "female": 1, "male": 0, "average_age": 34,
+			"by_specialty": {"Cardiology": 1}, "by_appointment_date": {"2024-02-15": 1}}`},
+		{"update", []string{"12345678", "--age", "35", "--disability"},
+			strings.Replace(strings.Replace(aliceOut, `"age": 34`, `"age": 35`, 1), `"disability": false`, `"disability": true`, 1)},
+		{"schedule", []string{"12345678", "2024-04-20", "11:30"},
+			`{"id": 1, "ci": "12345678", "date": "2024-04-20", "time": "11:30", "duration": 30, "specialty": "Cardiology", "status": "scheduled"}`},
+		{"save", nil, `{"saved": "` + store.DataDir() + `"}`},
+		{"delete", []string{"12345678"}, `{"deleted": "12345678"}`},
+		{"list", nil, "[]"},
+	}
+	for _, test := range tests {
+		what := strings.Join(append([]string{test.name}, test.args...), " ")
+		code, stdout, stderr := run(store, nil, test.name, test.args...)
+		if code != exitOK || stderr != "" {
+			t.Fatalf("%s = %d %s", what, code, stderr)
+		}
+		checkJSON(t, what, stdout, test.want)
+	}
+}
+
+// corruptStore opens a Go store whose saved record of Alice fails its
+// checksum.
+func corruptStore(t *testing.T) (models.PatientStore, error) {
+	t.Helper()
+	store := newCLIStore(t)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	path := filepath.Join(store.DataDir(), "patients.bin")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-10] ^= 1
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return openCLIStore(t, store.DataDir())
+}
+
+// unreadableStore opens a Go store with a directory where the patients file
+// goes.
+func unreadableStore(t *testing.T) (models.PatientStore, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "patients.bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return openCLIStore(t, dir)
+}
+
+// bookedStore opens a Go store in which Alice has an appointment at 09:00
+// on 2024-01-10.
+func bookedStore(t *testing.T) (models.PatientStore, error) {
+	t.Helper()
+	store := newCLIStore(t)
+	if code, _, stderr := run(store, nil, "schedule", "12345678", "2024-01-10", "09:00"); code != exitOK {
+		t.Fatalf("schedule = %d %s", code, stderr)
+	}
+	return store, nil
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		open  func(t *testing.T) (models.PatientStore, error)
+		code  int
+		error string // code name in the printed error, if any
+	}{
+		{name: "get", code: exitUsage},
+		{name: "get", args: []string{"12345678", "extra"}, code: exitUsage},
+		{name: "list", args: []string{"--filter", "tall"}, code: exitUsage},
+		{name: "update", args: []string{"12345678", "--ci", "87654321"}, code: exitUsage},
+		{name: "add", args: append(slices.Clone(aliceArgs), "--age", "-1"), code: exitValidation, error: "ERR_FIELD_AGE_INVALID"},
+		{name: "list", args: []string{"--filter", "date=2024-13-01"}, code: exitValidation, error: "ERR_FIELD_APPOINTMENT_DATE_FORMAT"},
+		{name: "get", args: []string{"87654321"}, code: exitNotFound, error: "ERR_NOT_FOUND"},
+		{name: "delete", args: []string{"87654321"}, code: exitNotFound, error: "ERR_NOT_FOUND"},
+		{name: "add", args: aliceArgs, code: exitDuplicate, error: "ERR_DUPLICATE"},
+		{name: "get", args: []string{"12345678"}, open: unreadableStore, code: exitIO, error: "ERR_IO"},
+		{name: "get", args: []string{"12345678"}, open: corruptStore, code: exitCorrupt, error: "ERR_CHECKSUM"},
+		{name: "schedule", args: []string{"12345678", "2024-01-10", "09:00"}, open: bookedStore, code: exitBooking, error: "ERR_APPOINTMENT_CONFLICT"},
+		{name: "stats", open: func(t *testing.T) (models.PatientStore, error) {
+			return newCLIStore(t), errors.New("locked by another process")
+		}, code: exitFailure},
+	}
+	for _, test := range tests {
+		what := strings.Join(append([]string{test.name}, test.args...), " ")
+		open := test.open
+		if open == nil {
+			open = func(t *testing.T) (models.PatientStore, error) { return newCLIStore(t), nil }
+		}
+		store, openErr := open(t)
+		code, stdout, stderr := run(store, openErr, test.name, test.args...)
+		if code != test.code || stdout != "" {
+			t.Errorf("%s = %d %q, want %d", what, code, stdout, test.code)
+			continue
+		}
+		var printed map[string]cliError
+		if err := json.Unmarshal([]byte(stderr), &printed); err != nil {
+			t.Fatalf("%s printed %q: %v", what, stderr, err)
+		}
+		if got := printed["error"]; got.Name != test.error || got.Message == "" || (code == exitUsage) != (got.Usage != "") {
+			t.Errorf("%s printed %+v, want code %q", what, got, test.error)
+		}
+	}
+}
+
+// Changes stay in the log until `save` checkpoints them.
+func TestCommandsKeepChangesInTheLog(t *testing.T) {
+	store := newCLIStore(t)
+	wal := filepath.Join(store.DataDir(), "patients.wal")
+	if _, err := os.Stat(wal); err != nil {
+		t.Fatalf("after add: %v, want the change logged", err)
+	}
+	if code, _, stderr := run(store, nil, "save"); code != exitOK {
+		t.Fatalf("save = %d %s", code, stderr)
+	}
+	if _, err := os.Stat(wal); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("after save: %v, want the log cleared", err)
+	}
+}
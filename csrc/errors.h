@@ -10,6 +10,8 @@ typedef enum {
     ERR_DUPLICATE = 105,                    // Duplicate entry
     ERR_NOT_FOUND = 106,                    // Entry not found
     ERR_ASSIGN = 107,                       // Assignment to destination pointer failed
+    ERR_APPOINTMENT_CONFLICT = 108,         // Patient already has an appointment at that time
+    ERR_SLOT_FULL = 109,                    // Time slot is fully booked
 
     // Field-specific validation errors (grouped for each field)
     ERR_FIELD_CI_NULL = 200,                // CI is NULL
@@ -24,10 +26,15 @@ typedef enum {
     ERR_FIELD_SPECIALTY_TOO_LONG = 209,     // Specialty is too long
     ERR_FIELD_APPOINTMENT_DATE_NULL = 210,  // Appointment date is NULL
     ERR_FIELD_APPOINTMENT_DATE_FORMAT = 211,// Appointment date must be YYYY-MM-DD (10 chars)
+    ERR_FIELD_APPOINTMENT_TIME_FORMAT = 212,// Appointment time must be HH:MM
+    ERR_FIELD_APPOINTMENT_DURATION_INVALID = 213,// Appointment must last a minute or more and end by midnight
 
     // Additional context-specific error codes
     ERR_PARSE_LINE = 300,                   // Malformed or unreadable line in file
-    ERR_INDEX_RANGE = 301                   // Hash/index out of allowed range
+    ERR_INDEX_RANGE = 301,                  // Hash/index out of allowed range
+    ERR_FORMAT = 302,                       // Missing or corrupt file header
+    ERR_VERSION = 303,                      // File format version needs migration
+    ERR_CHECKSUM = 304                      // Record checksum mismatch
 } ErrorCodes;
 
 static inline const char* ErrorDescription(int code) {
@@ -40,6 +47,8 @@ static inline const char* ErrorDescription(int code) {
         case ERR_DUPLICATE: return "Duplicate entry";
         case ERR_NOT_FOUND: return "Entry not found";
         case ERR_ASSIGN: return "Assignment to destination pointer failed";
+        case ERR_APPOINTMENT_CONFLICT: return "Patient already has an appointment at that time";
+        case ERR_SLOT_FULL: return "Time slot is fully booked";
         case ERR_FIELD_CI_NULL: return "CI is NULL";
         case ERR_FIELD_CI_FORMAT: return "CI must be exactly 8 digits";
         case ERR_FIELD_NAME_NULL: return "Name is NULL";
@@ -52,8 +61,13 @@ static inline const char* ErrorDescription(int code) {
         case ERR_FIELD_SPECIALTY_TOO_LONG: return "Specialty is too long";
         case ERR_FIELD_APPOINTMENT_DATE_NULL: return "Appointment date is NULL";
         case ERR_FIELD_APPOINTMENT_DATE_FORMAT: return "Appointment date must be YYYY-MM-DD (10 chars)";
+        case ERR_FIELD_APPOINTMENT_TIME_FORMAT: return "Appointment time must be HH:MM";
+        case ERR_FIELD_APPOINTMENT_DURATION_INVALID: return "Appointment must last a minute or more and end by midnight";
         case ERR_PARSE_LINE: return "Malformed or unreadable line in file";
         case ERR_INDEX_RANGE: return "Hash/index out of allowed range";
+        case ERR_FORMAT: return "Missing or corrupt file header";
+        case ERR_VERSION: return "File format version needs migration";
+        case ERR_CHECKSUM: return "Record checksum mismatch";
         default: return "Unknown error code";
     }
 }
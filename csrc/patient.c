@@ -3,7 +3,11 @@
 #include <string.h>
 #include <errno.h>
 #include <ctype.h>
+#include <stdint.h>
+#include <fcntl.h>
+#include <unistd.h>
 #include "patient.h"
+#include "patient_file.h"
 #include "errors.h"
 
 int NewPatient(
@@ -64,11 +68,92 @@ int ParseCI(size_t* dest, const char* ci) {
     return 0;
 }
 
-int Hash(size_t* dest, const char* str) {
+int Hash(size_t* dest, const char* str, size_t capacity) {
+    if (capacity == 0) return ERR_INDEX_RANGE;
     size_t hash;
     int err = ParseCI(&hash, str);
     if (err != 0) return err; // Error in parsing CI
-    *dest = hash % MAX_INDEX; // Example: limit to 1000 buckets
+    *dest = hash % capacity;
+    return 0;
+}
+
+int InitIndex(Index* index, size_t capacity) {
+    if (index == NULL) return ERR_NULL_PTR;
+    if (capacity == 0) return ERR_INDEX_RANGE;
+    PatientIndex* entries = calloc(capacity, sizeof(PatientIndex));
+    if (entries == NULL) return ERR_ALLOC;
+    for (size_t i = 0; i < capacity; i++) {
+        entries[i].next = -1;
+    }
+    FreeIndex(index);
+    index->entries = entries;
+    index->capacity = capacity;
+    index->count = 0;
+    index->tombstones = 0;
+    return 0;
+}
+
+void FreeIndex(Index* index) {
+    if (index == NULL) return;
+    free(index->entries);
+    index->entries = NULL;
+    index->capacity = 0;
+    index->count = 0;
+    index->tombstones = 0;
+}
+
+// Place an entry in the table without checking the load factor.
+static int InsertIndexEntry(Index* index, const PatientIndex* entry) {
+    size_t hash;
+    int error = Hash(&hash, entry->ci, index->capacity);
+    if (error != 0) {
+        return error;
+    }
+
+    PatientIndex* buckets = index->entries;
+    if (buckets[hash].ci[0] == '\0') {
+        // A tombstone in the home bucket can be reused as long as its link
+        // is kept, other chains may still pass through it
+        int next = buckets[hash].deleted ? buckets[hash].next : -1;
+        if (buckets[hash].deleted) index->tombstones--;
+        buckets[hash] = *entry;
+        buckets[hash].next = next;
+        buckets[hash].deleted = 0;
+        index->count++;
+        return 0;
+    }
+
+    // Collision Handling through linear sounding: take the next free bucket
+    // and link it right after the home bucket of the chain
+    for (size_t step = 1; step < index->capacity; step++) {
+        size_t i = (hash + step) % index->capacity;
+        if (buckets[i].ci[0] != '\0' || buckets[i].deleted) continue;
+        buckets[i] = *entry;
+        buckets[i].next = buckets[hash].next;
+        buckets[hash].next = (int)i;
+        index->count++;
+        return 0;
+    }
+
+    return ERR_OUT_OF_RANGE;
+}
+
+int ResizeIndex(Index* index, size_t capacity) {
+    if (index == NULL) return ERR_NULL_PTR;
+    if (capacity < index->count) return ERR_INDEX_RANGE;
+    Index resized = {0};
+    int error = InitIndex(&resized, capacity);
+    if (error != 0) return error;
+    for (size_t i = 0; i < index->capacity; i++) {
+        if (index->entries[i].ci[0] == '\0') continue;
+        error = InsertIndexEntry(&resized, &index->entries[i]);
+        if (error != 0) {
+            FreeIndex(&resized);
+            return error;
+        }
+    }
+    FreeIndex(index);
+    *index = resized;
     return 0;
 }
 
@@ -82,66 +167,141 @@ int NewPatientIndex(
     if (ci == NULL) return ERR_FIELD_CI_NULL;
     if (strlen(ci) != 8) return ERR_FIELD_CI_FORMAT;
 
+    size_t existing;
+    if (FindPatientIndex(&existing, index, ci) == 0) return ERR_DUPLICATE;
+
     PatientIndex p;
     memset(&p, 0, sizeof(PatientIndex));
     strcpy(p.ci, ci);
-    if (!p.ci) {
-        return ERR_ALLOC;
-    }
     p.position = position;
     p.next = -1;
 
-    size_t hash;
-    int error = Hash(&hash, p.ci);
+    int error = 0;
+    if (index->entries == NULL) {
+        error = InitIndex(index, INDEX_CAPACITY);
+    } else if (index->count + 1 > index->capacity * INDEX_MAX_LOAD) {
+        error = ResizeIndex(index, index->capacity * 2);
+    } else if (index->count + index->tombstones + 1 > index->capacity * INDEX_MAX_LOAD) {
+        // Mostly tombstones: rehash in place to clear them out
+        error = ResizeIndex(index, index->capacity);
+    }
     if (error != 0) {
         return error;
     }
 
-    // Collision Handling through linear sounding
-    if ((*index)[hash].ci[0] != '\0') {
-        int assigned = 0;
-        for (int i = hash + 1; i < MAX_INDEX - 1; i++) {
-            if ((*index)[i].ci[0] != '\0') {
-                (*index)[i] = p;
-                assigned = 1;
-                if ((*index)[hash].next != -1) {
-                    int temp;
-                    temp = (*index)[hash].next;
-                    (*index)[hash].next = i;
-                    (*index)[i].next = temp;
-                } else {
-                    (*index)[hash].next = i;
-                }
-                break;
-            }
-        }
+    return InsertIndexEntry(index, &p);
+}
 
-        if (!assigned) {
-            for(int i = 0; i < hash; i++) {
-                if ((*index)[i].ci[0] != '\0') {
-                    (*index)[i] = p;
-                    assigned = 1;
-                    if ((*index)[hash].next != -1) {
-                        int temp;
-                        temp = (*index)[hash].next;
-                        (*index)[hash].next = i;
-                        (*index)[i].next = temp;
-                    } else {
-                        (*index)[hash].next = i;
-                    }
-                    break;
-                }   
-            }
+int FindPatientIndex(size_t* slot, const Index* index, const char* ci) {
+    if (slot == NULL || index == NULL) return ERR_NULL_PTR;
+    if (ci == NULL) return ERR_FIELD_CI_NULL;
+    if (index->entries == NULL) return ERR_NOT_FOUND;
+    size_t hash = 0;
+    int err = Hash(&hash, ci, index->capacity);
+    if (err != 0) return ERR_INVALID_ARG;
+
+    // Walk through sinonimos, tombstones keep the chain linked
+    const PatientIndex* buckets = index->entries;
+    int i = (int)hash;
+    if (buckets[i].ci[0] == '\0' && !buckets[i].deleted) return ERR_NOT_FOUND;
+    while (i != -1) {
+        if (!buckets[i].deleted && strcmp(buckets[i].ci, ci) == 0) {
+            *slot = (size_t)i;
+            return 0;
         }
+        i = buckets[i].next;
+    }
+    return ERR_NOT_FOUND;
+}
 
-        if (!assigned) return ERR_OUT_OF_RANGE;
-    } else {
-        (*index)[hash] = p;
+int RemovePatientIndex(Index* index, const char* ci) {
+    if (index == NULL) return ERR_NULL_PTR;
+    size_t slot;
+    int error = FindPatientIndex(&slot, index, ci);
+    if (error != 0) return error;
+    PatientIndex* entry = &index->entries[slot];
+    memset(entry->ci, 0, sizeof(entry->ci));
+    entry->position = 0;
+    entry->deleted = 1;
+    index->count--;
+    index->tombstones++;
+    return 0;
+}
+
+int ReservePatients(PatientList* list, size_t capacity) {
+    if (list == NULL) return ERR_NULL_PTR;
+    if (capacity <= list->capacity) return 0;
+    // Grow geometrically so repeated appends stay amortized O(1)
+    size_t new_capacity = list->capacity > 0 ? list->capacity : PAGE_SIZE;
+    while (new_capacity < capacity) new_capacity *= 2;
+    Patient* items = realloc(list->items, new_capacity * sizeof(Patient));
+    if (items == NULL) return ERR_ALLOC;
+    memset(&items[list->capacity], 0, (new_capacity - list->capacity) * sizeof(Patient));
+    list->items = items;
+    list->capacity = new_capacity;
+    return 0;
+}
+
+int AppendPatient(PatientList* list, const Patient* p) {
+    if (list == NULL || p == NULL) return ERR_NULL_PTR;
+    int error = ReservePatients(list, list->count + 1);
+    if (error != 0) return error;
+    list->items[list->count++] = *p;
+    return 0;
+}
+
+void FreePatientList(PatientList* list) {
+    if (list == NULL) return;
+    free(list->items);
+    list->items = NULL;
+    list->count = 0;
+    list->capacity = 0;
+}
+
+int IsEmptyPatient(const Patient* p) {
+    return p != NULL && p->ci[0] == '\0';
+}
+
+int PushFreeSlot(FreeList* list, size_t slot) {
+    if (list == NULL) return ERR_NULL_PTR;
+    if (list->count == list->capacity) {
+        size_t new_capacity = list->capacity > 0 ? list->capacity * 2 : PAGE_SIZE;
+        size_t* slots = realloc(list->slots, new_capacity * sizeof(size_t));
+        if (slots == NULL) return ERR_ALLOC;
+        list->slots = slots;
+        list->capacity = new_capacity;
     }
+    list->slots[list->count++] = slot;
+    return 0;
+}
+
+int PopFreeSlot(FreeList* list, size_t* slot) {
+    if (list == NULL || slot == NULL) return ERR_NULL_PTR;
+    if (list->count == 0) return ERR_NOT_FOUND;
+    *slot = list->slots[--list->count];
+    return 0;
+}
 
+int BuildFreeList(FreeList* dest, const PatientList* patients) {
+    if (dest == NULL || patients == NULL) return ERR_NULL_PTR;
+    dest->count = 0;
+    // Push in reverse so the lowest positions are reused first
+    for (size_t i = patients->count; i > 0; i--) {
+        if (!IsEmptyPatient(&patients->items[i - 1])) continue;
+        int error = PushFreeSlot(dest, i - 1);
+        if (error != 0) return error;
+    }
     return 0;
 }
 
+void FreeFreeList(FreeList* list) {
+    if (list == NULL) return;
+    free(list->slots);
+    list->slots = NULL;
+    list->count = 0;
+    list->capacity = 0;
+}
+
 void FreePatient(Patient* p) {
     if (p) {
         free(p);
@@ -167,60 +327,208 @@ void SortPatients(Patient* arr, int left, int right) {
     if (i < right) SortPatients(arr, i, right);
 }
 
-int SavePatients(Patient patients[], size_t patientsCount) {
-    if (patients == NULL) return ERR_NULL_PTR;
-    SortPatients(patients, 0, patientsCount - 1);
-    FILE* file = fopen(PATIENT_FILE, "wb");
+int FlushAndClose(FILE* file) {
+    int error = 0;
+    if (fflush(file) != 0 || fsync(fileno(file)) != 0) error = ERR_IO;
+    if (fclose(file) != 0) error = ERR_IO;
+    return error;
+}
+
+int OpenDatabase(Database* db, const char* dir) {
+    if (db == NULL) return ERR_NULL_PTR;
+    if (dir == NULL) dir = DATA_DIR;
+    memset(db, 0, sizeof(Database));
+    struct { char* dest; const char* name; const char* suffix; } paths[] = {
+        { db->patient_file,     PATIENT_FILE, "" },
+        { db->patient_tmp_file, PATIENT_FILE, TMP_SUFFIX },
+        { db->index_file,       INDEX_FILE,   "" },
+        { db->index_tmp_file,   INDEX_FILE,   TMP_SUFFIX },
+        { db->commit_file,      COMMIT_FILE,  "" },
+        { db->wal_file,         WAL_FILE,     "" },
+    };
+    int n = snprintf(db->dir, PATH_LEN, "%s", dir);
+    if (n < 0 || n >= PATH_LEN) return ERR_OUT_OF_RANGE;
+    for (size_t i = 0; i < sizeof(paths) / sizeof(paths[0]); i++) {
+        n = snprintf(paths[i].dest, PATH_LEN, "%s/%s%s", dir, paths[i].name, paths[i].suffix);
+        if (n < 0 || n >= PATH_LEN) return ERR_OUT_OF_RANGE;
+    }
+    return 0;
+}
+
+int SyncDataDir(const Database* db) {
+    int fd = open(db->dir, O_RDONLY);
+    if (fd < 0) return ERR_IO;
+    int error = fsync(fd) != 0 ? ERR_IO : 0;
+    close(fd);
+    return error;
+}
+
+// Write the records to `path` with a current-format header and flush them to
+// disk. Empty records are dropped when `skip_empty` is set and kept otherwise,
+// so positions don't move.
+static int WritePatientsFile(const char* path, const Patient* patients, size_t count, int skip_empty) {
+    FILE* file = fopen(path, "wb");
     if (file == NULL) return ERR_IO;
-    // printf("Saving %zu patients to %s\n", patientsCount, PATIENT_FILE);
-    for (size_t i = 0; i < patientsCount; i++) {
-        if (patients[i].age == 0) {
+    // printf("Saving %zu patients to %s\n", count, path);
+    size_t written = 0;
+    int error = WritePatientHeader(file, 0);
+    for (size_t i = 0; i < count && error == 0; i++) {
+        if (skip_empty && IsEmptyPatient(&patients[i])) {
             continue;
         }
         // printf("Saving patient %zu: CI=%s, Name=%s, Age=%d\n", i, patients[i].ci, patients[i].name, patients[i].age);
-        if (fwrite(&patients[i], sizeof(Patient), 1, file) != 1) {
+        error = WriteRecord(file, &patients[i]);
+        written++;
+    }
+    // Only claim the records once they are all written
+    if (error == 0) error = WritePatientHeader(file, written);
+    if (error != 0) {
+        fclose(file);
+        return error;
+    }
+    return FlushAndClose(file);
+}
+
+// Open the patients file and read its header. With `create` set a missing file is
+// created empty, which is how the first patient gets a header.
+// returns the open file, or NULL with `error` set
+static FILE* OpenPatientsFile(const Database* db, const char* mode, int create, PatientFileHeader* header, int* error) {
+    FILE* file = fopen(db->patient_file, mode);
+    if (file == NULL && create && errno == ENOENT) {
+        file = fopen(db->patient_file, "wb+");
+        if (file != NULL && (*error = WritePatientHeader(file, 0)) != 0) {
             fclose(file);
-            return ERR_IO;
+            return NULL;
         }
     }
-    fclose(file);
-    return 0;
+    if (file == NULL) {
+        *error = ERR_IO;
+        return NULL;
+    }
+    *error = ReadPatientHeader(file, header);
+    if (*error != 0) {
+        fclose(file);
+        return NULL;
+    }
+    return file;
 }
 
-int SaveIndex(Index* index) {
-    FILE *file = fopen(INDEX_FILE, "w");
+static int WriteIndexFile(const char* path, const Index* index) {
+    FILE *file = fopen(path, "w");
     if (!file) return ERR_IO;
-    for (size_t i = 0; i < MAX_INDEX; i++) {
-        if ((*index)[i].ci[0] == '\0') continue;
-        if (fprintf(file, "|%s|%zu|\n", (*index)[i].ci, (*index)[i].position) < 0) {
+    if (fprintf(file, "#capacity|%zu|\n", index->capacity) < 0) {
+        fclose(file);
+        return ERR_IO;
+    }
+    for (size_t i = 0; i < index->capacity; i++) {
+        if (index->entries[i].ci[0] == '\0') continue;
+        if (fprintf(file, "|%s|%zu|\n", index->entries[i].ci, index->entries[i].position) < 0) {
             fclose(file);
             return ERR_IO;
         }
     }
-    fclose(file);
-    return 0;
+    return FlushAndClose(file);
+}
+
+// Move a fully written temporary file over its target.
+static int ReplaceFile(const Database* db, const char* tmp_path, const char* path) {
+    if (rename(tmp_path, path) != 0) {
+        remove(tmp_path);
+        return ERR_IO;
+    }
+    return SyncDataDir(db);
+}
+
+// Move both temporary files into place. Once the commit marker is on disk the
+// save can no longer be lost: RecoverFiles rolls the renames forward.
+static int CommitFiles(const Database* db) {
+    FILE* marker = fopen(db->commit_file, "w");
+    if (marker == NULL) return ERR_IO;
+    int error = FlushAndClose(marker);
+    if (error == 0) error = SyncDataDir(db);
+    if (error != 0) {
+        remove(db->commit_file);
+        return error;
+    }
+    return RecoverFiles(db);
+}
+
+int RecoverFiles(const Database* db) {
+    if (db == NULL) return ERR_NULL_PTR;
+    if (access(db->commit_file, F_OK) != 0) {
+        // No commit in progress, leftovers come from an interrupted write
+        remove(db->patient_tmp_file);
+        remove(db->index_tmp_file);
+        return 0;
+    }
+    if (access(db->patient_tmp_file, F_OK) == 0 && rename(db->patient_tmp_file, db->patient_file) != 0) return ERR_IO;
+    if (access(db->index_tmp_file, F_OK) == 0 && rename(db->index_tmp_file, db->index_file) != 0) return ERR_IO;
+    int error = SyncDataDir(db);
+    if (error != 0) return error;
+    if (remove(db->commit_file) != 0) return ERR_IO;
+    return SyncDataDir(db);
+}
+
+int SavePatients(const Database* db, Patient patients[], size_t patientsCount) {
+    if (db == NULL || patients == NULL) return ERR_NULL_PTR;
+    // Written as is, empty records included, so index positions stay valid
+    int error = WritePatientsFile(db->patient_tmp_file, patients, patientsCount, 0);
+    if (error != 0) {
+        remove(db->patient_tmp_file);
+        return error;
+    }
+    return ReplaceFile(db, db->patient_tmp_file, db->patient_file);
+}
+
+int SaveIndex(const Database* db, Index* index) {
+    if (db == NULL || index == NULL) return ERR_NULL_PTR;
+    int error = WriteIndexFile(db->index_tmp_file, index);
+    if (error != 0) {
+        remove(db->index_tmp_file);
+        return error;
+    }
+    return ReplaceFile(db, db->index_tmp_file, db->index_file);
 }
 
 int LoadIndex(
+    const Database* db,
     Index* dest
 ) {
-    if (dest == NULL) return ERR_NULL_PTR;
-    FILE *file = fopen(INDEX_FILE, "r");
+    if (db == NULL || dest == NULL) return ERR_NULL_PTR;
+    FILE *file = fopen(db->index_file, "r");
     if (file == NULL) return ERR_IO;
     #define LINE_BUF_SIZE 256
     // Initialize the index to empty
-    memset(dest, 0, sizeof(*dest));
+    int error = InitIndex(dest, INDEX_CAPACITY);
+    if (error != 0) {
+        fclose(file);
+        return error;
+    }
     // Read each line and parse the index
-    // Each line should be in the format: |CI|position|
+    // An optional first line "#capacity|N|" restores the table size,
+    // every other line should be in the format: |CI|position|
     char line[LINE_BUF_SIZE];
     while (fgets(line, sizeof(line), file)) {
         PatientIndex idx;
         if (line[0] == '\0' || line[0] == '\n') continue;
+        if (line[0] == '#') {
+            size_t capacity;
+            if (sscanf(line, "#capacity|%zu|", &capacity) != 1) {
+                fclose(file);
+                return ERR_PARSE_LINE;
+            }
+            error = InitIndex(dest, capacity > 0 ? capacity : INDEX_CAPACITY);
+            if (error != 0) {
+                fclose(file);
+                return error;
+            }
+            continue;
+        }
         if (sscanf(line, "|%8s|%zu|", idx.ci, &idx.position) != 2) {
             fclose(file);
             return ERR_PARSE_LINE;
         }
-        size_t error = NewPatientIndex(dest, idx.ci, idx.position);
+        error = NewPatientIndex(dest, idx.ci, idx.position);
         if (error != 0) {
             fclose(file);
             return error;
@@ -234,146 +542,347 @@ int LoadIndex(
     return 0;
 }
 
-int GetPatient(Patient* p_dest, size_t* i_dest, Index index, const char* ci) {
-    if (p_dest == NULL || i_dest == NULL || ci == NULL) return ERR_NULL_PTR;
+int GetPatient(const Database* db, Patient* p_dest, size_t* i_dest, const Index* index, const char* ci) {
+    if (db == NULL || p_dest == NULL || i_dest == NULL || ci == NULL) return ERR_NULL_PTR;
     if (index == NULL) return ERR_NULL_PTR;
     size_t hash = 0;
-    int err = Hash(&hash, ci);
+    int err = FindPatientIndex(&hash, index, ci);
     // printf("Hashing CI %s to %zu\n", ci, hash);
-    if (err != 0) return ERR_INVALID_ARG;
-    if (index[hash].ci[0] == '\0') {
-        // printf("No patient found for CI %s at hash %zu\n", ci, hash);
-        return ERR_NOT_FOUND;
-    }
-
-    // Walk through sinonimos
-    if (strcmp(index[hash].ci, ci) != 0) {
-        int found = 0;
-        PatientIndex temp = index[hash];
-        while(temp.next != -1) {
-            if (strcmp(index[temp.next].ci, ci) == 0) {
-                found = 1;
-                break;
-            }
-            temp = index[temp.next];
-        }
-        if (found) {
-            hash = temp.next;
-        } else {
-            return ERR_NOT_FOUND;
-        }
-    }
-    size_t position = index[hash].position;
+    if (err != 0) return err;
+    const PatientIndex* buckets = index->entries;
+    size_t position = buckets[hash].position;
     // printf("Hash position for CI %s: %zu, File position: %zu\n", ci, hash, position);
-    FILE* file = fopen(PATIENT_FILE, "rb");
-    if (file == NULL) return ERR_IO;
-    fseek(file, position * sizeof(Patient), SEEK_SET);
-    if (fread(p_dest, sizeof(Patient), 1, file) != 1) {
+    PatientFileHeader header;
+    FILE* file = OpenPatientsFile(db, "rb", 0, &header, &err);
+    if (file == NULL) return err;
+    if (position >= header.record_count) {
         fclose(file);
         return ERR_IO;
     }
-    *i_dest = hash;
+    err = SeekRecord(file, position);
+    if (err == 0) err = ReadRecord(file, p_dest);
     fclose(file);
+    if (err != 0) return err;
+    *i_dest = hash;
     return 0;
 }
 
 int AddPatient(
+    const Database* db,
     size_t* count,
     Index* index,
+    FreeList* free_slots,
     Patient* new_patient
 ) {
-    if (count == NULL || new_patient == NULL) {
+    if (db == NULL || count == NULL || index == NULL || new_patient == NULL) {
         return ERR_NULL_PTR;
     }
-    if (*count >= MAX_PATIENTS) {
-        return ERR_OUT_OF_RANGE;
-    }
 
-    FILE *file = fopen(PATIENT_FILE, "ab");
-    if (file == NULL) {
-        return ERR_IO;
-    }
-    if (fwrite(new_patient, sizeof(Patient), 1, file) != 1) {
-        fclose(file);
-        return ERR_IO;
+    // Fill the hole left by a deleted patient before growing the file
+    size_t position;
+    int reused = free_slots != NULL && PopFreeSlot(free_slots, &position) == 0;
+    if (!reused) {
+        position = *count;
+    }
+
+    // Indexed before anything is written, so a duplicate or a full table
+    // leaves no trace, and taken out again if the record can't be written
+    int err = NewPatientIndex(index, new_patient->ci, position);
+    if (err == 0) {
+        PatientFileHeader header;
+        FILE *file = OpenPatientsFile(db, "rb+", 1, &header, &err);
+        if (file != NULL) {
+            err = SeekRecord(file, position);
+            if (err == 0) err = WriteRecord(file, new_patient);
+            // Appends only count once the record itself is written
+            if (err == 0 && position >= header.record_count) err = WritePatientHeader(file, position + 1);
+            if (fclose(file) != 0 && err == 0) err = ERR_IO;
+        }
+        if (err != 0) RemovePatientIndex(index, new_patient->ci);
     }
-    fclose(file);
-    
-    int err = NewPatientIndex(index, new_patient->ci, *count);
     if (err != 0) {
+        if (reused) PushFreeSlot(free_slots, position);
         return err;
     }
-    (*count)++;
+    if (!reused) (*count)++;
     return 0;
 }
 
 int UpdatePatient(
+    const Database* db,
     Index* index,
     const char* ci,
     Patient* updated_patient
 ) {
-    if (index == NULL || ci == NULL || updated_patient == NULL) {;
+    if (db == NULL || index == NULL || ci == NULL || updated_patient == NULL) {
         return ERR_NULL_PTR;
     }
     size_t hash;
     Patient dummy;
-    int err = GetPatient(&dummy, &hash, *index, ci);
+    int err = GetPatient(db, &dummy, &hash, index, ci);
     if (err != 0) {
         return err;
     }
-    size_t position = (*index)[hash].position;
+    size_t position = index->entries[hash].position;
 
-    FILE* file = fopen(PATIENT_FILE, "rb+");
-    if (file == NULL) return ERR_IO;
-    fseek(file, position * sizeof(Patient), SEEK_SET);
-    if (fwrite(updated_patient, sizeof(Patient), 1, file) != 1) {
-        fclose(file);
-        return ERR_IO;
-    }
-    fclose(file);
-    return 0;
+    PatientFileHeader header;
+    FILE* file = OpenPatientsFile(db, "rb+", 0, &header, &err);
+    if (file == NULL) return err;
+    err = SeekRecord(file, position);
+    if (err == 0) err = WriteRecord(file, updated_patient);
+    if (fclose(file) != 0 && err == 0) err = ERR_IO;
+    return err;
 }
 
 int SyncFiles(
+    const Database* db,
     Patient patients[],
-    size_t count,
+    size_t* count,
     Index* index
 ) {
-    if (patients == NULL || index == NULL) {
+    if (db == NULL || patients == NULL || count == NULL || index == NULL) {
         return ERR_NULL_PTR;
     }
-    int error = SavePatients(patients, count);
+    SortPatients(patients, 0, (int)*count - 1);
+
+    // Empty records sort first; drop them so array and file positions match
+    size_t kept = 0;
+    for (size_t i = 0; i < *count; i++) {
+        if (IsEmptyPatient(&patients[i])) continue;
+        patients[kept++] = patients[i];
+    }
+    *count = kept;
+
+    // Index every record by the position it is written at
+    Index sorted = {0};
+    int error = InitIndex(&sorted, index->capacity > 0 ? index->capacity : INDEX_CAPACITY);
+    for (size_t i = 0; i < kept && error == 0; i++) {
+        error = NewPatientIndex(&sorted, patients[i].ci, i);
+        if (error == ERR_DUPLICATE) {
+            // Left over from before duplicates were rejected; only the first
+            // one was ever reachable
+            memmove(&patients[i], &patients[i + 1], (kept - i - 1) * sizeof(Patient));
+            kept--;
+            i--;
+            error = 0;
+        }
+    }
+    *count = kept;
+
+    if (error == 0) error = WritePatientsFile(db->patient_tmp_file, patients, kept, 1);
+    if (error == 0) error = WriteIndexFile(db->index_tmp_file, &sorted);
     if (error != 0) {
+        FreeIndex(&sorted);
+        remove(db->patient_tmp_file);
+        remove(db->index_tmp_file);
         return error;
     }
-    error = SaveIndex(index);
+    error = CommitFiles(db);
     if (error != 0) {
+        FreeIndex(&sorted);
         return error;
     }
+    FreeIndex(index);
+    *index = sorted;
     return 0;
 }
 
-int LoadPatients(Patient* dest, size_t* dest_size) {
-    if (dest == NULL) return ERR_NULL_PTR;
-    FILE* file = fopen(PATIENT_FILE, "rb");
-    if (file == NULL) {
-        int errnum = errno;                              // capture errno
-        return errnum;    // or return errnum if you want to propagate the raw errno
+int CompactPatients(const Database* db, PatientList* patients, Index* index, FreeList* free_slots) {
+    if (db == NULL || patients == NULL || index == NULL || free_slots == NULL) return ERR_NULL_PTR;
+
+    // Index the live records by the position they will have in the new file
+    Index compacted = {0};
+    int error = InitIndex(&compacted, index->capacity > 0 ? index->capacity : INDEX_CAPACITY);
+    if (error != 0) return error;
+    size_t live = 0;
+    for (size_t i = 0; i < patients->count && error == 0; i++) {
+        if (IsEmptyPatient(&patients->items[i])) continue;
+        error = NewPatientIndex(&compacted, patients->items[i].ci, live);
+        if (error == ERR_DUPLICATE) {
+            // Left over from before duplicates were rejected; only the first
+            // one was ever reachable, so drop the rest with the empty slots
+            memset(&patients->items[i], 0, sizeof(Patient));
+            error = 0;
+            continue;
+        }
+        live++;
+    }
+
+    // Write both files aside and swap them in together
+    if (error == 0) error = WritePatientsFile(db->patient_tmp_file, patients->items, patients->count, 1);
+    if (error == 0) error = WriteIndexFile(db->index_tmp_file, &compacted);
+    if (error != 0) {
+        FreeIndex(&compacted);
+        remove(db->patient_tmp_file);
+        remove(db->index_tmp_file);
+        return error;
     }
-    size_t count = 0;
-    while (fread(&dest[count], sizeof(Patient), 1, file) == 1) {
-        count++;
+    error = CommitFiles(db);
+    if (error != 0) {
+        FreeIndex(&compacted);
+        return error;
     }
-    if (ferror(file)) {
-        int errnum = errno;                              // capture errno
+
+    size_t kept = 0;
+    for (size_t i = 0; i < patients->count; i++) {
+        if (IsEmptyPatient(&patients->items[i])) continue;
+        patients->items[kept++] = patients->items[i];
+    }
+    patients->count = kept;
+    FreeIndex(index);
+    *index = compacted;
+    free_slots->count = 0;
+    return 0;
+}
+
+int LoadPatients(const Database* db, PatientList* dest) {
+    if (db == NULL || dest == NULL) return ERR_NULL_PTR;
+    FILE* file = fopen(db->patient_file, "rb");
+    if (file == NULL) return ERR_IO; // errno says why
+    PatientFileHeader header;
+    int error = ReadPatientHeader(file, &header);
+    // A count the file can't hold is a damaged header, not a reason to
+    // allocate that much
+    long size = 0;
+    if (error == 0 && (fseek(file, 0, SEEK_END) != 0 || (size = ftell(file)) < 0)) error = ERR_IO;
+    if (error == 0 && header.record_count > (uint64_t)(size - HEADER_SIZE) / RECORD_SIZE) error = ERR_FORMAT;
+    if (error == 0 && fseek(file, HEADER_SIZE, SEEK_SET) != 0) error = ERR_IO;
+    if (error != 0) {
         fclose(file);
-        return errnum;
+        return error;
+    }
+    dest->count = 0;
+    error = ReservePatients(dest, header.record_count);
+    if (error != 0) {
+        fclose(file);
+        return error;
+    }
+    // Records follow the header back to back, so no seeking is needed
+    while (error == 0 && dest->count < header.record_count) {
+        error = ReadRecord(file, &dest->items[dest->count]);
+        if (error == 0) dest->count++;
+    }
+    fclose(file);
+    return error;
+}
+
+int CountPatients(const Database* db, size_t* dest) {
+    if (db == NULL || dest == NULL) return ERR_NULL_PTR;
+    PatientFileHeader header;
+    int error;
+    FILE* file = OpenPatientsFile(db, "rb", 0, &header, &error);
+    if (file == NULL) return error;
+    fclose(file);
+    *dest = header.record_count;
+    return 0;
+}
+
+int LoadPatientsPage(const Database* db, Patient* dest, size_t offset, size_t limit, size_t* read_count) {
+    return LoadPatientsPageChecked(db, dest, NULL, offset, limit, read_count);
+}
+
+int LoadPatientsPageChecked(const Database* db, Patient* dest, int* status, size_t offset, size_t limit, size_t* read_count) {
+    if (db == NULL || dest == NULL || read_count == NULL) return ERR_NULL_PTR;
+    *read_count = 0;
+    PatientFileHeader header;
+    int error;
+    FILE* file = OpenPatientsFile(db, "rb", 0, &header, &error);
+    if (file == NULL && error == ERR_IO && errno == ENOENT) return 0; // nothing saved yet
+    if (file == NULL) return error;
+    if (offset >= header.record_count) {
+        fclose(file);
+        return 0;
+    }
+    if (limit > header.record_count - offset) limit = header.record_count - offset;
+    error = SeekRecord(file, offset);
+    while (error == 0 && *read_count < limit) {
+        int record_error = ReadRecord(file, &dest[*read_count]);
+        if (record_error == ERR_CHECKSUM && status != NULL) {
+            status[*read_count] = record_error;
+        } else if (record_error != 0) {
+            error = record_error;
+            break;
+        } else if (status != NULL) {
+            status[*read_count] = 0;
+        }
+        (*read_count)++;
     }
     fclose(file);
-    *dest_size = count;
+    return error;
+}
+
+// Read `count` raw Patient structs of `stride` bytes starting at byte `offset`
+// of `file`, as stored by format versions 0 to 2. Version 2 appends a CRC-32
+// to each struct, which is checked when `stride` leaves room for it.
+// `count` is SIZE_MAX to read to the end.
+static int ReadLegacyRecords(FILE* file, long offset, size_t stride, size_t count, PatientList* dest) {
+    if (fseek(file, offset, SEEK_SET) != 0) return ERR_IO;
+    unsigned char buf[sizeof(Patient) + RECORD_CRC_SIZE];
+    if (stride > sizeof(buf)) return ERR_FORMAT;
+    while (dest->count < count && fread(buf, stride, 1, file) == 1) {
+        if (stride > sizeof(Patient)) {
+            uint32_t crc = 0;
+            for (int i = 0; i < 4; i++) crc |= (uint32_t)buf[sizeof(Patient) + i] << (8 * i);
+            if (crc != Crc32(buf, sizeof(Patient))) return ERR_CHECKSUM;
+        }
+        Patient p;
+        memcpy(&p, buf, sizeof(Patient));
+        int error = AppendPatient(dest, &p);
+        if (error != 0) return error;
+    }
+    if (ferror(file)) return ERR_IO;
+    if (count != SIZE_MAX && dest->count < count) return ERR_IO; // truncated file
     return 0;
 }
 
+int MigratePatientsFile(const Database* db, int* from_version) {
+    if (db == NULL || from_version == NULL) return ERR_NULL_PTR;
+    *from_version = PATIENT_FORMAT_VERSION;
+    FILE* file = fopen(db->patient_file, "rb");
+    if (file == NULL) return errno == ENOENT ? 0 : ERR_IO; // nothing to migrate
+
+    PatientFileHeader header;
+    PatientList legacy = {0};
+    int error = ReadRawPatientHeader(file, &header);
+    if (error == 0 && header.version == PATIENT_FORMAT_VERSION) {
+        fclose(file);
+        return 0;
+    }
+    // Versions 0 to 2 stored this build's own struct layout, so they can only
+    // be migrated by a build with the same padding, int size and endianness.
+    char magic[4];
+    if (error != 0 && fseek(file, 0, SEEK_SET) == 0 && fread(magic, 4, 1, file) == 1 &&
+        memcmp(magic, PATIENT_MAGIC, 4) == 0) {
+        // A damaged header, not a file that never had one
+        fclose(file);
+        return ERR_FORMAT;
+    }
+    if (error != 0) {
+        // Version 0: no header, the whole file is raw Patient structs
+        *from_version = 0;
+        error = ReadLegacyRecords(file, 0, sizeof(Patient), SIZE_MAX, &legacy);
+    } else if (header.version == 1 && header.record_size == sizeof(Patient)) {
+        *from_version = 1;
+        error = ReadLegacyRecords(file, HEADER_SIZE, sizeof(Patient), header.record_count, &legacy);
+    } else if (header.version == 2 && header.record_size == sizeof(Patient) + RECORD_CRC_SIZE) {
+        *from_version = 2;
+        error = ReadLegacyRecords(file, HEADER_SIZE, header.record_size, header.record_count, &legacy);
+    } else {
+        // A header from a version this build doesn't know how to read
+        error = ERR_VERSION;
+    }
+    fclose(file);
+
+    // Keep empty records so every position in index.dat stays valid
+    if (error == 0) error = WritePatientsFile(db->patient_tmp_file, legacy.items, legacy.count, 0);
+    FreePatientList(&legacy);
+    if (error != 0) {
+        remove(db->patient_tmp_file);
+        return error;
+    }
+    return ReplaceFile(db, db->patient_tmp_file, db->patient_file);
+}
+
 void ShowPatient(const Patient* p) {
     if (p == NULL) return; // Error: null pointer
     if (p->age == 0) {
@@ -396,7 +905,7 @@ int ShowPatients(const Patient* patients, size_t count) {
     if (patients == NULL) return ERR_NULL_PTR;
     if (count == 0) return ERR_OUT_OF_RANGE;
     for (size_t i = 0; i < count; i++) {
-        if (patients[i].ci[0] == '\0' || !isdigit(patients[i].ci[0])) continue; // Skip empty entries
+        if (IsEmptyPatient(&patients[i]) || !isdigit(patients[i].ci[0])) continue; // Skip empty entries
         printf("=====================\n");
         printf("Patient %zu:\n", i + 1);
         ShowPatient(&patients[i]);
@@ -405,143 +914,41 @@ int ShowPatients(const Patient* patients, size_t count) {
     return 0;
 }
 
-int DeletePatient(Patient* patients, Index* index, const char* ci) {
-    if (patients == NULL) return ERR_NULL_PTR;
+int DeletePatient(const Database* db, Index* index, FreeList* free_slots, const char* ci) {
+    if (db == NULL) return ERR_NULL_PTR;
     if (ci == NULL) return ERR_FIELD_CI_NULL;
     Patient empty_patient;
     memset(&empty_patient, 0, sizeof(Patient));
-    int error = UpdatePatient(index, ci, &empty_patient);
+    int error = UpdatePatient(db, index, ci, &empty_patient);
     if (error != 0) return error;
-    size_t hash;
-    error = Hash(&hash, ci);
-    if (error != 0) {
-        return ERR_INVALID_ARG;
-    }
-    PatientIndex empty_index;
-    memset(&empty_index, 0, sizeof(PatientIndex));
-    (*index)[hash] = empty_index;
+    size_t slot;
+    error = FindPatientIndex(&slot, index, ci);
+    if (error != 0) return error;
+    size_t position = index->entries[slot].position;
+    error = RemovePatientIndex(index, ci);
+    if (error != 0) return error;
+    if (free_slots != NULL) return PushFreeSlot(free_slots, position);
     return 0;
 }
 
-int ScheduleAppointment(Patient* patients, Index index, const char* ci, const char* date) {
-    if (patients == NULL) return ERR_NULL_PTR;
+int ScheduleAppointment(const Database* db, Index* index, const char* ci, const char* date) {
+    if (db == NULL) return ERR_NULL_PTR;
     if (ci == NULL) return ERR_FIELD_CI_NULL;
     if (date == NULL) return ERR_FIELD_APPOINTMENT_DATE_NULL;
     Patient patient;
     size_t index_position;
-    int error = GetPatient(&patient, &index_position, index, ci);
+    int error = GetPatient(db, &patient, &index_position, index, ci);
     if (error != 0) return error;
     strcpy(patient.appointment_date, date);
-    error = UpdatePatient((Index*)index, ci, &patient);
+    error = UpdatePatient(db, index, ci, &patient);
     if (error != 0) return error;
     return 0;
 }
 
-
-#ifndef CGO_BUILD
-int main() {
-    GeneratePatients();
-    // load the index
-    // Index index;
-    // memset(index, 0, sizeof(index)); // Initialize the index array
-    // int error = 0;
-    // // Load Patients from the binary file
-    // size_t patient_count = 0;
-    // Patient patients[MAX_PATIENTS];
-    // memset(patients, 0, sizeof(patients)); // Initialize the patients array
-    // error = LoadPatients(patients, &patient_count);
-    // if (error != 0) {
-    //     printf("Error loading patients: %d\n", error);
-    //     return error;
-    // }
-    // printf("Loaded %zu patients from binary file.\n", patient_count);
-    // Create index entries for each patient
-    // for (size_t i = 0; i < patient_count; i++) {
-    //     if (patients[i].age == 0) continue; // Skip empty entries
-    //     error = NewPatientIndex(&index, patients[i].ci, i);
-    //     if (error != 0) {
-    //         printf("Error creating index for patient %zu: %d\n", i, error);
-    //         printf("Skipping patient %s.\n", patients[i].ci);
-    //         continue; // Skip this patient and continue with the next
-    //     }
-    // }
-    // printf("Index created with %zu entries.\n", patient_count);
-
-    // // Save the index to a file
-    // error = SaveIndex(&index);
-    // if (error != 0) {
-    //     printf("Error saving index: %d\n", error);
-    //     return error;
-    // }
-    // printf("Index saved to %s.\n", INDEX_FILE);
-
-    // memset(index, 0, sizeof(index)); // Initialize the index array
-    // // Load the index from the file
-    // error = LoadIndex(&index);
-    // if (error != 0) {
-    //     printf("Error loading index: %d\n", error);
-    //     return error;
-    // }
-    // printf("Index loaded with %u entries.\n", MAX_INDEX);
-
-    // // Print the index entries
-    // printf("Index entries:\n");
-    // for (size_t i = 0; i < MAX_INDEX; i++) {
-    //     if (index[i].ci[0] == '\0') continue; // Skip empty entries
-    //     printf("Index %zu: CI=%s, Position=%zu\n", i, index[i].ci, index[i].position);
-    // }
-
-    // // Example of retrieving a patient using the index
-    // for (size_t i = 0; i < MAX_INDEX; i++) {
-    //     if (index[i].ci[0] == '\0') continue; // Skip empty entries
-    //     printf("Index %zu: CI=%s, Position=%zu\n", i, index[i].ci, index[i].position);
-    //     Patient p_temp;
-    //     size_t index_position;
-    //     int error = GetPatient(&p_temp, &index_position, index, index[i].ci);
-    //     if (error == 0) {
-    //         printf("Patient found: %s, %s, %d\n", p_temp.ci, p_temp.name, p_temp.age);
-    //     } else {
-    //         printf("Error retrieving patient for CI: %s, error: %d\n", index[i].ci, error);
-    //     }
-    // }
-
-    // // Patient* p = NULL;
-    // // size_t result = NewPatient(&p, "12345678", "John Doe", 30, "Flu", 'M', 0, "Cardiology", "2023-10-01");
-    // // if (result != NEWPATIENT_SUCCESS) {
-    // //     printf("Error creating patient: %s\n", NewPatientErrorDescription(result));
-    // //     return result;
-    // // }
-
-    // // error = AddPatient(patients, &patient_count, &index, p);
-    // // if (error != 0) {
-    // //     printf("Error adding patient: %d\n", error);
-    // //     FreePatient(p);
-    // //     return error;
-    // // }
-
-    // // Show all patients
-    // error = ShowPatients(patients, patient_count);
-    // if (error != 0) {
-    //     printf("Error showing patients: %d\n", error);
-    //     return error;
-    // }
-
-    // error = SyncFiles(patients, patient_count, &index);
-    // if (error != 0) {
-    //     printf("Error syncing files: %d\n", error);
-    //     return error;
-    // }
-
-    return 0;
-}
-#endif
-
 int GeneratePatients() {
-    // load the index
-    Index index;
-    memset(index, 0, sizeof(index)); // Initialize the index array
+    Index index = {0};
     int error = 0;
-    // Load Patients from the binary file
+    // Sample patients written as a fresh database
     size_t patient_count = 15;
     Patient patients[] = {
     {"12345678", "Alice Johnson", 34, "Hypertension", 'F', 0, "Cardiology", "2023-02-15"},
@@ -560,14 +967,7 @@ int GeneratePatients() {
     {"99887766", "Noah Brown", 36, "Multiple Sclerosis", 'M', 1, "Neurology", "2024-03-19"},
     {"13572468", "Olivia Clark", 58, "Glaucoma", 'F', 0, "Ophthalmology", "2024-04-07"}
 };
-    //Patient patients[MAX_PATIENTS];
-    // memset(patients, 0, sizeof(patients)); // Initialize the patients array
-    // error = LoadPatients(patients, &patient_count);
-    // if (error != 0) {
-    //     printf("Error loading patients: %d\n", error);
-    //     return error;
-    // }
-    printf("Loaded %zu patients from binary file.\n", patient_count);
+    printf("Generated %zu patients.\n", patient_count);
     // Create index entries for each patient
     for (size_t i = 0; i < patient_count; i++) {
         if (patients[i].age == 0) continue; // Skip empty entries
@@ -580,58 +980,6 @@ int GeneratePatients() {
     }
     printf("Index created with %zu entries.\n", patient_count);
 
-    // // Save the index to a file
-    // error = SaveIndex(&index);
-    // if (error != 0) {
-    //     printf("Error saving index: %d\n", error);
-    //     return error;
-    // }
-    // printf("Index saved to %s.\n", INDEX_FILE);
-
-    // memset(index, 0, sizeof(index)); // Initialize the index array
-    // // Load the index from the file
-    // error = LoadIndex(&index);
-    // if (error != 0) {
-    //     printf("Error loading index: %d\n", error);
-    //     return error;
-    // }
-    // printf("Index loaded with %u entries.\n", MAX_INDEX);
-
-    // // Print the index entries
-    // printf("Index entries:\n");
-    // for (size_t i = 0; i < MAX_INDEX; i++) {
-    //     if (index[i].ci[0] == '\0') continue; // Skip empty entries
-    //     printf("Index %zu: CI=%s, Position=%zu\n", i, index[i].ci, index[i].position);
-    // }
-
-    // // Example of retrieving a patient using the index
-    // for (size_t i = 0; i < MAX_INDEX; i++) {
-    //     if (index[i].ci[0] == '\0') continue; // Skip empty entries
-    //     printf("Index %zu: CI=%s, Position=%zu\n", i, index[i].ci, index[i].position);
-    //     Patient p_temp;
-    //     size_t index_position;
-    //     int error = GetPatient(&p_temp, &index_position, index, index[i].ci);
-    //     if (error == 0) {
-    //         printf("Patient found: %s, %s, %d\n", p_temp.ci, p_temp.name, p_temp.age);
-    //     } else {
-    //         printf("Error retrieving patient for CI: %s, error: %d\n", index[i].ci, error);
-    //     }
-    // }
-
-    // // Patient* p = NULL;
-    // // size_t result = NewPatient(&p, "12345678", "John Doe", 30, "Flu", 'M', 0, "Cardiology", "2023-10-01");
-    // // if (result != NEWPATIENT_SUCCESS) {
-    // //     printf("Error creating patient: %s\n", NewPatientErrorDescription(result));
-    // //     return result;
-    // // }
-
-    // // error = AddPatient(patients, &patient_count, &index, p);
-    // // if (error != 0) {
-    // //     printf("Error adding patient: %d\n", error);
-    // //     FreePatient(p);
-    // //     return error;
-    // // }
-
     // Show all patients
     error = ShowPatients(patients, patient_count);
     if (error != 0) {
@@ -639,11 +987,20 @@ int GeneratePatients() {
         return error;
     }
 
-    error = SyncFiles(patients, patient_count, &index);
+    Database db;
+    OpenDatabase(&db, NULL);
+    error = SyncFiles(&db, patients, &patient_count, &index);
     if (error != 0) {
         printf("Error syncing files: %d\n", error);
         return error;
     }
 
+    FreeIndex(&index);
     return 0;
-}
\ No newline at end of file
+}
+
+#ifndef CGO_BUILD
+int main() {
+    return GeneratePatients();
+}
+#endif
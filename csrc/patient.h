@@ -2,18 +2,29 @@
 #define PATIENT_H
 
 #include <stddef.h>
+#include <stdio.h>
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Constants & File names
 // ——————————————————————————————————————————————————————————————————————————————
-#define MAX_PATIENTS      100      // maximum number of patients
-#define MAX_INDEX         1000     // size of index hash table
+#define PAGE_SIZE         100      // records read per page from the patients file
+#define INDEX_CAPACITY    1000     // initial size of index hash table
+#define INDEX_MAX_LOAD    0.75     // load factor that triggers a resize
 #define NAME_LEN          25      // max name length
 #define DIAG_LEN          50      // max diagnosis length
 #define SPEC_LEN          50      // max specialty length
 
-#define PATIENT_FILE      "data/patients.bin"
-#define INDEX_FILE        "data/index.dat"
+#define DATA_DIR          "data"   // database directory used by default
+#define PATH_LEN          1024     // max length of a database file path
+
+// File names inside the database directory
+#define PATIENT_FILE      "patients.bin"
+#define INDEX_FILE        "index.dat"
+#define WAL_FILE          "patients.wal"
+// Saves are written to <file>.tmp first and renamed into place
+#define TMP_SUFFIX        ".tmp"
+// Present while both temporary files are being moved into place
+#define COMMIT_FILE       "commit"
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Data Structures
@@ -29,13 +40,58 @@ typedef struct {
     char appointment_date[11];     // "YYYY-MM-DD"+NUL
 } Patient;
 
+// Growable array of patients, backed by heap memory.
+// A zeroed PatientList is a valid empty list.
+typedef struct {
+    Patient* items;
+    size_t   count;                // records in use
+    size_t   capacity;             // records allocated
+} PatientList;
+
+// Stack of record positions left empty by deleted patients.
+// A zeroed FreeList is a valid empty list.
+typedef struct {
+    size_t* slots;
+    size_t  count;
+    size_t  capacity;
+} FreeList;
+
 typedef struct PatientIndex {
     char    ci[9];
     size_t  position;              // position in patients array/file
     int next;     // for collision chains (optional)
+    int deleted;  // tombstone: entry removed but `next` still links the chain
 } PatientIndex;
 
-typedef PatientIndex Index[MAX_INDEX];
+// Hash table of PatientIndex buckets that grows and rehashes itself once
+// live entries plus tombstones exceed INDEX_MAX_LOAD of `capacity`.
+// A zeroed Index is valid and is allocated on first insert.
+typedef struct {
+    PatientIndex* entries;
+    size_t        capacity;        // buckets allocated
+    size_t        count;           // buckets in use
+    size_t        tombstones;      // buckets holding a deleted entry
+} Index;
+
+// Paths of the files making up one database, all inside `dir`.
+// Filled in by OpenDatabase; every function touching the files takes one.
+typedef struct {
+    char dir[PATH_LEN];
+    char patient_file[PATH_LEN];
+    char patient_tmp_file[PATH_LEN];
+    char index_file[PATH_LEN];
+    char index_tmp_file[PATH_LEN];
+    char commit_file[PATH_LEN];
+    char wal_file[PATH_LEN];
+} Database;
+
+// ——————————————————————————————————————————————————————————————————————————————
+// Database
+// ——————————————————————————————————————————————————————————————————————————————
+// Fill in the paths of the database kept in directory `dir`, DATA_DIR if NULL.
+// The directory itself is neither created nor checked.
+// returns 0 on success, ERR_OUT_OF_RANGE if a path would be too long
+int OpenDatabase(Database* db, const char* dir);
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Creation & Parsing
@@ -62,61 +118,179 @@ int NewPatient(
 int ParseCI(size_t* dest, const char* ci);
 
 // Compute a hash from a CI string for the index.
-//   dest: output pointer to hash (0..MAX_INDEX-1)
+//   dest:     output pointer to hash (0..capacity-1)
+//   capacity: number of buckets in the index
+// returns 0 on success, error code otherwise
+int Hash(size_t* dest, const char* str, size_t capacity);
+
+// ——————————————————————————————————————————————————————————————————————————————
+// Patient Lists
+// ——————————————————————————————————————————————————————————————————————————————
+// Make sure the list can hold at least `capacity` records.
+// returns 0 on success, error code otherwise
+int ReservePatients(PatientList* list, size_t capacity);
+
+// Append a copy of `p` to the list, growing it if needed.
+// returns 0 on success, error code otherwise
+int AppendPatient(PatientList* list, const Patient* p);
+
+// Release the memory held by the list and reset it to empty.
+void FreePatientList(PatientList* list);
+
+// A deleted patient is stored as an all-zero record; returns 1 for those slots.
+int IsEmptyPatient(const Patient* p);
+
+// ——————————————————————————————————————————————————————————————————————————————
+// Free Slots
+// ——————————————————————————————————————————————————————————————————————————————
+// Push/pop a free record position.
+// returns 0 on success, ERR_NOT_FOUND when popping an empty list
+int PushFreeSlot(FreeList* list, size_t slot);
+int PopFreeSlot(FreeList* list, size_t* slot);
+
+// Rebuild `dest` from the empty records found in `patients`.
 // returns 0 on success, error code otherwise
-int Hash(size_t* dest, const char* str);
+int BuildFreeList(FreeList* dest, const PatientList* patients);
+
+// Release the memory held by the list and reset it to empty.
+void FreeFreeList(FreeList* list);
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Index Management
 // ——————————————————————————————————————————————————————————————————————————————
-// Insert a new index entry.
-//   index:    pointer to Index array
+// Allocate an empty index with `capacity` buckets, releasing any previous one.
+// returns 0 on success, error code otherwise
+int InitIndex(Index* index, size_t capacity);
+
+// Rehash every live entry into a table of `capacity` buckets, dropping tombstones.
+// returns 0 on success, error code otherwise
+int ResizeIndex(Index* index, size_t capacity);
+
+// Release the memory held by the index and reset it to empty.
+void FreeIndex(Index* index);
+
+// Insert a new index entry, growing the table when it gets too full.
+//   index:    pointer to Index
 //   ci:       patient CI
 //   position: patient’s position in file/array
-// returns 0 on success, error code otherwise
+// returns 0 on success, ERR_DUPLICATE if `ci` is already indexed,
+// error code otherwise
 int NewPatientIndex(Index* index, const char* ci, size_t position);
 
-// Add, update or delete Patient in the in-memory array + index
+// Find the bucket holding `ci`, walking its collision chain past tombstones.
+//   slot: output pointer to the bucket position
+// returns 0 on success, ERR_NOT_FOUND if the CI is not indexed
+int FindPatientIndex(size_t* slot, const Index* index, const char* ci);
+
+// Remove `ci` from the index, leaving a tombstone so the rest of its
+// collision chain stays reachable.
+// returns 0 on success, error code otherwise
+int RemovePatientIndex(Index* index, const char* ci);
+
+// Add, update or delete Patient in the in-memory array + index.
+// AddPatient reuses a slot from `free_slots` when there is one and appends
+// otherwise; DeletePatient hands the emptied slot back to `free_slots`.
+// Either list may be NULL to always append / not track the slot.
+// AddPatient indexes the patient before writing the record, returning
+// ERR_DUPLICATE, with nothing written, if the CI is already indexed, and
+// removes the entry again if the record can't be written.
 int AddPatient(
+    const Database* db,
     size_t*    count,
     Index*     index,
+    FreeList*  free_slots,
     Patient*   new_patient
 );
 
 int UpdatePatient(
+    const Database* db,
     Index*     index,
     const char* ci,
     Patient*   updated_patient
 );
 
 int DeletePatient(
-    Patient*    patients,
+    const Database* db,
     Index*      index,
+    FreeList*   free_slots,
     const char* ci
 );
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Persistence
 // ——————————————————————————————————————————————————————————————————————————————
-// Save/load patients array to/from binary file
-int SavePatients(Patient patients[], size_t patientsCount);
-int LoadPatients(Patient* dest, size_t* dest_size);
+// Save/load patients array to/from binary file.
+// Saves go to a temporary file that is fsynced and renamed over the old one.
+// SavePatients keeps every record, empty ones included, at its array position
+// so an index built over the array stays valid.
+// Errors opening or reading the file return ERR_IO with errno left set.
+int SavePatients(const Database* db, Patient patients[], size_t patientsCount);
+int LoadPatients(const Database* db, PatientList* dest);
 
-// Save/load index to/from text file
-int SaveIndex(Index* index);
-int LoadIndex(Index* dest);
+// Number of records stored in the patients file
+int CountPatients(const Database* db, size_t* dest);
 
-// Sync both files in one call
-int SyncFiles(Patient patients[], size_t count, Index* index);
+// Read up to `limit` records starting at record `offset` of the patients file.
+//   read_count: number of records actually read (0 at end of file, or if
+//               there is no patients file yet)
+// returns 0 on success, error code otherwise
+int LoadPatientsPage(const Database* db, Patient* dest, size_t offset, size_t limit, size_t* read_count);
+
+// Like LoadPatientsPage, but a record failing its checksum doesn't stop the
+// read: it is returned as stored and its `status` entry is set to ERR_CHECKSUM
+// (0 for intact records). `status` must hold `limit` entries.
+int LoadPatientsPageChecked(const Database* db, Patient* dest, int* status, size_t offset, size_t limit, size_t* read_count);
+
+// Save/load index to/from text file.
+// The first line records the table capacity so it is restored without rehashing.
+// Like SavePatients, the save is fsynced and renamed into place.
+int SaveIndex(const Database* db, Index* index);
+int LoadIndex(const Database* db, Index* dest);
+
+// Sync both files in one call.
+// The records are sorted by CI and empty ones dropped, updating `count`, and
+// `index` is rebuilt from the order they are written in, so array, file and
+// index positions all agree. `index` is only replaced once the files are in
+// place.
+// Both are written to temporary files first and committed together, so after
+// a crash RecoverFiles leaves either both old or both new files in place.
+int SyncFiles(const Database* db, Patient patients[], size_t* count, Index* index);
+
+// Upgrade the patients file in place to the current on-disk format (see
+// patient_file.h), keeping every record at its position. Call before loading.
+//   from_version: output version the file had, PATIENT_FORMAT_VERSION if
+//                 it was already current or doesn't exist
+// returns 0 on success, error code otherwise
+int MigratePatientsFile(const Database* db, int* from_version);
+
+// Finish or discard a save interrupted by a crash. Call before loading.
+// returns 0 on success, error code otherwise
+int RecoverFiles(const Database* db);
+
+// Flush `file` all the way to disk and close it.
+// returns 0 on success, ERR_IO otherwise
+int FlushAndClose(FILE* file);
+
+// Make file creations and renames inside the database directory durable.
+// returns 0 on success, ERR_IO otherwise
+int SyncDataDir(const Database* db);
+
+// Rewrite the patients file without the empty slots left by deletions.
+// The new patients and index files are committed together like SyncFiles,
+// and `index` and `free_slots` are only replaced once they are in place.
+//   patients: loaded patients, compacted in place on success
+// returns 0 on success, error code otherwise
+int CompactPatients(const Database* db, PatientList* patients, Index* index, FreeList* free_slots);
 
 // ——————————————————————————————————————————————————————————————————————————————
 // Queries & Display
 // ——————————————————————————————————————————————————————————————————————————————
 // Retrieve a single Patient by CI via index
 int GetPatient(
+    const Database*     db,
     Patient*            p_dest,
     size_t*             i_dest,
-    Index         index,
+    const Index*        index,
     const char*         ci
 );
 
@@ -129,8 +303,8 @@ int  ShowPatients(const Patient* patients, size_t count);
 // ——————————————————————————————————————————————————————————————————————————————
 // Update a patient’s appointment date
 int ScheduleAppointment(
-    Patient*     patients,
-    Index  index,
+    const Database* db,
+    Index*       index,
     const char*  ci,
     const char*  date
 );
@@ -0,0 +1,140 @@
+#include <stdio.h>
+#include <string.h>
+#include "patient_file.h"
+#include "errors.h"
+
+_Static_assert(sizeof(((Patient*)0)->ci) + NAME_LEN + 4 + DIAG_LEN + 1 + 4 + SPEC_LEN +
+               sizeof(((Patient*)0)->appointment_date) == ENCODED_PATIENT_SIZE,
+               "ENCODED_PATIENT_SIZE out of date with the Patient fields");
+
+void PutU32(unsigned char* dest, uint32_t value) {
+    for (int i = 0; i < 4; i++) dest[i] = (unsigned char)(value >> (8 * i));
+}
+
+static void PutU64(unsigned char* dest, uint64_t value) {
+    for (int i = 0; i < 8; i++) dest[i] = (unsigned char)(value >> (8 * i));
+}
+
+uint32_t GetU32(const unsigned char* src) {
+    uint32_t value = 0;
+    for (int i = 0; i < 4; i++) value |= (uint32_t)src[i] << (8 * i);
+    return value;
+}
+
+static uint64_t GetU64(const unsigned char* src) {
+    uint64_t value = 0;
+    for (int i = 0; i < 8; i++) value |= (uint64_t)src[i] << (8 * i);
+    return value;
+}
+
+// Copy a string field, NUL-padding it to `len` bytes.
+static unsigned char* PutString(unsigned char* dest, const char* src, size_t len) {
+    size_t n = strnlen(src, len);
+    memcpy(dest, src, n);
+    memset(dest + n, 0, len - n);
+    return dest + len;
+}
+
+static const unsigned char* GetString(char* dest, const unsigned char* src, size_t len) {
+    memcpy(dest, src, len);
+    dest[len - 1] = '\0';
+    return src + len;
+}
+
+void EncodePatient(unsigned char* dest, const Patient* p) {
+    dest = PutString(dest, p->ci, sizeof(p->ci));
+    dest = PutString(dest, p->name, sizeof(p->name));
+    PutU32(dest, (uint32_t)p->age);
+    dest += 4;
+    dest = PutString(dest, p->diagnosis, sizeof(p->diagnosis));
+    *dest++ = (unsigned char)p->gender;
+    PutU32(dest, (uint32_t)p->disability);
+    dest += 4;
+    dest = PutString(dest, p->doc_specialty, sizeof(p->doc_specialty));
+    PutString(dest, p->appointment_date, sizeof(p->appointment_date));
+}
+
+void DecodePatient(Patient* dest, const unsigned char* src) {
+    memset(dest, 0, sizeof(Patient));
+    src = GetString(dest->ci, src, sizeof(dest->ci));
+    src = GetString(dest->name, src, sizeof(dest->name));
+    dest->age = (int32_t)GetU32(src);
+    src += 4;
+    src = GetString(dest->diagnosis, src, sizeof(dest->diagnosis));
+    dest->gender = (char)*src++;
+    dest->disability = (int32_t)GetU32(src);
+    src += 4;
+    src = GetString(dest->doc_specialty, src, sizeof(dest->doc_specialty));
+    GetString(dest->appointment_date, src, sizeof(dest->appointment_date));
+}
+
+uint32_t Crc32(const void* data, size_t len) {
+    const unsigned char* bytes = data;
+    uint32_t crc = 0xFFFFFFFFu;
+    for (size_t i = 0; i < len; i++) {
+        crc ^= bytes[i];
+        for (int bit = 0; bit < 8; bit++) {
+            crc = (crc >> 1) ^ (0xEDB88320u & (0u - (crc & 1u)));
+        }
+    }
+    return ~crc;
+}
+
+int ReadRawPatientHeader(FILE* file, PatientFileHeader* dest) {
+    if (file == NULL || dest == NULL) return ERR_NULL_PTR;
+    unsigned char buf[HEADER_SIZE];
+    if (fseek(file, 0, SEEK_SET) != 0) return ERR_IO;
+    if (fread(buf, HEADER_SIZE, 1, file) != 1) return ERR_FORMAT;
+    if (memcmp(buf, PATIENT_MAGIC, 4) != 0) return ERR_FORMAT;
+    if (GetU32(&buf[20]) != Crc32(buf, 20)) return ERR_FORMAT;
+    dest->version = GetU32(&buf[4]);
+    dest->record_size = GetU32(&buf[8]);
+    dest->record_count = GetU64(&buf[12]);
+    return 0;
+}
+
+int ReadPatientHeader(FILE* file, PatientFileHeader* dest) {
+    int error = ReadRawPatientHeader(file, dest);
+    if (error != 0) return error;
+    if (dest->version != PATIENT_FORMAT_VERSION) return ERR_VERSION;
+    if (dest->record_size != RECORD_SIZE) return ERR_FORMAT;
+    return 0;
+}
+
+int WritePatientHeader(FILE* file, size_t record_count) {
+    if (file == NULL) return ERR_NULL_PTR;
+    unsigned char buf[HEADER_SIZE];
+    memset(buf, 0, sizeof(buf));
+    memcpy(buf, PATIENT_MAGIC, 4);
+    PutU32(&buf[4], PATIENT_FORMAT_VERSION);
+    PutU32(&buf[8], (uint32_t)RECORD_SIZE);
+    PutU64(&buf[12], (uint64_t)record_count);
+    PutU32(&buf[20], Crc32(buf, 20));
+    if (fseek(file, 0, SEEK_SET) != 0) return ERR_IO;
+    if (fwrite(buf, HEADER_SIZE, 1, file) != 1) return ERR_IO;
+    return 0;
+}
+
+int SeekRecord(FILE* file, size_t position) {
+    if (file == NULL) return ERR_NULL_PTR;
+    if (fseek(file, (long)(HEADER_SIZE + position * RECORD_SIZE), SEEK_SET) != 0) return ERR_IO;
+    return 0;
+}
+
+int ReadRecord(FILE* file, Patient* dest) {
+    if (file == NULL || dest == NULL) return ERR_NULL_PTR;
+    unsigned char buf[RECORD_SIZE];
+    if (fread(buf, RECORD_SIZE, 1, file) != 1) return ERR_IO;
+    DecodePatient(dest, buf);
+    if (GetU32(&buf[ENCODED_PATIENT_SIZE]) != Crc32(buf, ENCODED_PATIENT_SIZE)) return ERR_CHECKSUM;
+    return 0;
+}
+
+int WriteRecord(FILE* file, const Patient* p) {
+    if (file == NULL || p == NULL) return ERR_NULL_PTR;
+    unsigned char buf[RECORD_SIZE];
+    EncodePatient(buf, p);
+    PutU32(&buf[ENCODED_PATIENT_SIZE], Crc32(buf, ENCODED_PATIENT_SIZE));
+    if (fwrite(buf, RECORD_SIZE, 1, file) != 1) return ERR_IO;
+    return 0;
+}
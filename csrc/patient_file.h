@@ -0,0 +1,84 @@
+#ifndef PATIENT_FILE_H
+#define PATIENT_FILE_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include "patient.h"
+
+// ——————————————————————————————————————————————————————————————————————————————
+// On-disk layout of PATIENT_FILE
+// ——————————————————————————————————————————————————————————————————————————————
+// HEADER_SIZE bytes of header followed by record_count records of RECORD_SIZE,
+// each an encoded Patient followed by the CRC-32 of its encoded bytes.
+// All integers are little-endian.
+// Header:
+//   0  magic         4 bytes, PATIENT_MAGIC
+//   4  version       u32
+//   8  record_size   u32
+//   12 record_count  u64
+//   20 checksum      u32, CRC-32 of bytes 0..19
+//   24 reserved      8 bytes, zero
+// Encoded Patient, fixed-width fields with no padding; strings are
+// NUL-padded to their full size:
+//   0   ci                9 bytes
+//   9   name              NAME_LEN bytes
+//   34  age               i32
+//   38  diagnosis         DIAG_LEN bytes
+//   88  gender            1 byte
+//   89  disability        i32
+//   93  doc_specialty     SPEC_LEN bytes
+//   143 appointment_date  11 bytes
+// Version history:
+//   0  no header, raw Patient structs
+//   1  header + raw Patient structs
+//   2  header + Patient structs with a CRC-32 each
+//   3  header + encoded Patients with a CRC-32 each
+#define PATIENT_MAGIC           "MDAP"
+#define PATIENT_FORMAT_VERSION  3
+#define HEADER_SIZE             32
+#define ENCODED_PATIENT_SIZE    154
+#define RECORD_CRC_SIZE         4
+#define RECORD_SIZE             (ENCODED_PATIENT_SIZE + RECORD_CRC_SIZE)
+
+typedef struct {
+    uint32_t version;
+    uint32_t record_size;
+    uint64_t record_count;
+} PatientFileHeader;
+
+// Convert a Patient to/from its ENCODED_PATIENT_SIZE bytes on disk.
+// DecodePatient always leaves the strings NUL-terminated.
+void EncodePatient(unsigned char* dest, const Patient* p);
+void DecodePatient(Patient* dest, const unsigned char* src);
+
+// CRC-32 (IEEE) of `len` bytes.
+uint32_t Crc32(const void* data, size_t len);
+
+// Store/load a little-endian u32.
+void PutU32(unsigned char* dest, uint32_t value);
+uint32_t GetU32(const unsigned char* src);
+
+// Read the header at the start of `file` and check its magic and checksum.
+// Unlike ReadPatientHeader the version and record size are not checked.
+// returns 0 on success, ERR_FORMAT if the file has no valid header
+int ReadRawPatientHeader(FILE* file, PatientFileHeader* dest);
+
+// Read and validate the header of a current-format file.
+// returns 0 on success, ERR_FORMAT or ERR_VERSION otherwise
+int ReadPatientHeader(FILE* file, PatientFileHeader* dest);
+
+// Write a current-format header at the start of `file`.
+// returns 0 on success, ERR_IO otherwise
+int WritePatientHeader(FILE* file, size_t record_count);
+
+// Position `file` at the record stored at `position`.
+int SeekRecord(FILE* file, size_t position);
+
+// Read/write one record and its checksum at the current file position.
+// ReadRecord still fills `dest` when the checksum doesn't match.
+// returns 0 on success, ERR_CHECKSUM for a corrupt record, ERR_IO otherwise
+int ReadRecord(FILE* file, Patient* dest);
+int WriteRecord(FILE* file, const Patient* p);
+
+#endif // PATIENT_FILE_H
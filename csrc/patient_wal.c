@@ -0,0 +1,91 @@
+#include <stdio.h>
+#include <string.h>
+#include "patient_wal.h"
+#include "patient_file.h"
+#include "errors.h"
+
+int AppendWal(const Database* db, int op, const Patient* patient) {
+    if (db == NULL || patient == NULL) return ERR_NULL_PTR;
+    if (op < WAL_ADD || op > WAL_DELETE) return ERR_INVALID_ARG;
+    unsigned char frame[WAL_FRAME_SIZE];
+    unsigned char* entry = &frame[4];
+    PutU32(frame, WAL_ENTRY_SIZE);
+    PutU32(entry, (uint32_t)op);
+    EncodePatient(&entry[4], patient);
+    PutU32(&entry[WAL_ENTRY_SIZE], Crc32(entry, WAL_ENTRY_SIZE));
+
+    FILE* file = fopen(db->wal_file, "ab");
+    if (file == NULL) return ERR_IO;
+    if (fwrite(frame, WAL_FRAME_SIZE, 1, file) != 1) {
+        fclose(file);
+        return ERR_IO;
+    }
+    return FlushAndClose(file);
+}
+
+// Apply a single logged mutation.
+static int ApplyWalEntry(const Database* db, const WalEntry* entry, size_t* count, Index* index, FreeList* free_slots) {
+    const char* ci = entry->patient.ci;
+    Patient current;
+    size_t slot;
+    int found = GetPatient(db, &current, &slot, index, ci);
+    if (found != 0 && found != ERR_NOT_FOUND) return found;
+
+    Patient patient = entry->patient;
+    switch (entry->op) {
+        case WAL_DELETE:
+            if (found == ERR_NOT_FOUND) return 0; // already gone
+            return DeletePatient(db, index, free_slots, ci);
+        case WAL_SCHEDULE:
+            if (found == ERR_NOT_FOUND) return 0; // deleted later on
+            strcpy(current.appointment_date, entry->patient.appointment_date);
+            return UpdatePatient(db, index, ci, &current);
+        case WAL_ADD:
+        case WAL_UPDATE:
+            if (found == 0) return UpdatePatient(db, index, ci, &patient);
+            return AddPatient(db, count, index, free_slots, &patient);
+        default:
+            return ERR_PARSE_LINE;
+    }
+}
+
+int ReplayWal(const Database* db, size_t* count, Index* index, FreeList* free_slots, size_t* replayed) {
+    if (db == NULL || count == NULL || index == NULL || replayed == NULL) return ERR_NULL_PTR;
+    *replayed = 0;
+    FILE* file = fopen(db->wal_file, "rb");
+    if (file == NULL) return 0; // nothing logged since the last checkpoint
+
+    unsigned char frame[WAL_FRAME_SIZE];
+    while (fread(frame, WAL_FRAME_SIZE, 1, file) == 1) {
+        const unsigned char* bytes = &frame[4];
+        if (GetU32(frame) != WAL_ENTRY_SIZE) break;
+        if (GetU32(&bytes[WAL_ENTRY_SIZE]) != Crc32(bytes, WAL_ENTRY_SIZE)) break;
+        WalEntry entry;
+        entry.op = (int)GetU32(bytes);
+        DecodePatient(&entry.patient, &bytes[4]);
+        int error = ApplyWalEntry(db, &entry, count, index, free_slots);
+        if (error != 0) {
+            fclose(file);
+            return error;
+        }
+        (*replayed)++;
+    }
+    if (ferror(file)) {
+        fclose(file);
+        return ERR_IO;
+    }
+    fclose(file);
+    return 0;
+}
+
+int CheckpointWal(const Database* db, PatientList* patients, Index* index, FreeList* free_slots) {
+    int error = CompactPatients(db, patients, index, free_slots);
+    if (error != 0) return error;
+    if (remove(db->wal_file) != 0) {
+        FILE* file = fopen(db->wal_file, "rb");
+        if (file == NULL) return 0; // there was no log to clear
+        fclose(file);
+        return ERR_IO;
+    }
+    return SyncDataDir(db);
+}
@@ -0,0 +1,56 @@
+#ifndef PATIENT_WAL_H
+#define PATIENT_WAL_H
+
+#include <stddef.h>
+#include "patient.h"
+#include "patient_file.h"
+
+// Append-only journal of patient mutations. Every change is logged and
+// fsynced to the database's WAL_FILE before it touches the patients file,
+// replayed on startup and cleared once both data files have been saved
+// (a checkpoint).
+// Each entry is written as a frame of little-endian fields, with the patient
+// encoded like the records of PATIENT_FILE so the log doesn't depend on the
+// struct layout of the build that wrote it:
+//   0    length    u32, WAL_ENTRY_SIZE
+//   4    op        u32, one of WalOp
+//   8    patient   ENCODED_PATIENT_SIZE bytes
+//   162  checksum  u32, CRC-32 of the op and patient bytes
+// so a torn or damaged entry is recognized.
+
+typedef enum {
+    WAL_ADD = 1,                   // patient: the new record
+    WAL_UPDATE = 2,                // patient: the updated record
+    WAL_SCHEDULE = 3,              // patient: ci and appointment_date
+    WAL_DELETE = 4                 // patient: ci
+} WalOp;
+
+// A decoded entry
+typedef struct {
+    int     op;                    // one of WalOp
+    Patient patient;
+} WalEntry;
+
+#define WAL_ENTRY_SIZE (4 + ENCODED_PATIENT_SIZE)
+#define WAL_FRAME_SIZE (4 + WAL_ENTRY_SIZE + 4)
+
+// Log a mutation and flush it to disk before it is applied.
+// returns 0 on success, error code otherwise
+int AppendWal(const Database* db, int op, const Patient* patient);
+
+// Re-apply every logged mutation to the patients file and index.
+// Entries are applied as upserts/idempotent deletes, so replaying changes
+// that already reached the files is harmless. Replay stops at the first entry
+// that is torn or fails its checksum, ignoring it and everything after it;
+// checkpoint afterwards so later appends don't land behind it.
+//   count:    number of records in the patients file, updated on appends
+//   replayed: output number of entries applied
+// returns 0 on success, error code otherwise
+int ReplayWal(const Database* db, size_t* count, Index* index, FreeList* free_slots, size_t* replayed);
+
+// Save both data files and clear the log. The patients file is compacted
+// on the way so the saved index matches the written positions.
+// returns 0 on success, error code otherwise
+int CheckpointWal(const Database* db, PatientList* patients, Index* index, FreeList* free_slots);
+
+#endif // PATIENT_WAL_H
@@ -6,3 +6,5 @@ var SelectedStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.Color("229")).
 	Background(lipgloss.Color("57")).
 	Bold(true)
+
+var ErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
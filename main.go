@@ -1,24 +1,30 @@
 package main
 
 import (
+	"context"
 	"ffi-test/global"
+	"ffi-test/src/api"
+	"ffi-test/src/models"
+	"ffi-test/src/rpc"
 	"ffi-test/src/utils"
 	"ffi-test/src/views"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	// patientsService := src.NewPatientService()
-	// err := patientsService.Run()
-	// if err != nil {
-	// 	fmt.Printf("Error running patient service: %v\n", err)
-	// 	return
-	// }
-
 	// a menu entry for realize operations on patients
 	// 1. Consult a specific patient by CI
 	// 2. Add a new patient
@@ -28,24 +34,368 @@ func main() {
 	// 6. Lists, a menu entry for listing with a sub menu entry for each signature in src/metrics.go
 	// 7. See indexes
 
-	Run()
+	// The data directory comes from --data-dir, then $MEDAPPOINT_DATA_DIR,
+	// then ./data
+	defaultDir := os.Getenv(dataDirEnv)
+	if defaultDir == "" {
+		defaultDir = "data"
+	}
+	dataDir := flag.String("data-dir", defaultDir, "directory holding the patient data files (env "+dataDirEnv+")")
+	defaultStore := os.Getenv(storeEnv)
+	if defaultStore == "" {
+		defaultStore = models.DefaultBackend()
+	}
+	backend := flag.String("store", defaultStore, fmt.Sprintf("storage backend, one of %v (env %s)", models.Backends(), storeEnv))
+	verbose := flag.Bool("verbose", false, "report index rebuilds and file migrations on stderr")
+	flag.Usage = usage
+	flag.Parse()
+	if *verbose {
+		models.Notes = os.Stderr
+	}
+
+	if flag.Arg(0) == "migrate-sqlite" {
+		os.Exit(MigrateSQLite(*dataDir, *backend))
+	}
+
+	service, err := models.NewPatientStore(*backend, *dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open the patient store: %v\n", err)
+		os.Exit(1)
+	}
+	defer service.Close()
+	openErr := service.Open()
+
+	if _, ok := commands[flag.Arg(0)]; ok {
+		code := RunCommand(service, openErr, flag.Arg(0), flag.Args()[1:], os.Stdout, os.Stderr)
+		service.Close()
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "verify" {
+		code := Verify(service, openErr)
+		service.Close()
+		os.Exit(code)
+	}
+	if openErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load patients: %v\nRun with \"verify\" to find the damaged records.\n", openErr)
+		service.Close()
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == "import-dat" {
+		code := ImportDat(service, flag.Args()[1:])
+		service.Close()
+		os.Exit(code)
+	}
+
+	if flag.Arg(0) == "serve" {
+		code := Serve(service, flag.Args()[1:])
+		service.Close()
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "serve-grpc" {
+		code := ServeGRPC(service, flag.Args()[1:])
+		service.Close()
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "import-csv" {
+		code := ImportCSV(service, flag.Args()[1:])
+		service.Close()
+		os.Exit(code)
+	}
+
+	Run(service)
+}
+
+// usage lists the flags and the subcommands. Without a subcommand the
+// terminal UI starts.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands, printing JSON:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nOther commands:")
+	fmt.Fprintln(out, "  verify")
+	fmt.Fprintln(out, "  import-dat [--dry-run] [FILE]")
+	fmt.Fprintln(out, "  import-csv [--dry-run] [--on-conflict skip|overwrite|fail] FILE")
+	fmt.Fprintln(out, "  migrate-sqlite")
+	fmt.Fprintln(out, "  serve [--addr ADDR]")
+	fmt.Fprintln(out, "  serve-grpc [--addr ADDR]")
+}
+
+// Environment variables standing in for --data-dir and --store.
+const (
+	dataDirEnv = "MEDAPPOINT_DATA_DIR"
+	storeEnv   = "MEDAPPOINT_STORE"
+)
+
+// Verify prints the integrity report for the data files and returns the
+// process exit code: 1 if any problem was found.
+func Verify(service models.PatientStore, openErr error) int {
+	if openErr != nil {
+		fmt.Printf("Patients could not be loaded: %v\n", openErr)
+	}
+	report, err := service.Verify()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying data: %v\n", err)
+		return 2
+	}
+	fmt.Print(report)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// ImportDat runs `import-dat [--dry-run] [FILE]`, adding the patients of a
+// patients.dat file, by default the one in the data directory, to the store.
+// It returns the process exit code: 1 if any line was rejected, 2 if nothing
+// could be imported.
+func ImportDat(service models.PatientStore, args []string) int {
+	flags := flag.NewFlagSet("import-dat", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check the lines and report what would be imported, without importing")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-dat [--dry-run] [FILE]")
+		return 2
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		path = filepath.Join(service.DataDir(), "patients.dat")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open %s: %v\n", path, err)
+		return 2
+	}
+	defer file.Close()
+
+	report, err := models.ImportPatientsDat(service, file, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing %s: %v\n", path, err)
+		return 2
+	}
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, lineErr)
+	}
+	if *dryRun {
+		fmt.Printf("Dry run, nothing imported: %d patients to add, %d lines rejected.\n", report.Added, len(report.Errors))
+	} else {
+		fmt.Printf("Imported %d patients, %d lines rejected.\n", report.Added, len(report.Errors))
+	}
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ImportCSV runs `import-csv [--dry-run] [--on-conflict POLICY] FILE` and
+// returns the process exit code: 1 if any row was rejected, in which case
+// nothing was imported, 2 if the file could not be imported at all.
+func ImportCSV(service models.PatientStore, args []string) int {
+	flags := flag.NewFlagSet("import-csv", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check the rows and report what would be imported, without importing")
+	onConflict := flags.String("on-conflict", string(models.ConflictFail), "what to do with patients already stored: skip, overwrite or fail")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-csv [--dry-run] [--on-conflict skip|overwrite|fail] FILE")
+		return 2
+	}
+	policy, err := models.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	path := flags.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open %s: %v\n", path, err)
+		return 2
+	}
+	defer file.Close()
+
+	report, err := models.ImportPatientsCSV(service, file, models.CSVImportOptions{DryRun: *dryRun, OnConflict: policy})
+	if report == nil {
+		fmt.Fprintf(os.Stderr, "Error importing %s: %v\n", path, err)
+		return 2
+	}
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, lineErr)
+	}
+	summary := fmt.Sprintf("%d added, %d updated, %d skipped, %d rows rejected", report.Added, report.Updated, report.Skipped, len(report.Errors))
+	switch {
+	case *dryRun:
+		fmt.Printf("Dry run, nothing imported: %s.\n", summary)
+	case err != nil:
+		fmt.Printf("Nothing imported, %d rows rejected.\n", len(report.Errors))
+	default:
+		fmt.Printf("Imported: %s.\n", summary)
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// Serve runs `serve [--addr ADDR]`, the HTTP API, until interrupted, then
+// saves the store. It returns the process exit code.
+func Serve(service models.PatientStore, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: *addr, Handler: api.NewHandler(service)}
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "Serving the patient API on %s\n", *addr)
+
+	code := 0
+	select {
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "Error serving the patient API: %v\n", err)
+		code = 1
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error stopping the patient API: %v\n", err)
+			code = 1
+		}
+	}
+	if err := service.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving patients: %v\n", err)
+		return 1
+	}
+	return code
+}
+
+// ServeGRPC runs `serve-grpc [--addr ADDR]`, the gRPC service, until
+// interrupted, then saves the store. It returns the process exit code.
+func ServeGRPC(service models.PatientStore, args []string) int {
+	flags := flag.NewFlagSet("serve-grpc", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:9090", "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving the patient gRPC service: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := grpc.NewServer()
+	rpc.Register(server, service)
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	fmt.Fprintf(os.Stderr, "Serving the patient gRPC service on %s\n", listener.Addr())
+
+	code := 0
+	select {
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "Error serving the patient gRPC service: %v\n", err)
+		code = 1
+	case <-ctx.Done():
+		server.GracefulStop()
+	}
+	if err := service.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving patients: %v\n", err)
+		return 1
+	}
+	return code
+}
+
+// MigrateSQLite copies the patients and appointment history of the
+// patients.bin/index.dat database in dataDir into the SQLite database next to
+// it, replacing whatever it held, and returns the process exit code. The files are read with
+// `backend`, or the default file backend if that is sqlite itself, so an
+// interrupted save, old format or pending log is dealt with first. Nothing is
+// copied if they fail verification.
+func MigrateSQLite(dataDir string, backend string) int {
+	if backend == "sqlite" {
+		backend = models.DefaultBackend()
+	}
+	src, err := models.NewPatientStore(backend, dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open the patient files: %v\n", err)
+		return 1
+	}
+	defer src.Close()
+	if err := src.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load patients: %v\nRun with \"verify\" to find the damaged records.\n", err)
+		return 1
+	}
+	report, err := src.Verify()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying data: %v\n", err)
+		return 1
+	}
+	if !report.OK() {
+		fmt.Fprintf(os.Stderr, "The patient files have problems, nothing was migrated:\n%s", report)
+		return 1
+	}
+
+	dst, err := models.NewPatientStore("sqlite", dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open the SQLite database: %v\n", err)
+		return 1
+	}
+	defer dst.Close()
+	if err := dst.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open the SQLite database: %v\n", err)
+		return 1
+	}
+	mirror, ok := dst.(models.StoreMirror)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "The SQLite backend can't be migrated to in this build.")
+		return 1
+	}
+	patients, appointments, err := mirror.MirrorFrom(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating patients: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Migrated %d patients and %d appointments to the SQLite database in %s.\n", patients, appointments, dataDir)
+	return 0
 }
 
 type Model struct {
+	service views.PatientService
 	choices []string
 	cursor  int
 	help    tea.Model
+	err     error // from saving on the way out
 	views.BaseModel
 }
 
-func NewModel() Model {
+func NewModel(service views.PatientService) Model {
 	return Model{
+		service: service,
 		choices: []string{
 			"List Patients",
 			"Search Patient",
 			"Add Patient",
 			"Update Patient",
 			"Delete Patient",
+			"Verify Data",
 			"Exit",
 		},
 		cursor:    0,
@@ -84,8 +434,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "enter":
 			return m.handleSelection()
 		case "ctrl+c", "q":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			return m.saveAndQuit()
 		}
 	}
 	return m, nil
@@ -103,6 +452,9 @@ func (m Model) View() string {
 		}
 		menuStr += row + "\n"
 	}
+	if m.err != nil {
+		menuStr += "\n" + global.ErrorStyle.Render(m.err.Error()) + "\n"
+	}
 
 	// Add help view
 	helpStr := m.help.View()
@@ -116,33 +468,41 @@ func (m Model) View() string {
 func (m *Model) handleSelection() (tea.Model, tea.Cmd) {
 	switch m.cursor {
 	case 0:
-		listM := views.NewListMenuModel(m, m.BaseModel)
+		listM := views.NewListMenuModel(m.service, m, m.BaseModel)
 		return listM, listM.Init()
 	case 1:
-		searchM := views.NewSearchModel(m, m.BaseModel)
+		searchM := views.NewSearchModel(m.service, m, m.BaseModel)
 		return searchM, searchM.Init()
 	case 2:
-		addM := views.NewAddModel(m, m.BaseModel)
+		addM := views.NewAddModel(m.service, m, m.BaseModel)
 		return addM, addM.Init()
 	case 3:
-		updateM := views.NewUpdateModel(m, m.BaseModel)
+		updateM := views.NewUpdateModel(m.service, m, m.BaseModel)
 		return updateM, updateM.Init()
 	case 4:
-		deleteM := views.NewDeleteModel(m, m.BaseModel)
+		deleteM := views.NewDeleteModel(m.service, m, m.BaseModel)
 		return deleteM, deleteM.Init()
 	case 5:
-		global.PatientsService.Save()
-		return m, tea.Quit
+		verifyM := views.NewVerifyModel(m.service, m, m.BaseModel)
+		return verifyM, verifyM.Init()
+	case 6:
+		return m.saveAndQuit()
 	}
 	return m, nil
 }
 
-func Run() {
-	p := tea.NewProgram(NewModel())
+func (m Model) saveAndQuit() (tea.Model, tea.Cmd) {
+	cmd, err := views.SaveAndQuit(m.service)
+	m.err = err
+	return m, cmd
+}
+
+func Run(service models.PatientStore) {
+	p := tea.NewProgram(NewModel(service))
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting program: %v\n", err)
 		os.Exit(1)
 	}
 
-	// global.PatientsService.ListPatients()
+	// service.ListPatients()
 }
@@ -0,0 +1,283 @@
+// Package api serves the patient store over HTTP as JSON.
+//
+//	GET    /patients                          all patients, or one List filter:
+//	                                          ?disabled=true, ?gender=F|M,
+//	                                          ?date=YYYY-MM-DD, ?specialty=NAME,
+//	                                          ?under_age=N
+//	GET    /patients/stats                    counts over all patients
+//	GET    /patients/{ci}                     one patient
+//	POST   /patients/{ci}                     add a patient
+//	PUT    /patients/{ci}                     replace a patient's data
+//	DELETE /patients/{ci}                     remove a patient
+//	POST   /patients/{ci}/appointments        schedule {"date": "YYYY-MM-DD",
+//	                                          "time": "HH:MM"}, optionally with
+//	                                          "duration" in minutes and
+//	                                          "specialty"
+//
+// Errors come back as {"error": {...}} with the csrc/errors.h code behind
+// them, see ErrorBody.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"ffi-test/src/models"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxBodySize bounds request bodies; a patient is well under 1 KiB.
+const maxBodySize = 64 << 10
+
+// ErrorBody is the JSON of a failed request. Code and Name are the
+// csrc/errors.h code behind the error, when there is one, and Field the
+// patient field a validation error rejects.
+type ErrorBody struct {
+	Message string `json:"message"`
+	Code    int    `json:"code,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+// badRequest is a request the handlers reject before reaching the store.
+type badRequest struct {
+	msg string
+}
+
+func (e *badRequest) Error() string { return e.msg }
+
+type server struct {
+	store models.PatientStore
+}
+
+// NewHandler returns the HTTP handler for store. Changes go through the
+// store's own logging; saving it is left to the caller.
+func NewHandler(store models.PatientStore) http.Handler {
+	s := &server{store: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /patients", s.listPatients)
+	mux.HandleFunc("GET /patients/stats", s.stats)
+	mux.HandleFunc("GET /patients/{ci}", s.getPatient)
+	mux.HandleFunc("POST /patients/{ci}", s.addPatient)
+	mux.HandleFunc("PUT /patients/{ci}", s.updatePatient)
+	mux.HandleFunc("DELETE /patients/{ci}", s.deletePatient)
+	mux.HandleFunc("POST /patients/{ci}/appointments", s.scheduleAppointment)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps err to its status: 400 for malformed requests, 422 for
+// fields NewPatient rejects, 404 and 409 for unknown and duplicate CIs, 409
+// for slots that can't be booked, and 500 for the rest.
+func writeError(w http.ResponseWriter, err error) {
+	body := ErrorBody{Message: err.Error()}
+	if code := models.ErrorCode(err); code != 0 {
+		body.Code = code
+		body.Name = models.CodeName(code)
+	}
+	var validation *models.ValidationError
+	if errors.As(err, &validation) {
+		body.Field = validation.Field
+	}
+
+	var bad *badRequest
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &bad):
+		status = http.StatusBadRequest
+	case errors.Is(err, models.ErrValidation):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrDuplicate), errors.Is(err, models.ErrBooking):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, map[string]ErrorBody{"error": body})
+}
+
+// readJSON decodes the request body into v, refusing unknown fields.
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var validation *models.ValidationError
+		if errors.As(err, &validation) {
+			return err
+		}
+		return &badRequest{msg: "invalid JSON body: " + err.Error()}
+	}
+	return nil
+}
+
+// readPatient decodes the patient in the body. Its CI may be left out, but
+// must match the path if given.
+func readPatient(r *http.Request) (models.Patient, error) {
+	var p models.Patient
+	if err := readJSON(r, &p); err != nil {
+		return p, err
+	}
+	ci := r.PathValue("ci")
+	if p.ID != "" && p.ID != ci {
+		return p, &badRequest{msg: fmt.Sprintf("body CI %q does not match the path CI %q", p.ID, ci)}
+	}
+	p.ID = ci
+	return p, nil
+}
+
+// respondPatient writes the patient as the store kept it.
+func (s *server) respondPatient(w http.ResponseWriter, status int, ci string) {
+	response, err := s.store.GetPatient(ci)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, response.Patient)
+}
+
+func (s *server) getPatient(w http.ResponseWriter, r *http.Request) {
+	s.respondPatient(w, http.StatusOK, r.PathValue("ci"))
+}
+
+func (s *server) addPatient(w http.ResponseWriter, r *http.Request) {
+	p, err := readPatient(r)
+	if err == nil {
+		err = s.store.AddPatient(p)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/patients/"+p.ID)
+	s.respondPatient(w, http.StatusCreated, p.ID)
+}
+
+func (s *server) updatePatient(w http.ResponseWriter, r *http.Request) {
+	p, err := readPatient(r)
+	if err == nil {
+		err = s.store.UpdatePatient(p)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.respondPatient(w, http.StatusOK, p.ID)
+}
+
+func (s *server) deletePatient(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeletePatient(r.PathValue("ci")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type appointmentRequest struct {
+	Date      string `json:"date"`
+	Time      string `json:"time"`
+	Duration  int    `json:"duration"`
+	Specialty string `json:"specialty"`
+}
+
+// scheduleAppointment books the slot and responds with the appointment.
+func (s *server) scheduleAppointment(w http.ResponseWriter, r *http.Request) {
+	var req appointmentRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	appointment, err := s.store.ScheduleAppointment(models.Appointment{
+		CI:        r.PathValue("ci"),
+		Date:      req.Date,
+		Time:      req.Time,
+		Duration:  req.Duration,
+		Specialty: req.Specialty,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, appointment)
+}
+
+// listFilters are the query parameters of GET /patients, each running one of
+// the List methods.
+var listFilters = map[string]func(store models.PatientStore, value string) ([]models.Patient, error){
+	"disabled": func(store models.PatientStore, value string) ([]models.Patient, error) {
+		if value != "true" {
+			return nil, &badRequest{msg: `disabled only takes "true"`}
+		}
+		return store.ListDisabledPatients()
+	},
+	"gender": func(store models.PatientStore, value string) ([]models.Patient, error) {
+		switch value {
+		case "F":
+			return store.ListFemalePatients()
+		case "M":
+			return store.ListMalePatients()
+		}
+		return nil, &badRequest{msg: `gender must be "F" or "M"`}
+	},
+	"date": func(store models.PatientStore, value string) ([]models.Patient, error) {
+		if err := models.ValidateAppointmentDate(value); err != nil {
+			return nil, err
+		}
+		return store.ListPatientsByAppointmentDate(value)
+	},
+	"specialty": func(store models.PatientStore, value string) ([]models.Patient, error) {
+		return store.ListPatientsBySpecialty(value)
+	},
+	"under_age": func(store models.PatientStore, value string) ([]models.Patient, error) {
+		age, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &badRequest{msg: fmt.Sprintf("invalid under_age %q", value)}
+		}
+		return store.ListPatientsUnderAge(age)
+	},
+}
+
+func (s *server) listPatients(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if len(query) > 1 {
+		writeError(w, &badRequest{msg: "only one filter can be used at a time"})
+		return
+	}
+
+	list := func(store models.PatientStore, _ string) ([]models.Patient, error) {
+		return store.ListPatients()
+	}
+	var value string
+	for name := range query {
+		filter, ok := listFilters[name]
+		if !ok {
+			writeError(w, &badRequest{msg: fmt.Sprintf("unknown filter %q", name)})
+			return
+		}
+		list, value = filter, query.Get(name)
+	}
+
+	patients, err := list(s.store, value)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if patients == nil {
+		patients = []models.Patient{}
+	}
+	writeJSON(w, http.StatusOK, patients)
+}
+
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	patients, err := s.store.ListPatients()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ComputeStats(patients))
+}
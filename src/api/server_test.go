@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"ffi-test/src/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	aliceJSON = `{"ci": "12345678", "name": "Alice Johnson", "age": 34, "diagnosis": "Hypertension", "gender": "F", "disability": false, "doc_specialty": "Cardiology", "appointment_date": "2024-02-15"}`
+	bobJSON   = `{"name": "Bob Smith", "age": 47, "diagnosis": "Diabetes", "gender": "M", "disability": true, "doc_specialty": "Endocrinology", "appointment_date": "2024-03-10"}`
+	carlaJSON = `{"name": "Carla Gomez", "age": 9, "diagnosis": "Asthma", "gender": "F", "disability": false, "doc_specialty": "Pulmonology", "appointment_date": "2024-02-15"}`
+)
+
+// newTestHandler serves a Go store in a fresh directory holding Alice, Bob
+// and Carla.
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	store, err := models.NewPatientStore("go", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	h := NewHandler(store)
+	for ci, body := range map[string]string{"12345678": aliceJSON, "87654321": bobJSON, "11223344": carlaJSON} {
+		if rec := do(h, "POST", "/patients/"+ci, body); rec.Code != http.StatusCreated {
+			t.Fatalf("add %s = %d %s", ci, rec.Code, rec.Body)
+		}
+	}
+	return h
+}
+
+func do(h http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// errorOf decodes the error body of rec.
+func errorOf(t *testing.T, rec *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+	var body map[string]ErrorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", rec.Body, err)
+	}
+	return body["error"]
+}
+
+// withField returns aliceJSON under a new CI with field set to value, given
+// as JSON.
+func withField(field string, value string) string {
+	var fields map[string]json.RawMessage
+	json.Unmarshal([]byte(aliceJSON), &fields)
+	fields["ci"] = json.RawMessage(`"55555555"`)
+	fields[field] = json.RawMessage(value)
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
+
+func TestPatientValidation(t *testing.T) {
+	h := newTestHandler(t)
+	long := `"` + strings.Repeat("x", 80) + `"`
+	tests := []struct {
+		body  string
+		name  string // of the code in the error body
+		field string
+	}{
+		{withField("name", `""`), "ERR_FIELD_NAME_NULL", "Name"},
+		{withField("name", long), "ERR_FIELD_NAME_TOO_LONG", "Name"},
+		{withField("age", `-1`), "ERR_FIELD_AGE_INVALID", "Age"},
+		{withField("gender", `"X"`), "ERR_FIELD_GENDER_INVALID", "Gender"},
+		{withField("gender", `"FM"`), "ERR_FIELD_GENDER_INVALID", "Gender"},
+		{withField("diagnosis", `""`), "ERR_FIELD_DIAGNOSIS_NULL", "Diagnosis"},
+		{withField("diagnosis", long), "ERR_FIELD_DIAGNOSIS_TOO_LONG", "Diagnosis"},
+		{withField("doc_specialty", `""`), "ERR_FIELD_SPECIALTY_NULL", "DocSpecialty"},
+		{withField("doc_specialty", long), "ERR_FIELD_SPECIALTY_TOO_LONG", "DocSpecialty"},
+		{withField("appointment_date", `"2024/2/1"`), "ERR_FIELD_APPOINTMENT_DATE_FORMAT", "AppointmentDate"},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{"POST", "PUT"} {
+			path := "/patients/55555555"
+			if method == "PUT" {
+				path = "/patients/12345678"
+				tt.body = strings.Replace(tt.body, "55555555", "12345678", 1)
+			}
+			rec := do(h, method, path, tt.body)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%s %s = %d, want 422", method, tt.name, rec.Code)
+				continue
+			}
+			if body := errorOf(t, rec); body.Name != tt.name || body.Field != tt.field || body.Code == 0 {
+				t.Errorf("%s %s: error %+v, want field %s", method, tt.name, body, tt.field)
+			}
+		}
+	}
+
+	rec := do(h, "POST", "/patients/1234", strings.Replace(aliceJSON, "12345678", "1234", 1))
+	if body := errorOf(t, rec); rec.Code != http.StatusUnprocessableEntity || body.Name != "ERR_FIELD_CI_FORMAT" {
+		t.Errorf("short CI = %d %+v, want 422 ERR_FIELD_CI_FORMAT", rec.Code, body)
+	}
+	if rec := do(h, "GET", "/patients/55555555", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("a rejected patient was stored: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	h := newTestHandler(t)
+	tests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/patients/55555555", `{"name": `},
+		{"POST", "/patients/55555555", `{"nickname": "Al"}`},
+		{"POST", "/patients/55555555", aliceJSON}, // CI differs from the path
+		{"PUT", "/patients/12345678", `[]`},
+		{"POST", "/patients/12345678/appointments", `{"date": "2024-05-02", "room": 4}`},
+		{"GET", "/patients?color=red", ""},
+		{"GET", "/patients?gender=F&disabled=true", ""},
+		{"GET", "/patients?disabled=yes", ""},
+		{"GET", "/patients?gender=X", ""},
+		{"GET", "/patients?under_age=ten", ""},
+	}
+	for _, tt := range tests {
+		rec := do(h, tt.method, tt.path, tt.body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s = %d %s, want 400", tt.method, tt.path, tt.body, rec.Code, rec.Body)
+			continue
+		}
+		if body := errorOf(t, rec); body.Message == "" {
+			t.Errorf("%s %s: error without a message", tt.method, tt.path)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/patients/99999999", ""},
+		{"PUT", "/patients/99999999", bobJSON},
+		{"DELETE", "/patients/99999999", ""},
+		{"POST", "/patients/99999999/appointments", `{"date": "2024-05-02", "time": "09:00"}`},
+	} {
+		rec := do(h, tt.method, tt.path, tt.body)
+		if body := errorOf(t, rec); rec.Code != http.StatusNotFound || body.Name != "ERR_NOT_FOUND" {
+			t.Errorf("%s %s = %d %+v, want 404 ERR_NOT_FOUND", tt.method, tt.path, rec.Code, body)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	h := newTestHandler(t)
+	rec := do(h, "POST", "/patients/12345678", aliceJSON)
+	if body := errorOf(t, rec); rec.Code != http.StatusConflict || body.Name != "ERR_DUPLICATE" {
+		t.Errorf("adding a duplicate = %d %+v, want 409 ERR_DUPLICATE", rec.Code, body)
+	}
+
+	booking := `{"date": "2024-05-02", "time": "09:00", "specialty": "Cardiology"}`
+	if rec := do(h, "POST", "/patients/12345678/appointments", booking); rec.Code != http.StatusCreated {
+		t.Fatalf("booking = %d %s", rec.Code, rec.Body)
+	}
+	for _, tt := range []struct {
+		ci, body, name string
+	}{
+		// Alice is already busy then
+		{"12345678", `{"date": "2024-05-02", "time": "09:15", "specialty": "Dermatology"}`, "ERR_APPOINTMENT_CONFLICT"},
+		// and Cardiology has a single place per slot
+		{"87654321", booking, "ERR_SLOT_FULL"},
+	} {
+		rec := do(h, "POST", "/patients/"+tt.ci+"/appointments", tt.body)
+		if body := errorOf(t, rec); rec.Code != http.StatusConflict || body.Name != tt.name {
+			t.Errorf("booking %s = %d %+v, want 409 %s", tt.body, rec.Code, body, tt.name)
+		}
+	}
+}
+
+func TestAppointmentValidation(t *testing.T) {
+	h := newTestHandler(t)
+	for _, tt := range []struct{ body, name string }{
+		{`{"date": "2024-02-30", "time": "09:00"}`, "ERR_FIELD_APPOINTMENT_DATE_FORMAT"},
+		{`{"date": "2024-05-02"}`, "ERR_FIELD_APPOINTMENT_TIME_FORMAT"},
+		{`{"date": "2024-05-02", "time": "9am"}`, "ERR_FIELD_APPOINTMENT_TIME_FORMAT"},
+		{`{"date": "2024-05-02", "time": "23:50", "duration": 30}`, "ERR_FIELD_APPOINTMENT_DURATION_INVALID"},
+	} {
+		rec := do(h, "POST", "/patients/12345678/appointments", tt.body)
+		if body := errorOf(t, rec); rec.Code != http.StatusUnprocessableEntity || body.Name != tt.name {
+			t.Errorf("booking %s = %d %+v, want 422 %s", tt.body, rec.Code, body, tt.name)
+		}
+	}
+}
+
+func TestPatientLifecycle(t *testing.T) {
+	h := newTestHandler(t)
+	rec := do(h, "PUT", "/patients/12345678", strings.Replace(aliceJSON, `"age": 34`, `"age": 35`, 1))
+	var p models.Patient
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); rec.Code != http.StatusOK || err != nil || p.Age != 35 {
+		t.Errorf("update = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do(h, "POST", "/patients/12345678/appointments", `{"date": "2024-05-02", "time": "09:00"}`)
+	var a models.Appointment
+	if err := json.Unmarshal(rec.Body.Bytes(), &a); rec.Code != http.StatusCreated || err != nil || a.ID == 0 || a.Specialty != "Cardiology" {
+		t.Errorf("schedule = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(h, "GET", "/patients/12345678", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); rec.Code != http.StatusOK || err != nil || p.AppointmentDate != "2024-05-02" {
+		t.Errorf("get after scheduling = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(h, "DELETE", "/patients/12345678", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(h, "GET", "/patients/12345678", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete = %d", rec.Code)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	h := newTestHandler(t)
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"11223344", "12345678", "87654321"}},
+		{"?disabled=true", []string{"87654321"}},
+		{"?gender=F", []string{"11223344", "12345678"}},
+		{"?gender=M", []string{"87654321"}},
+		{"?date=2024-02-15", []string{"11223344", "12345678"}},
+		{"?specialty=Endocrinology", []string{"87654321"}},
+		{"?specialty=Neurology", []string{}},
+		{"?under_age=18", []string{"11223344"}},
+	} {
+		rec := do(h, "GET", "/patients"+tt.query, "")
+		var patients []models.Patient
+		if err := json.Unmarshal(rec.Body.Bytes(), &patients); rec.Code != http.StatusOK || err != nil || patients == nil {
+			t.Errorf("list %s = %d %s", tt.query, rec.Code, rec.Body)
+			continue
+		}
+		got := []string{}
+		for _, p := range patients {
+			got = append(got, p.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("list %s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	rec := do(h, "GET", "/patients?date=2024-13-01", "")
+	if body := errorOf(t, rec); rec.Code != http.StatusUnprocessableEntity || body.Field != "AppointmentDate" {
+		t.Errorf("list by a bad date = %d %+v, want 422", rec.Code, body)
+	}
+}
+
+func TestStats(t *testing.T) {
+	h := newTestHandler(t)
+	rec := do(h, "GET", "/patients/stats", "")
+	var stats models.PatientStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("stats = %d %s", rec.Code, rec.Body)
+	}
+	if stats.Total != 3 || stats.Female != 2 || stats.Male != 1 || stats.Disabled != 1 || stats.BySpecialty["Cardiology"] != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AppointmentStatus is where an appointment stands. It is stored as one
+// letter.
+type AppointmentStatus byte
+
+const (
+	AppointmentScheduled AppointmentStatus = 'S'
+	AppointmentCancelled AppointmentStatus = 'C'
+)
+
+func (s AppointmentStatus) String() string {
+	switch s {
+	case AppointmentScheduled:
+		return "scheduled"
+	case AppointmentCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+func (s AppointmentStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *AppointmentStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	switch name {
+	case "scheduled":
+		*s = AppointmentScheduled
+	case "cancelled":
+		*s = AppointmentCancelled
+	default:
+		return fmt.Errorf("unknown appointment status %q", name)
+	}
+	return nil
+}
+
+// Appointment is one visit of a patient. Unlike Patient.AppointmentDate,
+// which ScheduleAppointment overwrites, appointments are kept once made, so
+// together they are the patient's history.
+type Appointment struct {
+	ID        uint64            `json:"id"` // assigned by the store, from 1
+	CI        string            `json:"ci"`
+	Date      string            `json:"date"`     // YYYY-MM-DD
+	Time      string            `json:"time"`     // HH:MM, empty for a visit recorded by date only
+	Duration  int               `json:"duration"` // minutes, 0 when there is no time
+	Specialty string            `json:"specialty"`
+	Status    AppointmentStatus `json:"status"`
+}
+
+// Appointment field sizes, NUL included
+const (
+	appointmentTimeSize = 6
+)
+
+// minutesPerDay bounds where an appointment may end.
+const minutesPerDay = 24 * 60
+
+// validateAppointment checks the fields a caller gives for a new
+// appointment. The CI is checked by looking the patient up.
+func validateAppointment(a Appointment, op string) error {
+	code := 0
+	switch {
+	case ValidateAppointmentDate(a.Date) != nil:
+		code = codeFieldAppointmentDateFormat
+	case a.Time != "" && !isClockTime(a.Time):
+		code = codeFieldAppointmentTimeFormat
+	case a.Time == "" && a.Duration != 0,
+		a.Time != "" && (a.Duration < 1 || clockMinutes(a.Time)+a.Duration > minutesPerDay):
+		code = codeFieldAppointmentDuration
+	case a.Specialty == "":
+		code = codeFieldSpecialtyNull
+	case len(a.Specialty) > specialtySize:
+		code = codeFieldSpecialtyTooLong
+	default:
+		return nil
+	}
+	return errorFor(op, a.CI, code, 0)
+}
+
+func isClockTime(s string) bool {
+	_, err := time.Parse("15:04", s)
+	return err == nil && len(s) == appointmentTimeSize-1
+}
+
+// clockMinutes is an HH:MM time as minutes after midnight.
+func clockMinutes(s string) int {
+	t, _ := time.Parse("15:04", s)
+	return t.Hour()*60 + t.Minute()
+}
+
+// end is when a timed appointment is over, in minutes after midnight.
+func (a Appointment) end() int {
+	return clockMinutes(a.Time) + a.Duration
+}
+
+// newAppointment fills in what CreateAppointment doesn't take from the
+// caller: the specialty, if left empty, comes from the patient, a timed
+// appointment without a duration gets its specialty's, and the appointment
+// starts scheduled.
+func newAppointment(a Appointment, patient Patient, slots SlotConfig) Appointment {
+	a.CI = patient.ID
+	if a.Specialty == "" {
+		a.Specialty = patient.DocSpecialty
+	}
+	if a.Time != "" && a.Duration == 0 {
+		a.Duration = slots.Rule(a.Specialty).Duration
+	}
+	a.ID = 0
+	a.Status = AppointmentScheduled
+	return a
+}
+
+// requireTime rejects an appointment without a time, which
+// ScheduleAppointment needs to book a slot.
+func requireTime(a Appointment, op string) error {
+	if a.Time == "" {
+		return errorFor(op, a.CI, codeFieldAppointmentTimeFormat, 0)
+	}
+	return nil
+}
+
+// prepareAppointment is what every store does with a new appointment for
+// patient before keeping it: fill it in with newAppointment, validate it and
+// check its slot against sameDay, the appointments already on its date.
+func prepareAppointment(a Appointment, patient Patient, sameDay []Appointment, slots SlotConfig, op string) (Appointment, error) {
+	a = newAppointment(a, patient, slots)
+	if err := validateAppointment(a, op); err != nil {
+		return Appointment{}, err
+	}
+	if err := checkBooking(a, sameDay, slots, op); err != nil {
+		return Appointment{}, err
+	}
+	return a, nil
+}
+
+// compareAppointments orders a history by date, then time, then ID.
+func compareAppointments(a, b Appointment) int {
+	return cmp.Or(
+		strings.Compare(a.Date, b.Date),
+		strings.Compare(a.Time, b.Time),
+		cmp.Compare(a.ID, b.ID),
+	)
+}
@@ -0,0 +1,486 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Appointments are kept beside the patients, in appointments.bin and its
+// index appointments.idx, by both file backends. Unlike patients they are
+// written through: a new appointment is appended and a cancellation
+// rewrites its record, each flushed before the call returns, so they need
+// neither patients.wal nor Save.
+
+const (
+	appointmentFileName      = "appointments.bin"
+	appointmentIndexFileName = "appointments.idx"
+)
+
+const (
+	appointmentMagic         = "MDAA"
+	appointmentFormatVersion = 2
+)
+
+// appointmentLayout places the Appointment fields in a record, after the
+// 8-byte ID and before the CRC.
+type appointmentLayout struct {
+	ci, date, time, duration, specialty, status int // duration is -1 if not stored
+	size                                        int
+}
+
+// Record layouts by format version
+var appointmentLayouts = map[uint32]appointmentLayout{
+	// Version 1 had no duration
+	1: {8, 17, 28, -1, 34, 84, 85},
+	// Version 2 adds the duration, in minutes, as a uint16
+	2: {8, 17, 28, 34, 36, 86, 87},
+}
+
+var (
+	encodedAppointmentLayout = appointmentLayouts[appointmentFormatVersion]
+	appointmentRecordSize    = encodedAppointmentLayout.size + recordCRCSize
+)
+
+func (l appointmentLayout) recordSize() int {
+	return l.size + recordCRCSize
+}
+
+func (l appointmentLayout) encode(dest []byte, a Appointment) {
+	clear(dest[:l.recordSize()])
+	binary.LittleEndian.PutUint64(dest, a.ID)
+	putString(dest[l.ci:l.ci+ciSize], a.CI)
+	putString(dest[l.date:l.date+dateSize], a.Date)
+	putString(dest[l.time:l.time+appointmentTimeSize], a.Time)
+	if l.duration >= 0 {
+		binary.LittleEndian.PutUint16(dest[l.duration:], uint16(a.Duration))
+	}
+	putString(dest[l.specialty:l.specialty+specialtySize], a.Specialty)
+	dest[l.status] = byte(a.Status)
+	binary.LittleEndian.PutUint32(dest[l.size:], crc32.ChecksumIEEE(dest[:l.size]))
+}
+
+// decode returns the appointment even when the checksum doesn't match.
+func (l appointmentLayout) decode(src []byte) (Appointment, bool) {
+	ok := binary.LittleEndian.Uint32(src[l.size:]) == crc32.ChecksumIEEE(src[:l.size])
+	a := Appointment{
+		ID:        binary.LittleEndian.Uint64(src),
+		CI:        getString(src[l.ci : l.ci+ciSize]),
+		Date:      getString(src[l.date : l.date+dateSize]),
+		Time:      getString(src[l.time : l.time+appointmentTimeSize]),
+		Specialty: getString(src[l.specialty : l.specialty+specialtySize]),
+		Status:    AppointmentStatus(src[l.status]),
+	}
+	if l.duration >= 0 {
+		a.Duration = int(binary.LittleEndian.Uint16(src[l.duration:]))
+	}
+	return a, ok
+}
+
+// storedAppointment returns a as it reads back from appointments.bin.
+func storedAppointment(a Appointment) Appointment {
+	buf := make([]byte, appointmentRecordSize)
+	encodedAppointmentLayout.encode(buf, a)
+	a, _ = encodedAppointmentLayout.decode(buf)
+	return a
+}
+
+func appointmentOffset(position int) int64 {
+	return int64(headerSize) + int64(position)*int64(appointmentRecordSize)
+}
+
+func writeAppointmentHeader(file *os.File, count int) error {
+	header := fileHeader{version: appointmentFormatVersion, recordSize: uint32(appointmentRecordSize), recordCount: uint64(count)}
+	return writeFileHeader(file, appointmentMagic, header, "write appointments header")
+}
+
+// appointmentBook is the appointments of one database directory. IDs are
+// given out in order from 1, so an appointment's record sits at position
+// ID-1. It has no lock of its own; the store holding it serializes access.
+type appointmentBook struct {
+	path, indexPath string
+	appointments    []Appointment
+	byCI            map[string][]int // positions, in ID order
+	slots           SlotConfig
+}
+
+// open loads appointments.bin and its index, rebuilding the index when it
+// is missing or doesn't cover every record, and the slot configuration. A
+// missing file is an empty book.
+func (b *appointmentBook) open(dir string) error {
+	slots, err := LoadSlotConfig(dir)
+	if err != nil {
+		return err
+	}
+	*b = appointmentBook{
+		path:      filepath.Join(dir, appointmentFileName),
+		indexPath: filepath.Join(dir, appointmentIndexFileName),
+		byCI:      map[string][]int{},
+		slots:     slots,
+	}
+	appointments, version, err := readAppointmentsFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // none made yet
+	}
+	if err != nil {
+		return err
+	}
+	if version != appointmentFormatVersion {
+		if err := writeAppointmentsFile(b.path, appointments); err != nil {
+			return err
+		}
+		notef("Migrated appointments file from version %d to %d.\n", version, appointmentFormatVersion)
+	}
+	b.appointments = appointments
+
+	byCI, err := readAppointmentIndex(b.indexPath)
+	if err == nil && indexCovers(byCI, appointments) {
+		b.byCI = byCI
+		return nil
+	}
+	for i, a := range appointments {
+		b.byCI[a.CI] = append(b.byCI[a.CI], i)
+	}
+	notef("Appointment index rebuilt with %d entries.\n", len(appointments))
+	return b.writeIndex()
+}
+
+// close forgets the loaded appointments.
+func (b *appointmentBook) close() {
+	b.appointments = nil
+	b.byCI = nil
+}
+
+// list returns the appointments of ci, in compareAppointments order.
+func (b *appointmentBook) list(ci string) []Appointment {
+	history := make([]Appointment, 0, len(b.byCI[ci]))
+	for _, position := range b.byCI[ci] {
+		history = append(history, b.appointments[position])
+	}
+	slices.SortFunc(history, compareAppointments)
+	return history
+}
+
+// onDate returns the appointments on date, in ID order.
+func (b *appointmentBook) onDate(date string) []Appointment {
+	var sameDay []Appointment
+	for _, a := range b.appointments {
+		if a.Date == date {
+			sameDay = append(sameDay, a)
+		}
+	}
+	return sameDay
+}
+
+// prepare is prepareAppointment against the appointments in the book.
+func (b *appointmentBook) prepare(a Appointment, patient Patient, op string) (Appointment, error) {
+	return prepareAppointment(a, patient, b.onDate(a.Date), b.slots, op)
+}
+
+// create stores a as the next appointment and returns it with its ID. Once
+// the record is written the appointment is made, so a failure to update the
+// index is only noted; the next open rebuilds it.
+func (b *appointmentBook) create(a Appointment) (Appointment, error) {
+	position := len(b.appointments)
+	a.ID = uint64(position) + 1
+	if err := b.writeRecord(position, a); err != nil {
+		return Appointment{}, err
+	}
+	b.appointments = append(b.appointments, storedAppointment(a))
+	b.byCI[a.CI] = append(b.byCI[a.CI], position)
+	if err := b.writeIndex(); err != nil {
+		notef("Appointment index left stale, rebuilt on the next open: %v\n", err)
+	}
+	return b.appointments[position], nil
+}
+
+// drop takes back a, the appointment create last returned, when what it was
+// booked for can't be done. The header is cut first, so a crash leaves at
+// most unused bytes past the last record.
+func (b *appointmentBook) drop(a Appointment) error {
+	position := int(a.ID - 1)
+	if a.ID == 0 || position != len(b.appointments)-1 {
+		return &CodeError{Op: fmt.Sprintf("drop appointment %d, not the last one", a.ID), Code: codeInvalidArg}
+	}
+	file, err := os.OpenFile(b.path, os.O_RDWR, 0)
+	if err != nil {
+		return ioError("drop appointment", err)
+	}
+	err = writeAppointmentHeader(file, position)
+	if err == nil {
+		if truncErr := file.Truncate(appointmentOffset(position)); truncErr != nil {
+			err = ioError("drop appointment", truncErr)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := flushAndClose(file, "drop appointment"); err != nil {
+		return err
+	}
+	b.appointments = b.appointments[:position]
+	if positions := b.byCI[a.CI][:len(b.byCI[a.CI])-1]; len(positions) > 0 {
+		b.byCI[a.CI] = positions
+	} else {
+		delete(b.byCI, a.CI)
+	}
+	return b.writeIndex()
+}
+
+// cancel marks an appointment cancelled. It stays in the history.
+func (b *appointmentBook) cancel(id uint64) error {
+	op := fmt.Sprintf("cancel appointment %d", id)
+	if id == 0 || id > uint64(len(b.appointments)) {
+		return &NotFoundError{Op: op}
+	}
+	position := int(id - 1)
+	if b.appointments[position].Status == AppointmentCancelled {
+		return &CodeError{Op: op + ", already cancelled", Code: codeInvalidArg}
+	}
+	return b.setStatus(position, AppointmentCancelled)
+}
+
+// cancelAll cancels every scheduled appointment of ci and returns their
+// positions, so reschedule can put them back. On failure the ones already
+// cancelled are put back first.
+func (b *appointmentBook) cancelAll(ci string) ([]int, error) {
+	var cancelled []int
+	for _, position := range b.byCI[ci] {
+		if b.appointments[position].Status != AppointmentScheduled {
+			continue
+		}
+		if err := b.setStatus(position, AppointmentCancelled); err != nil {
+			return nil, errors.Join(err, b.reschedule(cancelled))
+		}
+		cancelled = append(cancelled, position)
+	}
+	return cancelled, nil
+}
+
+// reschedule takes back cancelAll when what the appointments were cancelled
+// for can't be done.
+func (b *appointmentBook) reschedule(cancelled []int) error {
+	for _, position := range cancelled {
+		if err := b.setStatus(position, AppointmentScheduled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *appointmentBook) setStatus(position int, status AppointmentStatus) error {
+	a := b.appointments[position]
+	a.Status = status
+	if err := b.writeRecord(position, a); err != nil {
+		return err
+	}
+	b.appointments[position] = a
+	return nil
+}
+
+// writeRecord overwrites the record at position, or appends it when
+// position is the record count, creating the file for the first one.
+func (b *appointmentBook) writeRecord(position int, a Appointment) error {
+	file, err := os.OpenFile(b.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return ioError("write appointment", err)
+	}
+	if position == 0 && len(b.appointments) == 0 {
+		err = writeAppointmentHeader(file, 0)
+	}
+	if err == nil {
+		buf := make([]byte, appointmentRecordSize)
+		encodedAppointmentLayout.encode(buf, a)
+		if _, writeErr := file.WriteAt(buf, appointmentOffset(position)); writeErr != nil {
+			err = ioError("write appointment", writeErr)
+		}
+	}
+	// Appends only count once the record itself is written
+	if err == nil && position >= len(b.appointments) {
+		err = writeAppointmentHeader(file, position+1)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return flushAndClose(file, "write appointment")
+}
+
+// writeIndex replaces appointments.idx: the record count it covers first,
+// then one |CI|id,id,...| line per patient.
+func (b *appointmentBook) writeIndex() error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#count|%d|\n", len(b.appointments))
+	cis := make([]string, 0, len(b.byCI))
+	for ci := range b.byCI {
+		cis = append(cis, ci)
+	}
+	slices.Sort(cis)
+	for _, ci := range cis {
+		ids := make([]string, len(b.byCI[ci]))
+		for i, position := range b.byCI[ci] {
+			ids[i] = strconv.Itoa(position + 1)
+		}
+		fmt.Fprintf(&sb, "|%s|%s|\n", ci, strings.Join(ids, ","))
+	}
+
+	tmpPath := b.indexPath + tmpSuffix
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return ioError("write appointment index", err)
+	}
+	if _, err := file.WriteString(sb.String()); err != nil {
+		file.Close()
+		return ioError("write appointment index", err)
+	}
+	if err := flushAndClose(file, "write appointment index"); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, b.indexPath); err != nil {
+		os.Remove(tmpPath)
+		return ioError("replace "+appointmentIndexFileName, err)
+	}
+	return syncDir(filepath.Dir(b.indexPath))
+}
+
+// readAppointmentsFile loads every record of path, in any format version,
+// and returns the version it was in. A record failing its checksum, or out
+// of ID order, fails the load.
+func readAppointmentsFile(path string) ([]Appointment, uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, ioError("load appointments", err)
+	}
+	defer file.Close()
+	header, err := readFileHeader(file, appointmentMagic, "read appointments header")
+	if err != nil {
+		return nil, 0, err
+	}
+	layout, ok := appointmentLayouts[header.version]
+	if !ok {
+		return nil, 0, &CodeError{Op: "read appointments header", Code: codeVersion}
+	}
+	size := layout.recordSize()
+	if header.recordSize != uint32(size) {
+		return nil, 0, &CodeError{Op: "read appointments header", Code: codeFormat}
+	}
+	if err := checkRecordCount(file, header, size, "load appointments"); err != nil {
+		return nil, 0, err
+	}
+
+	data := make([]byte, int(header.recordCount)*size)
+	if _, err := file.ReadAt(data, headerSize); err != nil {
+		return nil, 0, ioError("load appointments", err)
+	}
+	appointments := make([]Appointment, header.recordCount)
+	for i := range appointments {
+		a, ok := layout.decode(data[i*size : (i+1)*size])
+		if !ok {
+			return nil, 0, &CodeError{Op: "load appointments", Code: codeChecksum}
+		}
+		if a.ID != uint64(i)+1 {
+			return nil, 0, &CodeError{Op: "load appointments", Code: codeFormat}
+		}
+		appointments[i] = a
+	}
+	return appointments, header.version, nil
+}
+
+// writeAppointmentsFile replaces path with the appointments in the current
+// format, through a temporary file so a crash leaves the old one intact.
+func writeAppointmentsFile(path string, appointments []Appointment) error {
+	tmpPath := path + tmpSuffix
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return ioError("write appointments file", err)
+	}
+	buf := make([]byte, headerSize, headerSize+len(appointments)*appointmentRecordSize)
+	record := make([]byte, appointmentRecordSize)
+	for _, a := range appointments {
+		encodedAppointmentLayout.encode(record, a)
+		buf = append(buf, record...)
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return ioError("write appointments file", err)
+	}
+	if err := writeAppointmentHeader(file, len(appointments)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := flushAndClose(file, "write appointments file"); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return ioError("replace "+appointmentFileName, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// readAppointmentIndex reads appointments.idx as positions by CI.
+func readAppointmentIndex(path string) (map[string][]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ioError("load appointment index", err)
+	}
+	parseErr := &CodeError{Op: "load appointment index", Code: codeParseLine}
+	byCI := map[string][]int{}
+	count := -1
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		// "#count|N|" or "|CI|id,id,...|"
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 {
+			return nil, parseErr
+		}
+		if fields[0] == "#count" {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 0 {
+				return nil, parseErr
+			}
+			count = n
+			continue
+		}
+		if fields[0] != "" || fields[1] == "" || count < 0 {
+			return nil, parseErr
+		}
+		for _, field := range strings.Split(fields[2], ",") {
+			id, err := strconv.Atoi(field)
+			if err != nil || id < 1 || id > count {
+				return nil, parseErr
+			}
+			byCI[fields[1]] = append(byCI[fields[1]], id-1)
+		}
+	}
+	if count < 0 {
+		return nil, parseErr
+	}
+	return byCI, nil
+}
+
+// indexCovers reports whether byCI lists every appointment once, under its
+// own CI and in ID order.
+func indexCovers(byCI map[string][]int, appointments []Appointment) bool {
+	seen := 0
+	for ci, positions := range byCI {
+		for i, position := range positions {
+			if position >= len(appointments) || appointments[position].CI != ci ||
+				(i > 0 && position <= positions[i-1]) {
+				return false
+			}
+		}
+		seen += len(positions)
+	}
+	return seen == len(appointments)
+}
@@ -5,5 +5,7 @@ package models
 
 #include "patient.c"
 #include "patient_metrics.c"
+#include "patient_wal.c"
+#include "patient_file.c"
 */
 import "C"
@@ -0,0 +1,44 @@
+package models
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../csrc -DCGO_BUILD
+#include "patient.h"
+#include <stdlib.h>
+*/
+import "C"
+import "unsafe"
+
+// cIndex gives the C index the method set of hashIndex, so the tests, which
+// can't use cgo themselves, can run the same checks against both.
+type cIndex struct {
+	index C.Index
+}
+
+func (x *cIndex) add(ci string, position int) int {
+	cci := C.CString(ci)
+	defer C.free(unsafe.Pointer(cci))
+	return int(C.NewPatientIndex(&x.index, cci, C.size_t(position)))
+}
+
+func (x *cIndex) find(ci string) (int, int) {
+	cci := C.CString(ci)
+	defer C.free(unsafe.Pointer(cci))
+	var slot C.size_t
+	code := C.FindPatientIndex(&slot, &x.index, cci)
+	return int(slot), int(code)
+}
+
+func (x *cIndex) remove(ci string) int {
+	cci := C.CString(ci)
+	defer C.free(unsafe.Pointer(cci))
+	return int(C.RemovePatientIndex(&x.index, cci))
+}
+
+// counts returns the live entries and tombstones in the table.
+func (x *cIndex) counts() (int, int) {
+	return int(x.index.count), int(x.index.tombstones)
+}
+
+func (x *cIndex) free() {
+	C.FreeIndex(&x.index)
+}
@@ -0,0 +1,92 @@
+//go:build cgo
+
+package models
+
+import "testing"
+
+// testIndex is the method set shared by the C index and its Go port.
+type testIndex interface {
+	add(ci string, position int) int
+	find(ci string) (int, int)
+	remove(ci string) int
+	counts() (int, int)
+}
+
+func (x *hashIndex) counts() (int, int) {
+	return x.count, x.tombstones
+}
+
+// Every CI below hashes to bucket 1 of the initial table, so they share a
+// single collision chain.
+var chainCIs = []string{"10000001", "10001001", "10002001", "10003001"}
+
+func forEachIndex(t *testing.T, test func(t *testing.T, x testIndex)) {
+	t.Run("c", func(t *testing.T) {
+		x := &cIndex{}
+		defer x.free()
+		test(t, x)
+	})
+	t.Run("go", func(t *testing.T) {
+		test(t, &hashIndex{})
+	})
+}
+
+func checkIndexed(t *testing.T, x testIndex, want map[string]bool) {
+	t.Helper()
+	for ci, indexed := range want {
+		_, code := x.find(ci)
+		if indexed && code != 0 {
+			t.Errorf("find(%s) = code %d, want it indexed", ci, code)
+		}
+		if !indexed && code != codeNotFound {
+			t.Errorf("find(%s) = code %d, want %d", ci, code, codeNotFound)
+		}
+	}
+}
+
+func TestRemovePatientIndexKeepsChain(t *testing.T) {
+	// Removing each link of the chain in turn, head first and last
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {1, 3, 0, 2}} {
+		forEachIndex(t, func(t *testing.T, x testIndex) {
+			indexed := map[string]bool{}
+			for i, ci := range chainCIs {
+				if code := x.add(ci, i); code != 0 {
+					t.Fatalf("add(%s) = %d", ci, code)
+				}
+				indexed[ci] = true
+			}
+			for removed, i := range order {
+				ci := chainCIs[i]
+				if code := x.remove(ci); code != 0 {
+					t.Fatalf("remove(%s) = %d", ci, code)
+				}
+				indexed[ci] = false
+				checkIndexed(t, x, indexed)
+				if live, tombstones := x.counts(); live != len(chainCIs)-removed-1 || tombstones != removed+1 {
+					t.Errorf("after removing %s: %d live, %d tombstones", ci, live, tombstones)
+				}
+			}
+		})
+	}
+}
+
+func TestRemovePatientIndexThenReAdd(t *testing.T) {
+	forEachIndex(t, func(t *testing.T, x testIndex) {
+		for i, ci := range chainCIs {
+			x.add(ci, i)
+		}
+		// The home bucket's tombstone is reused and must keep the chain linked
+		x.remove(chainCIs[0])
+		x.remove(chainCIs[2])
+		if code := x.add(chainCIs[0], 7); code != 0 {
+			t.Fatalf("re-add = %d", code)
+		}
+		checkIndexed(t, x, map[string]bool{chainCIs[0]: true, chainCIs[1]: true, chainCIs[2]: false, chainCIs[3]: true})
+		if code := x.add(chainCIs[1], 9); code != codeDuplicate {
+			t.Errorf("adding an indexed CI = %d, want %d", code, codeDuplicate)
+		}
+		if code := x.remove(chainCIs[2]); code != codeNotFound {
+			t.Errorf("removing a removed CI = %d, want %d", code, codeNotFound)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package models
+
+// Error codes of csrc/errors.h, for the parts of the package that don't go
+// through cgo. Keep both lists in step.
+const (
+	codeNullPtr    = 100
+	codeInvalidArg = 101
+	codeOutOfRange = 102
+	codeAlloc      = 103
+	codeIO         = 104
+	codeDuplicate  = 105
+	codeNotFound   = 106
+	codeAssign     = 107
+
+	codeAppointmentConflict = 108
+	codeSlotFull            = 109
+
+	codeFieldCINull                = 200
+	codeFieldCIFormat              = 201
+	codeFieldNameNull              = 202
+	codeFieldNameTooLong           = 203
+	codeFieldAgeInvalid            = 204
+	codeFieldGenderInvalid         = 205
+	codeFieldDiagnosisNull         = 206
+	codeFieldDiagnosisTooLong      = 207
+	codeFieldSpecialtyNull         = 208
+	codeFieldSpecialtyTooLong      = 209
+	codeFieldAppointmentDateNull   = 210
+	codeFieldAppointmentDateFormat = 211
+	codeFieldAppointmentTimeFormat = 212
+	codeFieldAppointmentDuration   = 213
+
+	codeParseLine  = 300
+	codeIndexRange = 301
+	codeFormat     = 302
+	codeVersion    = 303
+	codeChecksum   = 304
+)
+
+var codeDescriptions = map[int]string{
+	codeNullPtr:                    "Null pointer argument",
+	codeInvalidArg:                 "Invalid argument",
+	codeOutOfRange:                 "Value out of allowed range",
+	codeAlloc:                      "Memory allocation failed",
+	codeIO:                         "File I/O error",
+	codeDuplicate:                  "Duplicate entry",
+	codeNotFound:                   "Entry not found",
+	codeAssign:                     "Assignment to destination pointer failed",
+	codeAppointmentConflict:        "Patient already has an appointment at that time",
+	codeSlotFull:                   "Time slot is fully booked",
+	codeFieldCINull:                "CI is NULL",
+	codeFieldCIFormat:              "CI must be exactly 8 digits",
+	codeFieldNameNull:              "Name is NULL",
+	codeFieldNameTooLong:           "Name is too long",
+	codeFieldAgeInvalid:            "Invalid age (must be >= 0)",
+	codeFieldGenderInvalid:         "Invalid gender (must be 'M' or 'F')",
+	codeFieldDiagnosisNull:         "Diagnosis is NULL",
+	codeFieldDiagnosisTooLong:      "Diagnosis is too long",
+	codeFieldSpecialtyNull:         "Specialty is NULL",
+	codeFieldSpecialtyTooLong:      "Specialty is too long",
+	codeFieldAppointmentDateNull:   "Appointment date is NULL",
+	codeFieldAppointmentDateFormat: "Appointment date must be YYYY-MM-DD (10 chars)",
+	codeFieldAppointmentTimeFormat: "Appointment time must be HH:MM",
+	codeFieldAppointmentDuration:   "Appointment must last a minute or more and end by midnight",
+	codeParseLine:                  "Malformed or unreadable line in file",
+	codeIndexRange:                 "Hash/index out of allowed range",
+	codeFormat:                     "Missing or corrupt file header",
+	codeVersion:                    "File format version needs migration",
+	codeChecksum:                   "Record checksum mismatch",
+}
+
+// codeNames are the enumerator names of csrc/errors.h.
+var codeNames = map[int]string{
+	codeNullPtr:                    "ERR_NULL_PTR",
+	codeInvalidArg:                 "ERR_INVALID_ARG",
+	codeOutOfRange:                 "ERR_OUT_OF_RANGE",
+	codeAlloc:                      "ERR_ALLOC",
+	codeIO:                         "ERR_IO",
+	codeDuplicate:                  "ERR_DUPLICATE",
+	codeNotFound:                   "ERR_NOT_FOUND",
+	codeAssign:                     "ERR_ASSIGN",
+	codeAppointmentConflict:        "ERR_APPOINTMENT_CONFLICT",
+	codeSlotFull:                   "ERR_SLOT_FULL",
+	codeFieldCINull:                "ERR_FIELD_CI_NULL",
+	codeFieldCIFormat:              "ERR_FIELD_CI_FORMAT",
+	codeFieldNameNull:              "ERR_FIELD_NAME_NULL",
+	codeFieldNameTooLong:           "ERR_FIELD_NAME_TOO_LONG",
+	codeFieldAgeInvalid:            "ERR_FIELD_AGE_INVALID",
+	codeFieldGenderInvalid:         "ERR_FIELD_GENDER_INVALID",
+	codeFieldDiagnosisNull:         "ERR_FIELD_DIAGNOSIS_NULL",
+	codeFieldDiagnosisTooLong:      "ERR_FIELD_DIAGNOSIS_TOO_LONG",
+	codeFieldSpecialtyNull:         "ERR_FIELD_SPECIALTY_NULL",
+	codeFieldSpecialtyTooLong:      "ERR_FIELD_SPECIALTY_TOO_LONG",
+	codeFieldAppointmentDateNull:   "ERR_FIELD_APPOINTMENT_DATE_NULL",
+	codeFieldAppointmentDateFormat: "ERR_FIELD_APPOINTMENT_DATE_FORMAT",
+	codeFieldAppointmentTimeFormat: "ERR_FIELD_APPOINTMENT_TIME_FORMAT",
+	codeFieldAppointmentDuration:   "ERR_FIELD_APPOINTMENT_DURATION_INVALID",
+	codeParseLine:                  "ERR_PARSE_LINE",
+	codeIndexRange:                 "ERR_INDEX_RANGE",
+	codeFormat:                     "ERR_FORMAT",
+	codeVersion:                    "ERR_VERSION",
+	codeChecksum:                   "ERR_CHECKSUM",
+}
+
+// CodeName is the errors.h name of code, such as "ERR_NOT_FOUND", or "" for
+// a code it doesn't define.
+func CodeName(code int) string {
+	return codeNames[code]
+}
+
+// describeCode is the Go side of ErrorDescription.
+func describeCode(code int) string {
+	if description, ok := codeDescriptions[code]; ok {
+		return description
+	}
+	return "Unknown error code"
+}
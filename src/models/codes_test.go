@@ -0,0 +1,24 @@
+//go:build cgo
+
+package models
+
+import "testing"
+
+func TestCodesMatchErrorsH(t *testing.T) {
+	if len(codeNames) != len(cCodes) {
+		t.Errorf("codes.go names %d codes, errors.h has %d", len(codeNames), len(cCodes))
+	}
+	for code, name := range codeNames {
+		value, ok := cCodes[name]
+		if !ok {
+			t.Errorf("%s (%d) is not in errors.h", name, code)
+			continue
+		}
+		if value != code {
+			t.Errorf("%s = %d in codes.go, %d in errors.h", name, code, value)
+		}
+		if got, want := describeCode(code), cDescription(value); got != want {
+			t.Errorf("%s is described as %q, errors.h says %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Sentinels for each family of codes in csrc/errors.h, for use with errors.Is.
+var (
+	ErrValidation = errors.New("invalid patient field")
+	ErrNotFound   = errors.New("patient not found")
+	ErrDuplicate  = errors.New("duplicate patient")
+	ErrIO         = errors.New("file I/O error")
+	ErrCorrupt    = errors.New("corrupt data file")
+	ErrBooking    = errors.New("appointment slot unavailable")
+)
+
+// ValidationError reports a patient field rejected by the C layer, or an
+// appointment field rejected by its store (ERR_FIELD_* codes).
+type ValidationError struct {
+	Op    string
+	Field string // Patient or Appointment field name, e.g. "ID" or "Time"
+	Code  int
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: invalid %s: %s", e.Op, e.Field, describeCode(e.Code))
+}
+
+func (e *ValidationError) Is(target error) bool { return target == ErrValidation }
+
+// NotFoundError is returned when no patient has the requested CI.
+type NotFoundError struct {
+	Op string
+	CI string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.CI == "" {
+		return fmt.Sprintf("%s: %s", e.Op, describeCode(codeNotFound))
+	}
+	return fmt.Sprintf("patient with CI %s not found", e.CI)
+}
+
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// DuplicateError is returned when adding a patient whose CI is already taken.
+type DuplicateError struct {
+	CI string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("a patient with CI %s already exists", e.CI)
+}
+
+func (e *DuplicateError) Is(target error) bool { return target == ErrDuplicate }
+
+// BookingError is an appointment refused because the patient already has
+// one at that time (ERR_APPOINTMENT_CONFLICT) or its specialty has no room
+// left then (ERR_SLOT_FULL).
+type BookingError struct {
+	Op   string
+	CI   string
+	Code int
+}
+
+func (e *BookingError) Error() string {
+	return fmt.Sprintf("%s for %s: %s", e.Op, e.CI, describeCode(e.Code))
+}
+
+func (e *BookingError) Is(target error) bool { return target == ErrBooking }
+
+// IOError is a failed file operation. Errno is the C errno left by the
+// failing call when there was one, and is what the error unwraps to, so
+// checks like errors.Is(err, fs.ErrNotExist) work.
+type IOError struct {
+	Op    string
+	Errno syscall.Errno
+}
+
+func (e *IOError) Error() string {
+	if e.Errno == 0 {
+		return fmt.Sprintf("%s: %s", e.Op, describeCode(codeIO))
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Op, describeCode(codeIO), e.Errno)
+}
+
+func (e *IOError) Is(target error) bool { return target == ErrIO }
+
+func (e *IOError) Unwrap() error {
+	if e.Errno == 0 {
+		return nil
+	}
+	return e.Errno
+}
+
+// errnoOf digs the errno out of an error from the os package, if it has one.
+func errnoOf(err error) syscall.Errno {
+	var errno syscall.Errno
+	errors.As(err, &errno)
+	return errno
+}
+
+// CodeError carries any other code from csrc/errors.h. Damaged or unreadable
+// data files match ErrCorrupt.
+type CodeError struct {
+	Op   string
+	Code int
+}
+
+func (e *CodeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, describeCode(e.Code))
+}
+
+func (e *CodeError) Is(target error) bool {
+	if target != ErrCorrupt {
+		return false
+	}
+	switch e.Code {
+	case codeParseLine, codeFormat, codeVersion, codeChecksum:
+		return true
+	}
+	return false
+}
+
+// fieldNames maps the ERR_FIELD_* codes to the Patient or Appointment field
+// they reject.
+var fieldNames = map[int]string{
+	codeFieldCINull:                "ID",
+	codeFieldCIFormat:              "ID",
+	codeFieldNameNull:              "Name",
+	codeFieldNameTooLong:           "Name",
+	codeFieldAgeInvalid:            "Age",
+	codeFieldGenderInvalid:         "Gender",
+	codeFieldDiagnosisNull:         "Diagnosis",
+	codeFieldDiagnosisTooLong:      "Diagnosis",
+	codeFieldSpecialtyNull:         "DocSpecialty",
+	codeFieldSpecialtyTooLong:      "DocSpecialty",
+	codeFieldAppointmentDateNull:   "AppointmentDate",
+	codeFieldAppointmentDateFormat: "AppointmentDate",
+	codeFieldAppointmentTimeFormat: "Time",
+	codeFieldAppointmentDuration:   "Duration",
+}
+
+// errorFor builds the typed error for a non-zero code from csrc/errors.h. ci
+// names the patient involved, if any, and errno is attached to I/O errors.
+func errorFor(op string, ci string, code int, errno syscall.Errno) error {
+	if field, ok := fieldNames[code]; ok {
+		return &ValidationError{Op: op, Field: field, Code: code}
+	}
+	switch code {
+	case codeNotFound:
+		return &NotFoundError{Op: op, CI: ci}
+	case codeDuplicate:
+		return &DuplicateError{CI: ci}
+	case codeAppointmentConflict, codeSlotFull:
+		return &BookingError{Op: op, CI: ci, Code: code}
+	case codeIO:
+		return &IOError{Op: op, Errno: errno}
+	}
+	return &CodeError{Op: op, Code: code}
+}
+
+// ErrorCode returns the csrc/errors.h code behind err, or 0 if err is not
+// one of the typed errors above.
+func ErrorCode(err error) int {
+	var validation *ValidationError
+	var booking *BookingError
+	var code *CodeError
+	switch {
+	case errors.As(err, &validation):
+		return validation.Code
+	case errors.As(err, &booking):
+		return booking.Code
+	case errors.As(err, &code):
+		return code.Code
+	case errors.Is(err, ErrNotFound):
+		return codeNotFound
+	case errors.Is(err, ErrDuplicate):
+		return codeDuplicate
+	case errors.Is(err, ErrIO):
+		return codeIO
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package models
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../csrc -DCGO_BUILD
+#include "errors.h"
+*/
+import "C"
+
+// codeError converts a non-zero code returned by the C layer into the typed
+// error for its family. ci names the patient involved, if any, and errno is
+// the second value of the cgo call, attached to I/O errors.
+func codeError(op string, ci string, code C.int, errno error) error {
+	return errorFor(op, ci, int(code), errnoOf(errno))
+}
+
+// cCodes are the errors.h enumerators by name, for the test keeping
+// codes.go in step with them.
+var cCodes = map[string]int{
+	"ERR_NULL_PTR":                           C.ERR_NULL_PTR,
+	"ERR_INVALID_ARG":                        C.ERR_INVALID_ARG,
+	"ERR_OUT_OF_RANGE":                       C.ERR_OUT_OF_RANGE,
+	"ERR_ALLOC":                              C.ERR_ALLOC,
+	"ERR_IO":                                 C.ERR_IO,
+	"ERR_DUPLICATE":                          C.ERR_DUPLICATE,
+	"ERR_NOT_FOUND":                          C.ERR_NOT_FOUND,
+	"ERR_ASSIGN":                             C.ERR_ASSIGN,
+	"ERR_APPOINTMENT_CONFLICT":               C.ERR_APPOINTMENT_CONFLICT,
+	"ERR_SLOT_FULL":                          C.ERR_SLOT_FULL,
+	"ERR_FIELD_CI_NULL":                      C.ERR_FIELD_CI_NULL,
+	"ERR_FIELD_CI_FORMAT":                    C.ERR_FIELD_CI_FORMAT,
+	"ERR_FIELD_NAME_NULL":                    C.ERR_FIELD_NAME_NULL,
+	"ERR_FIELD_NAME_TOO_LONG":                C.ERR_FIELD_NAME_TOO_LONG,
+	"ERR_FIELD_AGE_INVALID":                  C.ERR_FIELD_AGE_INVALID,
+	"ERR_FIELD_GENDER_INVALID":               C.ERR_FIELD_GENDER_INVALID,
+	"ERR_FIELD_DIAGNOSIS_NULL":               C.ERR_FIELD_DIAGNOSIS_NULL,
+	"ERR_FIELD_DIAGNOSIS_TOO_LONG":           C.ERR_FIELD_DIAGNOSIS_TOO_LONG,
+	"ERR_FIELD_SPECIALTY_NULL":               C.ERR_FIELD_SPECIALTY_NULL,
+	"ERR_FIELD_SPECIALTY_TOO_LONG":           C.ERR_FIELD_SPECIALTY_TOO_LONG,
+	"ERR_FIELD_APPOINTMENT_DATE_NULL":        C.ERR_FIELD_APPOINTMENT_DATE_NULL,
+	"ERR_FIELD_APPOINTMENT_DATE_FORMAT":      C.ERR_FIELD_APPOINTMENT_DATE_FORMAT,
+	"ERR_FIELD_APPOINTMENT_TIME_FORMAT":      C.ERR_FIELD_APPOINTMENT_TIME_FORMAT,
+	"ERR_FIELD_APPOINTMENT_DURATION_INVALID": C.ERR_FIELD_APPOINTMENT_DURATION_INVALID,
+	"ERR_PARSE_LINE":                         C.ERR_PARSE_LINE,
+	"ERR_INDEX_RANGE":                        C.ERR_INDEX_RANGE,
+	"ERR_FORMAT":                             C.ERR_FORMAT,
+	"ERR_VERSION":                            C.ERR_VERSION,
+	"ERR_CHECKSUM":                           C.ERR_CHECKSUM,
+}
+
+// cDescription is ErrorDescription, for the same test.
+func cDescription(code int) string {
+	return C.GoString(C.ErrorDescription(C.int(code)))
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportFormat is a file format patient lists can be written in.
+type ExportFormat string
+
+const (
+	FormatCSV  ExportFormat = "csv"
+	FormatJSON ExportFormat = "json"
+)
+
+// ParseExportFormat accepts "csv" or "json".
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch format := ExportFormat(name); format {
+	case FormatCSV, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, want %q or %q", name, FormatCSV, FormatJSON)
+}
+
+// csvHeader names the columns of an exported CSV file, in the field order of
+// patients.dat.
+var csvHeader = []string{"ci", "name", "age", "diagnosis", "gender", "disability", "doc_specialty", "appointment_date"}
+
+// patientJSON is how a patient is written to JSON.
+type patientJSON struct {
+	CI              string `json:"ci"`
+	Name            string `json:"name"`
+	Age             int    `json:"age"`
+	Diagnosis       string `json:"diagnosis"`
+	Gender          string `json:"gender"`
+	Disability      bool   `json:"disability"`
+	DocSpecialty    string `json:"doc_specialty"`
+	AppointmentDate string `json:"appointment_date"`
+}
+
+// ExportPatients writes patients, such as a whole list or the result of one
+// of the List filters, to w in the given format. It is not a PatientStore
+// method: it only formats the list it is given, the one a view already shows,
+// the same way for every backend, like ImportPatientsCSV reads it back.
+func ExportPatients(w io.Writer, format ExportFormat, patients []Patient) error {
+	switch format {
+	case FormatCSV:
+		return WritePatientsCSV(w, patients)
+	case FormatJSON:
+		return WritePatientsJSON(w, patients)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// WritePatientsCSV writes a header line and one row per patient. Disability
+// is 0 or 1, as in patients.dat.
+func WritePatientsCSV(w io.Writer, patients []Patient) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, p := range patients {
+		disability := "0"
+		if p.Disability {
+			disability = "1"
+		}
+		record := []string{
+			p.ID, p.Name, strconv.Itoa(p.Age), p.Diagnosis, string(p.Gender),
+			disability, p.DocSpecialty, p.AppointmentDate,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePatientsJSON writes the patients as an indented JSON array. An empty
+// list is written as [] rather than null.
+func WritePatientsJSON(w io.Writer, patients []Patient) error {
+	if patients == nil {
+		patients = []Patient{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(patients)
+}
+
+// MarshalJSON writes the patient with snake_case keys and the gender as a
+// one-letter string.
+func (p Patient) MarshalJSON() ([]byte, error) {
+	record := patientJSON{
+		CI:              p.ID,
+		Name:            p.Name,
+		Age:             p.Age,
+		Diagnosis:       p.Diagnosis,
+		Disability:      p.Disability,
+		DocSpecialty:    p.DocSpecialty,
+		AppointmentDate: p.AppointmentDate,
+	}
+	if p.Gender != 0 {
+		record.Gender = string(p.Gender)
+	}
+	return json.Marshal(record)
+}
+
+// UnmarshalJSON reads what MarshalJSON writes. Unknown keys are an error, so
+// a misspelled field isn't silently left empty, and a gender longer than one
+// letter is rejected as by NewPatient.
+func (p *Patient) UnmarshalJSON(data []byte) error {
+	var record patientJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&record); err != nil {
+		return err
+	}
+	if len(record.Gender) > 1 {
+		return &ValidationError{Op: "decode patient", Field: "Gender", Code: codeFieldGenderInvalid}
+	}
+	*p = Patient{
+		ID:              record.CI,
+		Name:            record.Name,
+		Age:             record.Age,
+		Diagnosis:       record.Diagnosis,
+		Disability:      record.Disability,
+		DocSpecialty:    record.DocSpecialty,
+		AppointmentDate: record.AppointmentDate,
+	}
+	if record.Gender != "" {
+		p.Gender = record.Gender[0]
+	}
+	return nil
+}
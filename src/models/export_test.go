@@ -0,0 +1,143 @@
+package models
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWritePatientsCSV(t *testing.T) {
+	quoted := bob
+	quoted.Name = `Bob "Bobby" Smith`
+	quoted.Diagnosis = "Diabetes, type 2\nfollow up"
+	var buf bytes.Buffer
+	if err := WritePatientsCSV(&buf, []Patient{alice, quoted}); err != nil {
+		t.Fatal(err)
+	}
+	want := "ci,name,age,diagnosis,gender,disability,doc_specialty,appointment_date\n" +
+		"12345678,Alice Johnson,34,Hypertension,F,0,Cardiology,2024-02-15\n" +
+		`87654321,"Bob ""Bobby"" Smith",47,"Diabetes, type 2` + "\n" + `follow up",M,1,Endocrinology,2024-03-10` + "\n"
+	if buf.String() != want {
+		t.Fatalf("csv =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// Read back, the quoted fields come out whole
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[2][1] != quoted.Name || records[2][3] != quoted.Diagnosis {
+		t.Errorf("read back %q", records)
+	}
+}
+
+func TestWritePatientsCSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePatientsCSV(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(csvHeader, ",") + "\n"; buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWritePatientsJSON(t *testing.T) {
+	tests := []struct {
+		patients []Patient
+		want     string
+	}{
+		{nil, "[]\n"},
+		{[]Patient{}, "[]\n"},
+		{[]Patient{alice}, `[
+  {
+    "ci": "12345678",
+    "name": "Alice Johnson",
+    "age": 34,
+    "diagnosis": "Hypertension",
+    "gender": "F",
+    "disability": false,
+    "doc_specialty": "Cardiology",
+    "appointment_date": "2024-02-15"
+  }
+]
+`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WritePatientsJSON(&buf, test.patients); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("json of %v =\n%s\nwant\n%s", test.patients, buf.String(), test.want)
+		}
+	}
+}
+
+func TestPatientJSONRoundTrip(t *testing.T) {
+	noGender := carla
+	noGender.Gender = 0
+	quoted := bob
+	quoted.Diagnosis = "Diabetes, \"type 2\"\nfollow up"
+	for _, p := range []Patient{alice, bob, noGender, quoted, {}} {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("marshal %+v: %v", p, err)
+		}
+		var got Patient
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if got != p {
+			t.Errorf("round trip of %+v through %s = %+v", p, data, got)
+		}
+	}
+
+	var list []Patient
+	var buf bytes.Buffer
+	if err := WritePatientsJSON(&buf, []Patient{alice, bob, carla}); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &list); err != nil || !slices.Equal(list, []Patient{alice, bob, carla}) {
+		t.Errorf("read back %v, %v", list, err)
+	}
+}
+
+func TestPatientUnmarshalJSONErrors(t *testing.T) {
+	var p Patient
+	if err := json.Unmarshal([]byte(`{"ci": "12345678", "nmae": "Alice"}`), &p); err == nil {
+		t.Error("unknown key = nil, want an error")
+	}
+	err := json.Unmarshal([]byte(`{"ci": "12345678", "gender": "FM"}`), &p)
+	var validation *ValidationError
+	if !errors.As(err, &validation) || validation.Field != "Gender" {
+		t.Errorf("two-letter gender = %v, want a Gender ValidationError", err)
+	}
+}
+
+func TestExportPatients(t *testing.T) {
+	for _, name := range []string{"csv", "json"} {
+		format, err := ParseExportFormat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want bytes.Buffer
+		if err := ExportPatients(&got, format, []Patient{alice}); err != nil {
+			t.Fatal(err)
+		}
+		if format == FormatCSV {
+			WritePatientsCSV(&want, []Patient{alice})
+		} else {
+			WritePatientsJSON(&want, []Patient{alice})
+		}
+		if got.String() != want.String() {
+			t.Errorf("export %s = %q, want %q", name, got.String(), want.String())
+		}
+	}
+	if _, err := ParseExportFormat("xml"); err == nil {
+		t.Error("parse xml = nil, want an error")
+	}
+}
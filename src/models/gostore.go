@@ -0,0 +1,637 @@
+package models
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+)
+
+// GoPatientStore is the pure-Go PatientStore. It reads and writes the same
+// files as PatientService, following the C engine step by step: mutations
+// are logged to patients.wal, written in place into patients.bin and
+// committed together with index.dat on Save. It needs no cgo, so it builds
+// for any target and runs under the race detector.
+type GoPatientStore struct {
+	mu       sync.RWMutex
+	files    databaseFiles
+	patients []Patient // records of patients.bin by position, empty ones included
+	index    hashIndex
+	free     []int // positions left empty by deleted patients, lowest last
+
+	appointments appointmentBook
+}
+
+var _ PatientStore = (*GoPatientStore)(nil)
+
+// NewGoPatientStore creates a store for the database in dataDir. The files
+// are not touched until Open.
+func NewGoPatientStore(dataDir string) *GoPatientStore {
+	return &GoPatientStore{files: newDatabaseFiles(dataDir)}
+}
+
+func (s *GoPatientStore) DataDir() string {
+	return s.files.dir
+}
+
+func (s *GoPatientStore) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.patients = nil
+	s.index = hashIndex{}
+	s.free = nil
+	s.appointments.close()
+}
+
+func (s *GoPatientStore) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.files.dir, 0o755); err != nil {
+		return &IOError{Op: "create data directory", Errno: errnoOf(err)}
+	}
+	if err := s.files.recover(); err != nil {
+		return err
+	}
+	from, err := s.files.migrate()
+	if err != nil {
+		return err
+	}
+	if from != patientFormatVersion {
+		notef("Migrated patients file from version %d to %d.\n", from, patientFormatVersion)
+	}
+	if err := s.appointments.open(s.files.dir); err != nil {
+		return err
+	}
+
+	err = s.loadPatients()
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil // nothing saved yet
+	}
+	if err != nil {
+		index, indexErr := readIndexFile(s.files.index)
+		if indexErr != nil && !errors.Is(indexErr, fs.ErrNotExist) {
+			return errors.Join(err, indexErr)
+		}
+		s.index = index
+		return err
+	}
+
+	if err := s.openIndex(); err != nil {
+		return err
+	}
+	return s.replayLog()
+}
+
+// openIndex loads index.dat like PatientService.openIndex, rebuilding the
+// index from the loaded patients when the file is missing, can't be parsed
+// or doesn't match them.
+func (s *GoPatientStore) openIndex() error {
+	index, err := readIndexFile(s.files.index)
+	if err == nil && indexMatches(&index, s.patients) {
+		s.index = index
+		return nil
+	}
+	if errors.Is(err, ErrIO) && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := s.indexPatients(); err != nil {
+		return err
+	}
+	notef("Index created with %d entries.\n", s.index.count)
+	return nil
+}
+
+// indexMatches reports whether index holds every patient, and only them, at
+// their own positions.
+func indexMatches(index *hashIndex, patients []Patient) bool {
+	live := 0
+	for _, p := range patients {
+		if !isEmptyPatient(p) {
+			live++
+		}
+	}
+	if live != index.count {
+		return false
+	}
+	for _, entry := range index.entries {
+		if entry.ci == "" || entry.deleted {
+			continue
+		}
+		if entry.position < 0 || entry.position >= len(patients) || patients[entry.position].ID != entry.ci {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *GoPatientStore) loadPatients() error {
+	patients, err := readPatientsFile(s.files.patients, nil)
+	if err != nil {
+		return err
+	}
+	s.patients = patients
+	s.free = s.free[:0]
+	// Pushed from the end so the lowest positions are reused first
+	for i := len(patients) - 1; i >= 0; i-- {
+		if isEmptyPatient(patients[i]) {
+			s.free = append(s.free, i)
+		}
+	}
+	return nil
+}
+
+func (s *GoPatientStore) indexPatients() error {
+	s.index = hashIndex{}
+	for i, p := range s.patients {
+		if isEmptyPatient(p) {
+			continue // Skip slots left by deleted patients
+		}
+		code := s.index.add(p.ID, i)
+		if code == codeDuplicate {
+			// Left over from before duplicates were rejected; the first one
+			// wins and the next save drops the rest
+			notef("Skipping duplicate patient %s at %d.\n", p.ID, i)
+			continue
+		}
+		if code != 0 {
+			return errorFor("index patient", p.ID, code, 0)
+		}
+	}
+	return nil
+}
+
+// replayLog re-applies the mutations logged since the last checkpoint and,
+// if a log was left, checkpoints them.
+func (s *GoPatientStore) replayLog() error {
+	entries, err := readWal(s.files.wal)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.applyWalEntry(entry); err != nil {
+			return err
+		}
+	}
+	if len(entries) == 0 {
+		// A torn tail is all that's left; checkpoint anyway to clear it
+		if left, err := walExists(s.files.wal); err != nil || !left {
+			return err
+		}
+	}
+	return s.save()
+}
+
+// applyWalEntry applies a logged mutation as an upsert, like ApplyWalEntry,
+// so entries that already reached the patients file are harmless.
+func (s *GoPatientStore) applyWalEntry(entry walEntry) error {
+	ci := entry.patient.ID
+	_, found := s.index.find(ci)
+	switch entry.op {
+	case walDelete:
+		if found != 0 {
+			return nil // already gone
+		}
+		return s.deletePatient(ci)
+	case walSchedule:
+		if found != 0 {
+			return nil // deleted later on
+		}
+		return s.scheduleAppointment(ci, entry.patient.AppointmentDate)
+	case walAdd, walUpdate:
+		if found == 0 {
+			return s.updatePatient(entry.patient)
+		}
+		return s.addPatient(entry.patient)
+	}
+	return &CodeError{Op: "replay patient log", Code: codeParseLine}
+}
+
+// validatePatient applies the checks of NewPatient.
+func validatePatient(p Patient) error {
+	code := 0
+	switch {
+	case len(p.ID) != 8 || !isDigits(p.ID):
+		code = codeFieldCIFormat
+	case p.Name == "":
+		code = codeFieldNameNull
+	case len(p.Name) > nameSize:
+		code = codeFieldNameTooLong
+	case p.Age < 0:
+		code = codeFieldAgeInvalid
+	case p.Diagnosis == "":
+		code = codeFieldDiagnosisNull
+	case len(p.Diagnosis) > diagnosisSize:
+		code = codeFieldDiagnosisTooLong
+	case p.Gender != 'M' && p.Gender != 'F':
+		code = codeFieldGenderInvalid
+	case p.DocSpecialty == "":
+		code = codeFieldSpecialtyNull
+	case len(p.DocSpecialty) > specialtySize:
+		code = codeFieldSpecialtyTooLong
+	case len(p.AppointmentDate) != dateSize-1:
+		code = codeFieldAppointmentDateFormat
+	default:
+		return nil
+	}
+	return errorFor("create patient", p.ID, code, 0)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *GoPatientStore) isIndexed(ci string) bool {
+	_, code := s.index.find(ci)
+	return code == 0
+}
+
+func (s *GoPatientStore) GetPatient(ci string) (*PatientResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	slot, code := s.index.find(ci)
+	if code != 0 {
+		return nil, errorFor("get patient", ci, code, 0)
+	}
+	p, err := readRecordAt(s.files.patients, s.index.entries[slot].position)
+	if err != nil {
+		return nil, err
+	}
+	return &PatientResponse{Patient: p, Index: uint(slot)}, nil
+}
+
+func (s *GoPatientStore) AddPatient(p Patient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validatePatient(p); err != nil {
+		return err
+	}
+	// Rejected up front so a duplicate never reaches the log
+	if s.isIndexed(p.ID) {
+		return &DuplicateError{CI: p.ID}
+	}
+	if err := appendWal(s.files.wal, walAdd, p); err != nil {
+		return err
+	}
+	return s.addPatient(p)
+}
+
+// addPatient is AddPatient: it fills the hole left by a deleted patient
+// before growing the file, and indexes the patient before writing the record.
+func (s *GoPatientStore) addPatient(p Patient) error {
+	position := len(s.patients)
+	reused := len(s.free) > 0
+	if reused {
+		position = s.free[len(s.free)-1]
+	}
+	if code := s.index.add(p.ID, position); code != 0 {
+		return errorFor("add patient", p.ID, code, 0)
+	}
+	if err := writeRecordAt(s.files.patients, position, p, true); err != nil {
+		s.index.remove(p.ID)
+		return err
+	}
+	if reused {
+		s.free = s.free[:len(s.free)-1]
+		s.patients[position] = stored(p)
+	} else {
+		s.patients = append(s.patients, stored(p))
+	}
+	return nil
+}
+
+func (s *GoPatientStore) UpdatePatient(p Patient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validatePatient(p); err != nil {
+		return err
+	}
+	if !s.isIndexed(p.ID) {
+		return &NotFoundError{Op: "update patient", CI: p.ID}
+	}
+	if err := appendWal(s.files.wal, walUpdate, p); err != nil {
+		return err
+	}
+	return s.updatePatient(p)
+}
+
+// updatePatient overwrites the record of an indexed patient.
+func (s *GoPatientStore) updatePatient(p Patient) error {
+	return s.writeIndexed(p.ID, p, "update patient")
+}
+
+// writeIndexed writes p over the record the index holds for ci. The loaded
+// copy is what reads back from the file, like after LoadPatients.
+func (s *GoPatientStore) writeIndexed(ci string, p Patient, op string) error {
+	slot, code := s.index.find(ci)
+	if code != 0 {
+		return errorFor(op, ci, code, 0)
+	}
+	position := s.index.entries[slot].position
+	if position >= len(s.patients) {
+		return &IOError{Op: op}
+	}
+	if err := writeRecordAt(s.files.patients, position, p, false); err != nil {
+		return err
+	}
+	s.patients[position] = stored(p)
+	return nil
+}
+
+// ScheduleAppointment books the appointment a and makes its date the
+// patient's appointment date, taking both back on failure as PatientService
+// does.
+func (s *GoPatientStore) ScheduleAppointment(a Appointment) (Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := requireTime(a, "schedule appointment"); err != nil {
+		return Appointment{}, err
+	}
+	a, err := s.prepareAppointment(a, "schedule appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	a, err = s.appointments.create(a)
+	if err != nil {
+		return Appointment{}, err
+	}
+	if err := appendWal(s.files.wal, walSchedule, Patient{ID: a.CI, AppointmentDate: a.Date}); err != nil {
+		return Appointment{}, errors.Join(err, s.appointments.drop(a))
+	}
+	if err := s.scheduleAppointment(a.CI, a.Date); err != nil {
+		return Appointment{}, errors.Join(err, dropWalEntry(s.files.wal), s.appointments.drop(a))
+	}
+	return a, nil
+}
+
+// prepareAppointment looks up the patient of a and prepares it in the
+// appointment book.
+func (s *GoPatientStore) prepareAppointment(a Appointment, op string) (Appointment, error) {
+	slot, code := s.index.find(a.CI)
+	if code != 0 {
+		return Appointment{}, errorFor(op, a.CI, code, 0)
+	}
+	return s.appointments.prepare(a, s.patients[s.index.entries[slot].position], op)
+}
+
+func (s *GoPatientStore) scheduleAppointment(ci string, date string) error {
+	slot, code := s.index.find(ci)
+	if code != 0 {
+		return errorFor("schedule appointment", ci, code, 0)
+	}
+	p, err := readRecordAt(s.files.patients, s.index.entries[slot].position)
+	if err != nil {
+		return err
+	}
+	p.AppointmentDate = date
+	return s.writeIndexed(ci, p, "schedule appointment")
+}
+
+func (s *GoPatientStore) DeletePatient(ci string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isIndexed(ci) {
+		return &NotFoundError{Op: "delete patient", CI: ci}
+	}
+	cancelled, err := s.appointments.cancelAll(ci)
+	if err != nil {
+		return err
+	}
+	if err := appendWal(s.files.wal, walDelete, Patient{ID: ci}); err != nil {
+		return errors.Join(err, s.appointments.reschedule(cancelled))
+	}
+	return s.deletePatient(ci)
+}
+
+// deletePatient empties the record and hands its slot to the free list.
+func (s *GoPatientStore) deletePatient(ci string) error {
+	slot, code := s.index.find(ci)
+	if code != 0 {
+		return errorFor("delete patient", ci, code, 0)
+	}
+	position := s.index.entries[slot].position
+	if err := s.writeIndexed(ci, Patient{}, "delete patient"); err != nil {
+		return err
+	}
+	s.index.remove(ci)
+	s.free = append(s.free, position)
+	return nil
+}
+
+// ListAppointments returns the history of a patient, oldest first.
+func (s *GoPatientStore) ListAppointments(ci string) ([]Appointment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.isIndexed(ci) {
+		return nil, &NotFoundError{Op: "list appointments", CI: ci}
+	}
+	return s.appointments.list(ci), nil
+}
+
+func (s *GoPatientStore) CreateAppointment(a Appointment) (Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.prepareAppointment(a, "create appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	return s.appointments.create(a)
+}
+
+func (s *GoPatientStore) CancelAppointment(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appointments.cancel(id)
+}
+
+// filter returns the stored patients matching keep, skipping empty slots.
+func (s *GoPatientStore) filter(keep func(p Patient) bool) []Patient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []Patient{}
+	for _, p := range s.patients {
+		if !isEmptyPatient(p) && keep(p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (s *GoPatientStore) ListPatients() ([]Patient, error) {
+	return s.filter(func(Patient) bool { return true }), nil
+}
+
+func (s *GoPatientStore) ListDisabledPatients() ([]Patient, error) {
+	return s.filter(func(p Patient) bool { return p.Disability }), nil
+}
+
+func (s *GoPatientStore) ListPatientsByAppointmentDate(date string) ([]Patient, error) {
+	return s.filter(func(p Patient) bool { return p.AppointmentDate == date }), nil
+}
+
+func (s *GoPatientStore) ListPatientsBySpecialty(specialty string) ([]Patient, error) {
+	return s.filter(func(p Patient) bool { return p.DocSpecialty == specialty }), nil
+}
+
+func (s *GoPatientStore) ListFemalePatients() ([]Patient, error) {
+	return s.filter(func(p Patient) bool { return p.Gender == 'F' }), nil
+}
+
+func (s *GoPatientStore) ListMalePatients() ([]Patient, error) {
+	return s.filter(func(p Patient) bool { return p.Gender == 'M' }), nil
+}
+
+func (s *GoPatientStore) ListPatientsUnderAge(ageLimit int) ([]Patient, error) {
+	// Ages of 0 or less are invalid and skipped, as in patient_metrics.c
+	return s.filter(func(p Patient) bool { return p.Age > 0 && p.Age < ageLimit }), nil
+}
+
+// Verify checks every record of patients.bin against its checksum and every
+// entry of index.dat against the record it points at.
+func (s *GoPatientStore) Verify() (*VerifyReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v := newVerifier()
+	if err := v.indexFile(s.files.index, s.files.wal); err != nil {
+		return nil, err
+	}
+
+	var corrupt []bool
+	patients, err := readPatientsFile(s.files.patients, &corrupt)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for i, p := range patients {
+		v.record(i, p.ID, corrupt[i])
+	}
+	return v.finish(), nil
+}
+
+// Compact rewrites patients.bin without the holes left by deleted patients
+// and moves the index to the new positions.
+func (s *GoPatientStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// compact is CompactPatients.
+func (s *GoPatientStore) compact() error {
+	return s.commitRecords(s.patients)
+}
+
+// commitRecords writes records, without the empty and duplicate ones, as the
+// new patients and index files and makes them the loaded state once both are
+// committed.
+func (s *GoPatientStore) commitRecords(records []Patient) error {
+	capacity := len(s.index.entries)
+	if capacity == 0 {
+		capacity = indexCapacity
+	}
+	compacted := newHashIndex(capacity)
+	live := make([]Patient, 0, len(records))
+	for _, p := range records {
+		if isEmptyPatient(p) {
+			continue
+		}
+		code := compacted.add(p.ID, len(live))
+		if code == codeDuplicate {
+			// Left over from before duplicates were rejected; only the
+			// first one was ever reachable
+			continue
+		}
+		if code != 0 {
+			return errorFor("compact patients", p.ID, code, 0)
+		}
+		live = append(live, p)
+	}
+
+	if err := s.files.writeBoth(live, &compacted); err != nil {
+		return err
+	}
+	s.patients = live
+	s.index = compacted
+	s.free = s.free[:0]
+	return nil
+}
+
+// Save writes the patients and index files atomically as a single commit and
+// clears the mutation log they now include.
+func (s *GoPatientStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+func (s *GoPatientStore) save() error {
+	if err := s.compact(); err != nil {
+		return err
+	}
+	if err := os.Remove(s.files.wal); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // there was no log to clear
+		}
+		return ioError("clear patient log", err)
+	}
+	return syncDir(s.files.dir)
+}
+
+// ImportPatients adds the patients as one commit, handling those already
+// stored by opts.OnConflict. Whatever was logged before is checkpointed
+// first, so the batch needs no log of its own: a crash leaves either all of
+// it or none.
+func (s *GoPatientStore) ImportPatients(patients []Patient, opts ImportOptions) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range patients {
+		if err := validatePatient(p); err != nil {
+			return nil, err
+		}
+	}
+	patients, conflicts, err := resolveConflicts(patients, opts.OnConflict, func(ci string) (bool, error) {
+		_, code := s.index.find(ci)
+		return code == 0, nil
+	})
+	if err != nil || opts.DryRun || len(patients) == 0 {
+		return conflicts, err
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	records := slices.Clone(s.patients)
+	added := map[string]int{}
+	for _, p := range patients {
+		position, ok := added[p.ID]
+		if slot, code := s.index.find(p.ID); code == 0 {
+			position, ok = s.index.entries[slot].position, true
+		}
+		if ok {
+			records[position] = stored(p)
+			continue
+		}
+		added[p.ID] = len(records)
+		records = append(records, stored(p))
+	}
+	if err := s.commitRecords(records); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,695 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// File handling for GoPatientStore, following csrc/patient_file.h for the
+// layout of patients.bin and csrc/patient.c for index.dat, the commit
+// protocol and the migrations.
+
+// Names of the files in a database directory, as in patient.h
+const (
+	patientFileName = "patients.bin"
+	indexFileName   = "index.dat"
+	walFileName     = "patients.wal"
+	commitFileName  = "commit"
+	tmpSuffix       = ".tmp"
+)
+
+const (
+	patientMagic         = "MDAP"
+	patientFormatVersion = 3
+	headerSize           = 32
+	encodedPatientSize   = 154
+	recordCRCSize        = 4
+	recordSize           = encodedPatientSize + recordCRCSize
+)
+
+// Mutation kinds of WalOp in patient_wal.h
+const (
+	walAdd      = 1
+	walUpdate   = 2
+	walSchedule = 3
+	walDelete   = 4
+)
+
+// patientLayout places the Patient fields in a record.
+type patientLayout struct {
+	ci, name, age, diagnosis, gender, disability, specialty, date int
+	size                                                          int
+}
+
+// Field sizes, NUL included
+const (
+	ciSize        = 9
+	nameSize      = 25 // NAME_LEN
+	diagnosisSize = 50 // DIAG_LEN
+	specialtySize = 50 // SPEC_LEN
+	dateSize      = 11
+)
+
+var (
+	// encodedLayout is the packed record of format version 3.
+	encodedLayout = patientLayout{0, 9, 34, 38, 88, 89, 93, 143, encodedPatientSize}
+	// rawLayout is the C Patient struct as laid out by gcc and clang on the
+	// little-endian 32 and 64-bit targets we build for. Format versions 0 to 2
+	// store it as is.
+	rawLayout = patientLayout{0, 9, 36, 40, 90, 92, 96, 146, 160}
+)
+
+const (
+	walEntrySize = 4 + encodedPatientSize // WAL_ENTRY_SIZE: u32 op, then the encoded patient
+	// WAL_FRAME_SIZE: the entry's length, the entry and its CRC-32
+	walFrameSize = 4 + walEntrySize + 4
+)
+
+func putString(dest []byte, s string) {
+	n := copy(dest, s)
+	clear(dest[n:])
+}
+
+// getString reads a NUL-padded field, always leaving room for the NUL.
+func getString(src []byte) string {
+	src = src[:len(src)-1]
+	if i := bytes.IndexByte(src, 0); i >= 0 {
+		src = src[:i]
+	}
+	return string(src)
+}
+
+func (l patientLayout) encode(dest []byte, p Patient) {
+	clear(dest[:l.size])
+	putString(dest[l.ci:l.ci+ciSize], p.ID)
+	putString(dest[l.name:l.name+nameSize], p.Name)
+	binary.LittleEndian.PutUint32(dest[l.age:], uint32(int32(p.Age)))
+	putString(dest[l.diagnosis:l.diagnosis+diagnosisSize], p.Diagnosis)
+	dest[l.gender] = p.Gender
+	if p.Disability {
+		binary.LittleEndian.PutUint32(dest[l.disability:], 1)
+	}
+	putString(dest[l.specialty:l.specialty+specialtySize], p.DocSpecialty)
+	putString(dest[l.date:l.date+dateSize], p.AppointmentDate)
+}
+
+func (l patientLayout) decode(src []byte) Patient {
+	return Patient{
+		ID:              getString(src[l.ci : l.ci+ciSize]),
+		Name:            getString(src[l.name : l.name+nameSize]),
+		Age:             int(int32(binary.LittleEndian.Uint32(src[l.age:]))),
+		Diagnosis:       getString(src[l.diagnosis : l.diagnosis+diagnosisSize]),
+		Gender:          src[l.gender],
+		Disability:      binary.LittleEndian.Uint32(src[l.disability:]) != 0,
+		DocSpecialty:    getString(src[l.specialty : l.specialty+specialtySize]),
+		AppointmentDate: getString(src[l.date : l.date+dateSize]),
+	}
+}
+
+// stored returns p as it reads back from the patients file.
+func stored(p Patient) Patient {
+	var buf [encodedPatientSize]byte
+	encodedLayout.encode(buf[:], p)
+	return encodedLayout.decode(buf[:])
+}
+
+func isEmptyPatient(p Patient) bool {
+	return p.ID == ""
+}
+
+func ioError(op string, err error) error {
+	return &IOError{Op: op, Errno: errnoOf(err)}
+}
+
+// fileHeader is the 32-byte header shared by patients.bin and
+// appointments.bin: magic, version, record size, record count and a
+// checksum of those.
+type fileHeader struct {
+	version     uint32
+	recordSize  uint32
+	recordCount uint64
+}
+
+// readFileHeader checks the magic and checksum of a header, not the version
+// or record size.
+func readFileHeader(r io.ReaderAt, magic string, op string) (fileHeader, error) {
+	var buf [headerSize]byte
+	if _, err := r.ReadAt(buf[:], 0); err != nil {
+		return fileHeader{}, &CodeError{Op: op, Code: codeFormat}
+	}
+	if string(buf[:4]) != magic || binary.LittleEndian.Uint32(buf[20:]) != crc32.ChecksumIEEE(buf[:20]) {
+		return fileHeader{}, &CodeError{Op: op, Code: codeFormat}
+	}
+	return fileHeader{
+		version:     binary.LittleEndian.Uint32(buf[4:]),
+		recordSize:  binary.LittleEndian.Uint32(buf[8:]),
+		recordCount: binary.LittleEndian.Uint64(buf[12:]),
+	}, nil
+}
+
+// checkRecordCount rejects a header claiming more records of `size` bytes
+// than file holds, before anything is allocated for them.
+func checkRecordCount(file *os.File, header fileHeader, size int, op string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return ioError(op, err)
+	}
+	if header.recordCount > uint64(max(info.Size()-headerSize, 0))/uint64(size) {
+		return &CodeError{Op: op, Code: codeFormat}
+	}
+	return nil
+}
+
+func writeFileHeader(w io.WriterAt, magic string, header fileHeader, op string) error {
+	var buf [headerSize]byte
+	copy(buf[:], magic)
+	binary.LittleEndian.PutUint32(buf[4:], header.version)
+	binary.LittleEndian.PutUint32(buf[8:], header.recordSize)
+	binary.LittleEndian.PutUint64(buf[12:], header.recordCount)
+	binary.LittleEndian.PutUint32(buf[20:], crc32.ChecksumIEEE(buf[:20]))
+	if _, err := w.WriteAt(buf[:], 0); err != nil {
+		return ioError(op, err)
+	}
+	return nil
+}
+
+// readRawHeader is ReadRawPatientHeader: the magic and checksum are checked,
+// the version and record size are not.
+func readRawHeader(r io.ReaderAt) (fileHeader, error) {
+	return readFileHeader(r, patientMagic, "read patients header")
+}
+
+// readHeader is ReadPatientHeader, for files in the current format.
+func readHeader(r io.ReaderAt) (fileHeader, error) {
+	header, err := readRawHeader(r)
+	if err != nil {
+		return header, err
+	}
+	if header.version != patientFormatVersion {
+		return header, &CodeError{Op: "read patients header", Code: codeVersion}
+	}
+	if header.recordSize != recordSize {
+		return header, &CodeError{Op: "read patients header", Code: codeFormat}
+	}
+	return header, nil
+}
+
+func writeHeader(w io.WriterAt, count int) error {
+	header := fileHeader{version: patientFormatVersion, recordSize: recordSize, recordCount: uint64(count)}
+	return writeFileHeader(w, patientMagic, header, "write patients header")
+}
+
+func recordOffset(position int) int64 {
+	return int64(headerSize) + int64(position)*recordSize
+}
+
+func encodeRecord(dest []byte, p Patient) {
+	encodedLayout.encode(dest, p)
+	binary.LittleEndian.PutUint32(dest[encodedPatientSize:], crc32.ChecksumIEEE(dest[:encodedPatientSize]))
+}
+
+// decodeRecord returns the patient even when the checksum doesn't match.
+func decodeRecord(src []byte) (Patient, bool) {
+	ok := binary.LittleEndian.Uint32(src[encodedPatientSize:]) == crc32.ChecksumIEEE(src[:encodedPatientSize])
+	return encodedLayout.decode(src), ok
+}
+
+// flushAndClose is FlushAndClose.
+func flushAndClose(file *os.File, op string) error {
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ioError(op, err)
+	}
+	return nil
+}
+
+// syncDir makes creations and renames inside dir durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return ioError("sync data directory", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return ioError("sync data directory", err)
+	}
+	return nil
+}
+
+// writePatientsFile writes the records to path in the current format and
+// flushes them to disk, dropping empty records when skipEmpty is set.
+func writePatientsFile(path string, patients []Patient, skipEmpty bool) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return ioError("write patients file", err)
+	}
+	buf := make([]byte, headerSize, headerSize+len(patients)*recordSize)
+	var record [recordSize]byte
+	written := 0
+	for _, p := range patients {
+		if skipEmpty && isEmptyPatient(p) {
+			continue
+		}
+		encodeRecord(record[:], p)
+		buf = append(buf, record[:]...)
+		written++
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return ioError("write patients file", err)
+	}
+	// Only claim the records once they are all written
+	if err := writeHeader(file, written); err != nil {
+		file.Close()
+		return err
+	}
+	return flushAndClose(file, "write patients file")
+}
+
+// readPatientsFile loads every record of path. A record failing its checksum
+// stops the read unless corrupt is given, in which case it is returned as
+// stored and flagged there.
+func readPatientsFile(path string, corrupt *[]bool) ([]Patient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, ioError("load patients", err)
+	}
+	defer file.Close()
+	header, err := readHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRecordCount(file, header, recordSize, "load patients"); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, int(header.recordCount)*recordSize)
+	if _, err := file.ReadAt(data, headerSize); err != nil {
+		return nil, ioError("load patients", err)
+	}
+	patients := make([]Patient, header.recordCount)
+	for i := range patients {
+		p, ok := decodeRecord(data[i*recordSize : (i+1)*recordSize])
+		if !ok && corrupt == nil {
+			return nil, &CodeError{Op: "load patients", Code: codeChecksum}
+		}
+		if corrupt != nil {
+			*corrupt = append(*corrupt, !ok)
+		}
+		patients[i] = p
+	}
+	return patients, nil
+}
+
+// readRecordAt reads the record at position, like GetPatient does after the
+// index lookup.
+func readRecordAt(path string, position int) (Patient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Patient{}, ioError("get patient", err)
+	}
+	defer file.Close()
+	header, err := readHeader(file)
+	if err != nil {
+		return Patient{}, err
+	}
+	if uint64(position) >= header.recordCount {
+		return Patient{}, &IOError{Op: "get patient"}
+	}
+	var buf [recordSize]byte
+	if _, err := file.ReadAt(buf[:], recordOffset(position)); err != nil {
+		return Patient{}, ioError("get patient", err)
+	}
+	p, ok := decodeRecord(buf[:])
+	if !ok {
+		return Patient{}, &CodeError{Op: "get patient", Code: codeChecksum}
+	}
+	return p, nil
+}
+
+// writeRecordAt overwrites the record at position, or appends it when
+// position is the record count. With create set a missing file is created
+// empty first.
+func writeRecordAt(path string, position int, p Patient, create bool) error {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return ioError("write patient", err)
+	}
+	if info, statErr := file.Stat(); statErr == nil && info.Size() == 0 && create {
+		err = writeHeader(file, 0)
+	}
+	var header fileHeader
+	if err == nil {
+		header, err = readHeader(file)
+	}
+	if err == nil && uint64(position) > header.recordCount {
+		err = &IOError{Op: "write patient"}
+	}
+	if err == nil {
+		var buf [recordSize]byte
+		encodeRecord(buf[:], p)
+		if _, writeErr := file.WriteAt(buf[:], recordOffset(position)); writeErr != nil {
+			err = ioError("write patient", writeErr)
+		}
+	}
+	// Appends only count once the record itself is written
+	if err == nil && uint64(position) >= header.recordCount {
+		err = writeHeader(file, position+1)
+	}
+	if closeErr := file.Close(); closeErr != nil && err == nil {
+		err = ioError("write patient", closeErr)
+	}
+	return err
+}
+
+// writeIndexFile writes the index.dat text format: the capacity first, then
+// one |CI|position| line per entry in bucket order.
+func writeIndexFile(path string, index *hashIndex) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#capacity|%d|\n", len(index.entries))
+	for _, entry := range index.entries {
+		if entry.ci == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "|%s|%d|\n", entry.ci, entry.position)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return ioError("write index", err)
+	}
+	if _, err := file.WriteString(b.String()); err != nil {
+		file.Close()
+		return ioError("write index", err)
+	}
+	return flushAndClose(file, "write index")
+}
+
+// indexLine is one |CI|position| entry of index.dat.
+type indexLine struct {
+	ci       string
+	position int
+}
+
+// readIndexLines parses index.dat as written: the capacity it records, 0 if
+// none, and its entries in file order.
+func readIndexLines(path string) (int, []indexLine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil, ioError("load index", err)
+	}
+	capacity := 0
+	var entries []indexLine
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		// "#capacity|N|" or "|CI|position|"
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 {
+			return 0, nil, &CodeError{Op: "load index", Code: codeParseLine}
+		}
+		if fields[0] == "#capacity" {
+			value, err := strconv.ParseUint(fields[1], 10, strconv.IntSize-1)
+			if err != nil {
+				return 0, nil, &CodeError{Op: "load index", Code: codeParseLine}
+			}
+			capacity = int(value)
+			continue
+		}
+		position, err := strconv.ParseUint(fields[2], 10, strconv.IntSize-1)
+		if fields[0] != "" || fields[1] == "" || err != nil {
+			return 0, nil, &CodeError{Op: "load index", Code: codeParseLine}
+		}
+		entries = append(entries, indexLine{ci: fields[1], position: int(position)})
+	}
+	return capacity, entries, nil
+}
+
+// readIndexFile is LoadIndex.
+func readIndexFile(path string) (hashIndex, error) {
+	capacity, entries, err := readIndexLines(path)
+	if err != nil {
+		return hashIndex{}, err
+	}
+	if capacity == 0 {
+		capacity = indexCapacity
+	}
+	index := newHashIndex(capacity)
+	for _, entry := range entries {
+		if code := index.add(entry.ci, entry.position); code != 0 {
+			return hashIndex{}, errorFor("load index", entry.ci, code, 0)
+		}
+	}
+	return index, nil
+}
+
+// appendWal logs a mutation and flushes it to disk, like AppendWal.
+func appendWal(path string, op int, p Patient) error {
+	var frame [walFrameSize]byte
+	entry := frame[4 : 4+walEntrySize]
+	binary.LittleEndian.PutUint32(entry, uint32(op))
+	encodedLayout.encode(entry[4:], p)
+	binary.LittleEndian.PutUint32(frame[:], walEntrySize)
+	binary.LittleEndian.PutUint32(frame[4+walEntrySize:], crc32.ChecksumIEEE(entry))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return ioError("write patient log", err)
+	}
+	if _, err := file.Write(frame[:]); err != nil {
+		file.Close()
+		return ioError("write patient log", err)
+	}
+	return flushAndClose(file, "write patient log")
+}
+
+// dropWalEntry takes back the entry appendWal last wrote to path, when the
+// mutation it logged can't be applied.
+func dropWalEntry(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return ioError("drop patient log entry", err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < walFrameSize {
+		err = fmt.Errorf("log has %d bytes, less than an entry", info.Size())
+	}
+	if err == nil {
+		err = file.Truncate(info.Size() - walFrameSize)
+	}
+	if err != nil {
+		file.Close()
+		return ioError("drop patient log entry", err)
+	}
+	return flushAndClose(file, "drop patient log entry")
+}
+
+type walEntry struct {
+	op      int
+	patient Patient
+}
+
+// readWal returns the logged mutations up to the first entry that is torn or
+// fails its checksum, like ReplayWal.
+func readWal(path string) ([]walEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil // nothing logged since the last checkpoint
+	}
+	if err != nil {
+		return nil, ioError("replay patient log", err)
+	}
+	entries := make([]walEntry, 0, len(data)/walFrameSize)
+	for ; len(data) >= walFrameSize; data = data[walFrameSize:] {
+		entry := data[4 : 4+walEntrySize]
+		if binary.LittleEndian.Uint32(data) != walEntrySize ||
+			binary.LittleEndian.Uint32(data[4+walEntrySize:]) != crc32.ChecksumIEEE(entry) {
+			break
+		}
+		entries = append(entries, walEntry{
+			op:      int(int32(binary.LittleEndian.Uint32(entry))),
+			patient: encodedLayout.decode(entry[4:]),
+		})
+	}
+	return entries, nil
+}
+
+// walExists reports whether a log is left at path, so one whose entries were
+// all torn or damaged is still cleared instead of having appends land behind
+// the garbage.
+func walExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ioError("replay patient log", err)
+	}
+	return true, nil
+}
+
+// databaseFiles are the paths of one database directory.
+type databaseFiles struct {
+	dir, patients, patientsTmp, index, indexTmp, commitMarker, wal string
+}
+
+func newDatabaseFiles(dir string) databaseFiles {
+	return databaseFiles{
+		dir:          dir,
+		patients:     filepath.Join(dir, patientFileName),
+		patientsTmp:  filepath.Join(dir, patientFileName+tmpSuffix),
+		index:        filepath.Join(dir, indexFileName),
+		indexTmp:     filepath.Join(dir, indexFileName+tmpSuffix),
+		commitMarker: filepath.Join(dir, commitFileName),
+		wal:          filepath.Join(dir, walFileName),
+	}
+}
+
+// replace moves a fully written temporary file over its target.
+func (f databaseFiles) replace(tmpPath, path string) error {
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return ioError("replace "+filepath.Base(path), err)
+	}
+	return syncDir(f.dir)
+}
+
+// recover is RecoverFiles: roll a committed save forward, or discard the
+// leftovers of an interrupted one.
+func (f databaseFiles) recover() error {
+	if _, err := os.Stat(f.commitMarker); err != nil {
+		os.Remove(f.patientsTmp)
+		os.Remove(f.indexTmp)
+		return nil
+	}
+	for _, pair := range [][2]string{{f.patientsTmp, f.patients}, {f.indexTmp, f.index}} {
+		if _, err := os.Stat(pair[0]); err != nil {
+			continue
+		}
+		if err := os.Rename(pair[0], pair[1]); err != nil {
+			return ioError("recover data files", err)
+		}
+	}
+	if err := syncDir(f.dir); err != nil {
+		return err
+	}
+	if err := os.Remove(f.commitMarker); err != nil {
+		return ioError("recover data files", err)
+	}
+	return syncDir(f.dir)
+}
+
+// commit is CommitFiles: once the marker is on disk the save can no longer
+// be lost.
+func (f databaseFiles) commit() error {
+	marker, err := os.Create(f.commitMarker)
+	if err != nil {
+		return ioError("commit data files", err)
+	}
+	err = flushAndClose(marker, "commit data files")
+	if err == nil {
+		err = syncDir(f.dir)
+	}
+	if err != nil {
+		os.Remove(f.commitMarker)
+		return err
+	}
+	return f.recover()
+}
+
+// writeBoth writes the patients, without empty records, and the index aside
+// and commits them together.
+func (f databaseFiles) writeBoth(patients []Patient, index *hashIndex) error {
+	err := writePatientsFile(f.patientsTmp, patients, true)
+	if err == nil {
+		err = writeIndexFile(f.indexTmp, index)
+	}
+	if err != nil {
+		os.Remove(f.patientsTmp)
+		os.Remove(f.indexTmp)
+		return err
+	}
+	return f.commit()
+}
+
+// migrate is MigratePatientsFile, returning the version the file had.
+func (f databaseFiles) migrate() (int, error) {
+	data, err := os.ReadFile(f.patients)
+	if errors.Is(err, fs.ErrNotExist) {
+		return patientFormatVersion, nil // nothing to migrate
+	}
+	if err != nil {
+		return 0, ioError("migrate patients file", err)
+	}
+
+	header, err := readRawHeader(bytes.NewReader(data))
+	if err == nil && header.version == patientFormatVersion {
+		return patientFormatVersion, nil
+	}
+	if err != nil && bytes.HasPrefix(data, []byte(patientMagic)) {
+		// A damaged header, not a file that never had one
+		return 0, &CodeError{Op: "migrate patients file", Code: codeFormat}
+	}
+
+	var from int
+	var legacy []Patient
+	switch {
+	case err != nil:
+		// Version 0: no header, the whole file is raw Patient structs
+		legacy, err = readLegacyRecords(data, rawLayout.size, -1)
+	case header.version == 1 && header.recordSize == uint32(rawLayout.size):
+		from = 1
+		legacy, err = readLegacyRecords(data[headerSize:], rawLayout.size, int(header.recordCount))
+	case header.version == 2 && header.recordSize == uint32(rawLayout.size+recordCRCSize):
+		from = 2
+		legacy, err = readLegacyRecords(data[headerSize:], int(header.recordSize), int(header.recordCount))
+	default:
+		// A header from a version this build doesn't know how to read
+		err = &CodeError{Op: "migrate patients file", Code: codeVersion}
+	}
+	if err != nil {
+		return from, err
+	}
+
+	// Keep empty records so every position in index.dat stays valid
+	if err := writePatientsFile(f.patientsTmp, legacy, false); err != nil {
+		os.Remove(f.patientsTmp)
+		return from, err
+	}
+	return from, f.replace(f.patientsTmp, f.patients)
+}
+
+// readLegacyRecords decodes raw Patient structs of `stride` bytes, checking
+// the CRC-32 that version 2 appends to each. count is -1 to read to the end.
+func readLegacyRecords(data []byte, stride int, count int) ([]Patient, error) {
+	var patients []Patient
+	for ; len(data) >= stride && count != len(patients); data = data[stride:] {
+		if stride > rawLayout.size {
+			crc := binary.LittleEndian.Uint32(data[rawLayout.size:])
+			if crc != crc32.ChecksumIEEE(data[:rawLayout.size]) {
+				return nil, &CodeError{Op: "migrate patients file", Code: codeChecksum}
+			}
+		}
+		patients = append(patients, rawLayout.decode(data))
+	}
+	if count >= 0 && len(patients) < count {
+		return nil, &IOError{Op: "migrate patients file"} // truncated file
+	}
+	return patients, nil
+}
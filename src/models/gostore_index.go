@@ -0,0 +1,171 @@
+package models
+
+// Go port of the index in csrc/patient.c: a coalesced hash table keyed by the
+// numeric value of the CI, with collision chains linked through `next` and
+// tombstones keeping them intact after removals. Porting it rather than using
+// a map keeps index.dat and the bucket numbers in PatientResponse.Index the
+// same whichever backend wrote them. Like the C functions, the methods return
+// the codes of csrc/errors.h, 0 on success.
+
+const (
+	indexCapacity = 1000 // INDEX_CAPACITY
+	indexMaxLoad  = 0.75 // INDEX_MAX_LOAD
+)
+
+type indexEntry struct {
+	ci       string
+	position int
+	next     int
+	deleted  bool
+}
+
+// hashIndex is the Index struct; the zero value is empty and allocates its
+// buckets on the first add.
+type hashIndex struct {
+	entries    []indexEntry
+	count      int
+	tombstones int
+}
+
+func newHashIndex(capacity int) hashIndex {
+	entries := make([]indexEntry, capacity)
+	for i := range entries {
+		entries[i].next = -1
+	}
+	return hashIndex{entries: entries}
+}
+
+// hashCI parses an 8-digit CI and reduces it to a bucket, like Hash.
+func hashCI(ci string, capacity int) (int, int) {
+	if capacity == 0 {
+		return 0, codeIndexRange
+	}
+	if len(ci) != 8 {
+		return 0, codeFieldCIFormat
+	}
+	value := 0
+	for i := 0; i < len(ci); i++ {
+		if ci[i] < '0' || ci[i] > '9' {
+			return 0, codeFieldCIFormat
+		}
+		value = value*10 + int(ci[i]-'0')
+	}
+	return value % capacity, 0
+}
+
+// insert places an entry without checking the load factor.
+func (x *hashIndex) insert(entry indexEntry) int {
+	hash, code := hashCI(entry.ci, len(x.entries))
+	if code != 0 {
+		return code
+	}
+
+	buckets := x.entries
+	if buckets[hash].ci == "" {
+		// A reused tombstone keeps its link, other chains may pass through it
+		next := -1
+		if buckets[hash].deleted {
+			next = buckets[hash].next
+			x.tombstones--
+		}
+		buckets[hash] = entry
+		buckets[hash].next = next
+		buckets[hash].deleted = false
+		x.count++
+		return 0
+	}
+
+	// Take the next free bucket and link it right after the home bucket
+	for step := 1; step < len(buckets); step++ {
+		i := (hash + step) % len(buckets)
+		if buckets[i].ci != "" || buckets[i].deleted {
+			continue
+		}
+		buckets[i] = entry
+		buckets[i].next = buckets[hash].next
+		buckets[hash].next = i
+		x.count++
+		return 0
+	}
+	return codeOutOfRange
+}
+
+// resize rehashes the live entries into `capacity` buckets, dropping tombstones.
+func (x *hashIndex) resize(capacity int) int {
+	if capacity < x.count {
+		return codeIndexRange
+	}
+	resized := newHashIndex(capacity)
+	for _, entry := range x.entries {
+		if entry.ci == "" {
+			continue
+		}
+		if code := resized.insert(entry); code != 0 {
+			return code
+		}
+	}
+	*x = resized
+	return 0
+}
+
+// add is NewPatientIndex.
+func (x *hashIndex) add(ci string, position int) int {
+	if len(ci) != 8 {
+		return codeFieldCIFormat
+	}
+	if _, code := x.find(ci); code == 0 {
+		return codeDuplicate
+	}
+
+	capacity := float64(len(x.entries))
+	code := 0
+	switch {
+	case x.entries == nil:
+		*x = newHashIndex(indexCapacity)
+	case float64(x.count+1) > capacity*indexMaxLoad:
+		code = x.resize(len(x.entries) * 2)
+	case float64(x.count+x.tombstones+1) > capacity*indexMaxLoad:
+		// Mostly tombstones: rehash in place to clear them out
+		code = x.resize(len(x.entries))
+	}
+	if code != 0 {
+		return code
+	}
+	return x.insert(indexEntry{ci: ci, position: position, next: -1})
+}
+
+// find is FindPatientIndex: the bucket holding ci.
+func (x *hashIndex) find(ci string) (int, int) {
+	if x.entries == nil {
+		return 0, codeNotFound
+	}
+	hash, code := hashCI(ci, len(x.entries))
+	if code != 0 {
+		return 0, codeInvalidArg
+	}
+
+	buckets := x.entries
+	if buckets[hash].ci == "" && !buckets[hash].deleted {
+		return 0, codeNotFound
+	}
+	for i := hash; i != -1; i = buckets[i].next {
+		if !buckets[i].deleted && buckets[i].ci == ci {
+			return i, 0
+		}
+	}
+	return 0, codeNotFound
+}
+
+// remove is RemovePatientIndex, leaving a tombstone behind.
+func (x *hashIndex) remove(ci string) int {
+	slot, code := x.find(ci)
+	if code != 0 {
+		return code
+	}
+	x.entries[slot].ci = ""
+	x.entries[slot].position = 0
+	x.entries[slot].deleted = true
+	x.count--
+	x.tombstones++
+	return 0
+}
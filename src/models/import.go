@@ -0,0 +1,366 @@
+package models
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// datFields is the number of fields on a patients.dat line:
+// CI|Name|Age|Diagnosis|Gender|Disability|Specialty|Date
+const datFields = 8
+
+// checkPatient validates a patient before it is imported. It is the C
+// NewPatient when the engine is built in, and its Go mirror otherwise.
+var checkPatient = validatePatient
+
+// ErrImportRejected is returned, wrapped, when rows of a CSV import were
+// rejected and so nothing was imported.
+var ErrImportRejected = errors.New("import rejected")
+
+// LineError is a line of an imported file that was rejected.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// ImportReport is the outcome of an import. In a dry run the counts are what
+// would have been done.
+type ImportReport struct {
+	Added   int // new patients
+	Updated int // patients already in the store, overwritten
+	Skipped int // patients already in the store, left as they were
+	Errors  []*LineError
+}
+
+// ConflictPolicy says what a CSV import does with a CI already in the store.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy accepts "skip", "overwrite" or "fail".
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, want %q, %q or %q", name, ConflictSkip, ConflictOverwrite, ConflictFail)
+}
+
+// CSVImportOptions tune ImportPatientsCSV.
+type CSVImportOptions struct {
+	// DryRun checks every row and reports what would be done, without
+	// changing the store.
+	DryRun     bool
+	OnConflict ConflictPolicy
+}
+
+// ImportOptions tune PatientStore.ImportPatients.
+type ImportOptions struct {
+	// OnConflict handles the patients already in the store. Left empty it
+	// is ConflictOverwrite.
+	OnConflict ConflictPolicy
+	// DryRun checks the batch against the store without changing it.
+	DryRun bool
+}
+
+// resolveConflicts splits a batch by whether inStore finds each CI, applying
+// policy. It returns the patients to write and the CIs already in the store.
+// Stores call it under the lock they write the batch with.
+func resolveConflicts(patients []Patient, policy ConflictPolicy, inStore func(ci string) (bool, error)) ([]Patient, []string, error) {
+	var batch []Patient
+	var conflicts []string
+	for _, p := range patients {
+		found, err := inStore(p.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if found {
+			conflicts = append(conflicts, p.ID)
+			if policy == ConflictSkip || policy == ConflictFail {
+				continue
+			}
+		}
+		batch = append(batch, p)
+	}
+	if policy == ConflictFail && len(conflicts) > 0 {
+		return nil, conflicts, &DuplicateError{CI: conflicts[0]}
+	}
+	return batch, conflicts, nil
+}
+
+// importRow is a patient read from a file, with the line it came from.
+type importRow struct {
+	line    int
+	patient Patient
+}
+
+// rowReader returns the fields of the next row of a file, in patients.dat
+// order, and its line number. A malformed row comes back as a *LineError;
+// io.EOF ends the file, and any other error aborts the import.
+type rowReader func() (fields []string, line int, err error)
+
+// readRows turns every row of next into a patient validated by checkPatient.
+// A CI seen on an earlier row is rejected as a duplicate.
+func readRows(next rowReader) ([]importRow, []*LineError, error) {
+	var rows []importRow
+	var rejected []*LineError
+	seen := map[string]int{}
+	for {
+		fields, line, err := next()
+		if err == io.EOF {
+			return rows, rejected, nil
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			rejected = append(rejected, lineErr)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p, err := patientFromFields(fields)
+		if err == nil {
+			err = checkPatient(p)
+		}
+		if err == nil {
+			if first, ok := seen[p.ID]; ok {
+				err = fmt.Errorf("%w (also on line %d)", &DuplicateError{CI: p.ID}, first)
+			}
+		}
+		if err != nil {
+			rejected = append(rejected, &LineError{Line: line, Err: err})
+			continue
+		}
+		seen[p.ID] = line
+		rows = append(rows, importRow{line: line, patient: p})
+	}
+}
+
+// patientFromFields builds a Patient from the fields of a row, in
+// patients.dat order. Field contents are left for checkPatient.
+func patientFromFields(fields []string) (Patient, error) {
+	age, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+	if err != nil {
+		return Patient{}, &ValidationError{Op: "parse patient line", Field: "Age", Code: codeFieldAgeInvalid}
+	}
+	if len(fields[4]) != 1 {
+		return Patient{}, &ValidationError{Op: "parse patient line", Field: "Gender", Code: codeFieldGenderInvalid}
+	}
+	var disability bool
+	switch fields[5] {
+	case "0":
+	case "1":
+		disability = true
+	default:
+		return Patient{}, &CodeError{Op: fmt.Sprintf("parse patient line (disability %q, want 0 or 1)", fields[5]), Code: codeParseLine}
+	}
+	return Patient{
+		ID:              fields[0],
+		Name:            fields[1],
+		Age:             age,
+		Diagnosis:       fields[3],
+		Gender:          fields[4][0],
+		Disability:      disability,
+		DocSpecialty:    fields[6],
+		AppointmentDate: fields[7],
+	}, nil
+}
+
+// datRows reads patients.dat lines, skipping blank ones.
+func datRows(r io.Reader) rowReader {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	return func() ([]string, int, error) {
+		for scanner.Scan() {
+			lineNo++
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fields := strings.Split(line, "|")
+			if len(fields) != datFields {
+				return nil, lineNo, &LineError{Line: lineNo, Err: &CodeError{
+					Op:   fmt.Sprintf("parse patient line (%d fields, want %d)", len(fields), datFields),
+					Code: codeParseLine,
+				}}
+			}
+			return fields, lineNo, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, lineNo, &IOError{Op: "read patients file", Errno: errnoOf(err)}
+		}
+		return nil, lineNo, io.EOF
+	}
+}
+
+// csvRows reads a CSV file whose header names the columns of an export, in
+// any order. A header that doesn't is an error for the whole file.
+func csvRows(r io.Reader) (rowReader, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, &CodeError{Op: "read CSV header (empty file)", Code: codeFormat}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := make([]int, len(csvHeader))
+	for i := range columns {
+		columns[i] = -1
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		field := slices.Index(csvHeader, name)
+		if field < 0 {
+			return nil, &CodeError{Op: fmt.Sprintf("read CSV header (unknown column %q)", name), Code: codeFormat}
+		}
+		if columns[field] >= 0 {
+			return nil, &CodeError{Op: fmt.Sprintf("read CSV header (column %q repeated)", name), Code: codeFormat}
+		}
+		columns[field] = i
+	}
+	for field, column := range columns {
+		if column < 0 {
+			return nil, &CodeError{Op: fmt.Sprintf("read CSV header (missing column %q)", csvHeader[field]), Code: codeFormat}
+		}
+	}
+
+	return func() ([]string, int, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.StartLine, &LineError{Line: parseErr.StartLine, Err: &CodeError{
+				Op:   "parse CSV row (" + parseErr.Err.Error() + ")",
+				Code: codeParseLine,
+			}}
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read CSV row: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		fields := make([]string, len(columns))
+		for field, column := range columns {
+			fields[field] = record[column]
+		}
+		return fields, line, nil
+	}, nil
+}
+
+func sortLineErrors(errs []*LineError) {
+	slices.SortFunc(errs, func(a, b *LineError) int { return cmp.Compare(a.Line, b.Line) })
+}
+
+// ImportPatientsDat adds the patients of a patients.dat file to the store in
+// one batch. Lines that don't parse or validate, and patients already in the
+// store, are reported and left out; the rest are imported all or nothing.
+// With dryRun the report is made without changing the store.
+func ImportPatientsDat(store PatientStore, r io.Reader, dryRun bool) (*ImportReport, error) {
+	rows, rejected, err := readRows(datRows(r))
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := store.ImportPatients(rowPatients(rows), ImportOptions{OnConflict: ConflictSkip, DryRun: dryRun})
+	if err != nil {
+		return nil, err
+	}
+	inStore := ciSet(conflicts)
+	report := &ImportReport{Errors: rejected}
+	for _, row := range rows {
+		if inStore[row.patient.ID] {
+			report.Errors = append(report.Errors, &LineError{Line: row.line, Err: &DuplicateError{CI: row.patient.ID}})
+			continue
+		}
+		report.Added++
+	}
+	sortLineErrors(report.Errors)
+	return report, nil
+}
+
+// ImportPatientsCSV loads the patients of a CSV file, laid out as written by
+// WritePatientsCSV, in one batch. Every row is checked as by AddPatient and
+// UpdatePatient, and rows whose CI is already in the store are handled by
+// opts.OnConflict; under ConflictFail they are rejected. If any row is
+// rejected nothing is imported and the error matches ErrImportRejected; the
+// report lists the rows either way.
+func ImportPatientsCSV(store PatientStore, r io.Reader, opts CSVImportOptions) (*ImportReport, error) {
+	policy, err := ParseConflictPolicy(string(opts.OnConflict))
+	if err != nil {
+		return nil, err
+	}
+	next, err := csvRows(r)
+	if err != nil {
+		return nil, err
+	}
+	rows, rejected, err := readRows(next)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows rejected already mean nothing is imported, but the store is still
+	// asked which of the others it holds, for the report
+	conflicts, err := store.ImportPatients(rowPatients(rows), ImportOptions{
+		OnConflict: policy,
+		DryRun:     opts.DryRun || len(rejected) > 0,
+	})
+	if err != nil && !(policy == ConflictFail && errors.Is(err, ErrDuplicate)) {
+		return nil, err
+	}
+	inStore := ciSet(conflicts)
+	report := &ImportReport{Errors: rejected}
+	for _, row := range rows {
+		switch {
+		case !inStore[row.patient.ID]:
+			report.Added++
+		case policy == ConflictSkip:
+			report.Skipped++
+		case policy == ConflictOverwrite:
+			report.Updated++
+		default:
+			report.Errors = append(report.Errors, &LineError{Line: row.line, Err: &DuplicateError{CI: row.patient.ID}})
+		}
+	}
+	sortLineErrors(report.Errors)
+
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("%w: %d rows rejected, nothing imported", ErrImportRejected, len(report.Errors))
+	}
+	return report, nil
+}
+
+func ciSet(cis []string) map[string]bool {
+	set := make(map[string]bool, len(cis))
+	for _, ci := range cis {
+		set[ci] = true
+	}
+	return set
+}
+
+func rowPatients(rows []importRow) []Patient {
+	patients := make([]Patient, len(rows))
+	for i, row := range rows {
+		patients[i] = row.patient
+	}
+	return patients
+}
@@ -14,18 +14,49 @@ import (
 */
 import "C"
 
-// Wrapper for ListDisabledPatients function from patient_metrics.h
-func (s *PatientService) ListDisabledPatients() ([]Patient, error) {
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListDisabledPatients(&s.patients[0], s.max_patients, &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing disabled patients: %s", ErrorDescription(errCode))
+// metricFunc adapts one of the patient_metrics.h list functions to a single page.
+type metricFunc func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int
+
+// filterPages runs a metric over patients.bin one page at a time, so the
+// result can be built for any number of patients without loading them all.
+func (s *PatientService) filterPages(filter metricFunc) ([]Patient, error) {
+	var page, dest [C.PAGE_SIZE]C.Patient
+	result := []Patient{}
+	for offset := C.size_t(0); ; {
+		var read C.size_t
+		errCode, errno := C.LoadPatientsPage(&s.db, &page[0], offset, C.PAGE_SIZE, &read)
+		if errCode != 0 {
+			return nil, codeError("read patients page", "", errCode, errno)
+		}
+		if read == 0 {
+			break
+		}
+
+		var resultCount C.size_t
+		errCode = filter(&page[0], read, &dest[0], &resultCount)
+		if errCode != 0 {
+			return nil, codeError("filter patients", "", errCode, nil)
+		}
+		for i := 0; i < int(resultCount); i++ {
+			result = append(result, ParseCPatient(&dest[i]))
+		}
+
+		offset += read
 	}
 
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	return result, nil
+}
+
+// Wrapper for ListDisabledPatients function from patient_metrics.h
+func (s *PatientService) ListDisabledPatients() ([]Patient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListDisabledPatients(page, count, dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing disabled patients: %w", err)
 	}
 
 	return result, nil
@@ -33,19 +64,17 @@ func (s *PatientService) ListDisabledPatients() ([]Patient, error) {
 
 // Wrapper for ListPatientsByAppointmentDate function from patient_metrics.h
 func (s *PatientService) ListPatientsByAppointmentDate(date string) ([]Patient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	cDate := C.CString(date)
 	defer C.free(unsafe.Pointer(cDate))
 
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListPatientsByAppointmentDate(&s.patients[0], s.max_patients, cDate, &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing patients by appointment date: %s", ErrorDescription(errCode))
-	}
-
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListPatientsByAppointmentDate(page, count, cDate, dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing patients by appointment date: %w", err)
 	}
 
 	return result, nil
@@ -53,19 +82,17 @@ func (s *PatientService) ListPatientsByAppointmentDate(date string) ([]Patient,
 
 // Wrapper for ListPatientsBySpecialty function from patient_metrics.h
 func (s *PatientService) ListPatientsBySpecialty(specialty string) ([]Patient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	cSpecialty := C.CString(specialty)
 	defer C.free(unsafe.Pointer(cSpecialty))
 
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListPatientsBySpecialty(&s.patients[0], s.max_patients, cSpecialty, &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing patients by specialty: %s", ErrorDescription(errCode))
-	}
-
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListPatientsBySpecialty(page, count, cSpecialty, dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing patients by specialty: %w", err)
 	}
 
 	return result, nil
@@ -73,16 +100,14 @@ func (s *PatientService) ListPatientsBySpecialty(specialty string) ([]Patient, e
 
 // Wrapper for ListFemalePatients function from patient_metrics.h
 func (s *PatientService) ListFemalePatients() ([]Patient, error) {
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListFemalePatients(&s.patients[0], s.max_patients, &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing female patients: %s", ErrorDescription(errCode))
-	}
-
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListFemalePatients(page, count, dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing female patients: %w", err)
 	}
 
 	return result, nil
@@ -90,16 +115,14 @@ func (s *PatientService) ListFemalePatients() ([]Patient, error) {
 
 // Wrapper for ListMalePatients function from patient_metrics.h
 func (s *PatientService) ListMalePatients() ([]Patient, error) {
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListMalePatients(&s.patients[0], s.max_patients, &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing male patients: %s", ErrorDescription(errCode))
-	}
-
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListMalePatients(page, count, dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing male patients: %w", err)
 	}
 
 	return result, nil
@@ -107,16 +130,14 @@ func (s *PatientService) ListMalePatients() ([]Patient, error) {
 
 // Wrapper for ListPatientsUnderAge function from patient_metrics.h
 func (s *PatientService) ListPatientsUnderAge(ageLimit int) ([]Patient, error) {
-	var resultCount C.size_t
-	var dest [C.MAX_PATIENTS]C.Patient
-	errCode := C.ListPatientsUnderAge(&s.patients[0], s.max_patients, C.int(ageLimit), &dest[0], &resultCount)
-	if errCode != 0 {
-		return nil, fmt.Errorf("error listing patients under age %d: %s", ageLimit, ErrorDescription(errCode))
-	}
-
-	result := make([]Patient, resultCount)
-	for i := 0; i < int(resultCount); i++ {
-		result[i] = ParseCPatient(&dest[i])
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, err := s.filterPages(func(page *C.Patient, count C.size_t, dest *C.Patient, resultCount *C.size_t) C.int {
+		return C.ListPatientsUnderAge(page, count, C.int(ageLimit), dest, resultCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing patients under age %d: %w", ageLimit, err)
 	}
 
 	return result, nil
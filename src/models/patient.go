@@ -3,64 +3,83 @@ package models
 /*
 #cgo CFLAGS: -I${SRCDIR}/../../csrc -DCGO_BUILD
 #include "patient.h"
+#include "patient_file.h"
 #include "errors.h"
 #include "patient_metrics.h"
+#include "patient_wal.h"
 #include <stdlib.h>
+#include <string.h>
 */
 import "C"
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"sync"
 	"unsafe"
-
-	"github.com/sanity-io/litter"
 )
 
-type Gender byte
+// PatientService is safe for concurrent use. Lookups and listings share a
+// read lock; anything that changes the C state or writes the data files
+// takes the write lock.
+type PatientService struct {
+	mu       sync.RWMutex
+	db       C.Database    // paths of the data files
+	patients C.PatientList // heap-allocated in C, grows as patients are loaded
+	index    C.Index       // heap-allocated in C, rehashed as it fills up
+	free     C.FreeList    // file positions left empty by deleted patients
 
-func (g Gender) String() string {
-	switch g {
-	case 'M':
-		return "Male"
-	case 'F':
-		return "Female"
-	default:
-		return "Unknown"
-	}
+	appointments appointmentBook // kept by the Go side, see appointment_file.go
 }
 
-type Patient struct {
-	ID              string
-	Name            string
-	Age             int
-	Diagnosis       string
-	Gender          byte
-	Disability      bool
-	DocSpecialty    string
-	AppointmentDate string
+// NewPatientService creates a service for the database in dataDir. The files
+// are not touched until Open.
+func NewPatientService(dataDir string) (*PatientService, error) {
+	s := &PatientService{
+		patients: C.PatientList{},
+		index:    C.Index{},
+		free:     C.FreeList{},
+	}
+
+	cDir := C.CString(dataDir)
+	defer C.free(unsafe.Pointer(cDir))
+	if errCode := C.OpenDatabase(&s.db, cDir); errCode != 0 {
+		return nil, codeError("open database "+dataDir, "", errCode, nil)
+	}
+	return s, nil
 }
 
-type PatientIndex struct {
-	CI       string // up to 8 characters
-	Position uint   // index in the patients slice
+func init() {
+	checkPatient = func(p Patient) error {
+		_, err := NewPatient(p)
+		return err
+	}
+	backends["cgo"] = func(dataDir string) (PatientStore, error) {
+		s, err := NewPatientService(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
 }
 
-type PatientService struct {
-	patients       [C.MAX_PATIENTS]C.Patient
-	count_patients C.size_t
-	max_patients   C.size_t
-	index          C.Index
-	max_index      C.size_t
+var _ PatientStore = (*PatientService)(nil)
+
+// DataDir is the directory holding the service's data files.
+func (s *PatientService) DataDir() string {
+	return C.GoString(&s.db.dir[0])
 }
 
-func NewPatientService() PatientService {
-	return PatientService{
-		patients:       [C.MAX_PATIENTS]C.Patient{},
-		count_patients: 0,
-		max_patients:   C.MAX_PATIENTS,
-		index:          C.Index{},
-		max_index:      C.MAX_INDEX,
-	}
+// Close releases the C memory held by the service.
+func (s *PatientService) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	C.FreePatientList(&s.patients)
+	C.FreeIndex(&s.index)
+	C.FreeFreeList(&s.free)
+	s.appointments.close()
 }
 
 func NewPatient(p Patient) (C.Patient, error) {
@@ -85,33 +104,29 @@ func NewPatient(p Patient) (C.Patient, error) {
 		disabilityInt = 0
 	}
 
-	errCode := C.NewPatient(&c_patient, id, name, C.int(p.Age), diagnosis, C.char(p.Gender), disabilityInt, docSpecialty, appointmentDate)
+	errCode, errno := C.NewPatient(&c_patient, id, name, C.int(p.Age), diagnosis, C.char(p.Gender), disabilityInt, docSpecialty, appointmentDate)
 	if errCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return c_patient, fmt.Errorf("error creating patient: %s", errMsg)
+		return c_patient, codeError("create patient", p.ID, errCode, errno)
 	}
 
 	return c_patient, nil
 }
 
-type PatientResponse struct {
-	Patient Patient
-	Index   uint
+func (s *PatientService) GetPatient(ci string) (*PatientResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getPatient(ci)
 }
 
-func (s *PatientService) GetPatient(ci string) (*PatientResponse, error) {
+func (s *PatientService) getPatient(ci string) (*PatientResponse, error) {
 	cci := C.CString(ci)
 	defer C.free(unsafe.Pointer(cci))
 
 	var c_patient C.Patient
 	var c_pIndex C.size_t
-	errCode := C.GetPatient(&c_patient, &c_pIndex, &s.index[0], cci) // TODO: use s.index directly
+	errCode, errno := C.GetPatient(&s.db, &c_patient, &c_pIndex, &s.index, cci)
 	if errCode != 0 {
-		if errCode == C.ERR_NOT_FOUND {
-			return nil, fmt.Errorf("patient with CI %s not found", ci)
-		}
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return nil, fmt.Errorf("error getting patient: %s", errMsg)
+		return nil, codeError("get patient", ci, errCode, errno)
 	}
 
 	return &PatientResponse{
@@ -121,37 +136,52 @@ func (s *PatientService) GetPatient(ci string) (*PatientResponse, error) {
 }
 
 func (s *PatientService) AddPatient(p Patient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	c_patient, err := NewPatient(p)
 	if err != nil {
 		return err
 	}
 
-	errCode := C.AddPatient(&s.count_patients, &s.index, &c_patient)
-	if errCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return fmt.Errorf("error adding patient: %s", errMsg)
+	// Rejected up front so a duplicate never reaches the log
+	if s.isIndexed(p.ID) {
+		return &DuplicateError{CI: p.ID}
 	}
 
-	s.patients = [C.MAX_PATIENTS]C.Patient{}
-	s.count_patients = 0
-	if err := s.LoadPatients(); err != nil {
-		return fmt.Errorf("failed to reload patients after adding: %w", err)
+	if err := s.logMutation(C.WAL_ADD, &c_patient); err != nil {
+		return err
 	}
 
-	return nil
+	// The loaded list grows below, so C only gets a copy of the count
+	count := s.patients.count
+	errCode, errno := C.AddPatient(&s.db, &count, &s.index, &s.free, &c_patient)
+	if errCode != 0 {
+		return codeError("add patient", p.ID, errCode, errno)
+	}
+
+	return s.storeLoaded(&c_patient)
 }
 
 func (s *PatientService) ListPatients() ([]Patient, error) {
-	result := make([]Patient, s.count_patients)
-	for i := 0; i < int(s.count_patients); i++ {
-		result[i] = ParseCPatient(&s.patients[i])
-		//fmt.Printf("Patient %d: %s (%c)\n", i, result[i].Name, result[i].Gender)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Patient, 0, s.patients.count)
+	for _, cPatient := range s.patientSlice() {
+		if C.IsEmptyPatient(&cPatient) != 0 {
+			continue // Skip slots left by deleted patients
+		}
+		result = append(result, ParseCPatient(&cPatient))
 	}
 
 	return result, nil
 }
 
 func (s *PatientService) UpdatePatient(p Patient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	c_patient, err := NewPatient(p)
 	if err != nil {
 		return err
@@ -159,255 +189,493 @@ func (s *PatientService) UpdatePatient(p Patient) error {
 
 	ci := C.CString(p.ID)
 	defer C.free(unsafe.Pointer(ci))
-	errCode := C.UpdatePatient(&s.index, ci, &c_patient)
-	if errCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return fmt.Errorf("error updating patient: %s", errMsg)
+	if !s.isIndexed(p.ID) {
+		return &NotFoundError{Op: "update patient", CI: p.ID}
+	}
+	if err := s.logMutation(C.WAL_UPDATE, &c_patient); err != nil {
+		return err
 	}
 
-	s.patients = [C.MAX_PATIENTS]C.Patient{}
-	s.count_patients = 0
-	if err := s.LoadPatients(); err != nil {
-		return fmt.Errorf("failed to reload patients after adding: %w", err)
+	errCode, errno := C.UpdatePatient(&s.db, &s.index, ci, &c_patient)
+	if errCode != 0 {
+		return codeError("update patient", p.ID, errCode, errno)
 	}
 
-	return nil
+	return s.storeLoaded(&c_patient)
 }
 
-func (s *PatientService) ScheduleAppointment(ci string, date string) error {
-	cci := C.CString(ci)
+// ScheduleAppointment books the appointment a and makes its date the
+// patient's appointment date. The appointment is made first and taken back,
+// with the log entry, if the change to the patient can't be logged or
+// written.
+func (s *PatientService) ScheduleAppointment(a Appointment) (Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := requireTime(a, "schedule appointment"); err != nil {
+		return Appointment{}, err
+	}
+	a, err := s.prepareAppointment(a, "schedule appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	a, err = s.appointments.create(a)
+	if err != nil {
+		return Appointment{}, err
+	}
+
+	cci := C.CString(a.CI)
 	defer C.free(unsafe.Pointer(cci))
-	cDate := C.CString(date)
+	cDate := C.CString(a.Date)
 	defer C.free(unsafe.Pointer(cDate))
 
-	errCode := C.ScheduleAppointment(&s.patients[0], &s.index[0], cci, cDate)
+	var entry C.Patient
+	C.strncpy(&entry.ci[0], cci, C.size_t(len(entry.ci)-1))
+	C.strncpy(&entry.appointment_date[0], cDate, C.size_t(len(entry.appointment_date)-1))
+	if err := s.logMutation(C.WAL_SCHEDULE, &entry); err != nil {
+		return Appointment{}, errors.Join(err, s.appointments.drop(a))
+	}
+
+	errCode, errno := C.ScheduleAppointment(&s.db, &s.index, cci, cDate)
 	if errCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return fmt.Errorf("error scheduling appointment: %s", errMsg)
+		err := codeError("schedule appointment", a.CI, errCode, errno)
+		return Appointment{}, errors.Join(err, s.unlogMutation(), s.appointments.drop(a))
 	}
 
-	s.patients = [C.MAX_PATIENTS]C.Patient{}
-	s.count_patients = 0
-	if err := s.LoadPatients(); err != nil {
-		return fmt.Errorf("failed to reload patients after adding: %w", err)
+	position, _ := s.position(cci)
+	loaded := &s.patientSlice()[position]
+	C.strncpy(&loaded.appointment_date[0], cDate, C.size_t(len(loaded.appointment_date)-1))
+
+	return a, nil
+}
+
+// prepareAppointment looks up the patient of a and prepares it in the
+// appointment book.
+func (s *PatientService) prepareAppointment(a Appointment, op string) (Appointment, error) {
+	if !s.isIndexed(a.CI) {
+		return Appointment{}, &NotFoundError{Op: op, CI: a.CI}
 	}
+	response, err := s.getPatient(a.CI)
+	if err != nil {
+		return Appointment{}, err
+	}
+	return s.appointments.prepare(a, response.Patient, op)
+}
 
-	return nil
+// ListAppointments returns the history of a patient, oldest first.
+func (s *PatientService) ListAppointments(ci string) ([]Appointment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.isIndexed(ci) {
+		return nil, &NotFoundError{Op: "list appointments", CI: ci}
+	}
+	return s.appointments.list(ci), nil
+}
+
+func (s *PatientService) CreateAppointment(a Appointment) (Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.prepareAppointment(a, "create appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	return s.appointments.create(a)
+}
+
+func (s *PatientService) CancelAppointment(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appointments.cancel(id)
 }
 
 func (s *PatientService) DeletePatient(ci string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	cci := C.CString(ci)
 	defer C.free(unsafe.Pointer(cci))
-	errCode := C.DeletePatient(&s.patients[0], &s.index, cci)
-	if errCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errCode))
-		return fmt.Errorf("error deleting patient: %s", errMsg)
+
+	if !s.isIndexed(ci) {
+		return &NotFoundError{Op: "delete patient", CI: ci}
+	}
+	cancelled, err := s.appointments.cancelAll(ci)
+	if err != nil {
+		return err
+	}
+	var entry C.Patient
+	C.strncpy(&entry.ci[0], cci, C.size_t(len(entry.ci)-1))
+	if err := s.logMutation(C.WAL_DELETE, &entry); err != nil {
+		return errors.Join(err, s.appointments.reschedule(cancelled))
 	}
 
-	s.patients = [C.MAX_PATIENTS]C.Patient{}
-	s.count_patients = 0
-	if err := s.LoadPatients(); err != nil {
-		return fmt.Errorf("failed to reload patients after adding: %w", err)
+	position, _ := s.position(cci)
+	errCode, errno := C.DeletePatient(&s.db, &s.index, &s.free, cci)
+	if errCode != 0 {
+		return codeError("delete patient", ci, errCode, errno)
 	}
+	s.patientSlice()[position] = C.Patient{}
 
 	return nil
 }
 
-func (s *PatientService) LoadPatients() error {
-	errorCode := C.LoadPatients(&s.patients[0], &s.count_patients)
+// ImportPatients adds the patients as one commit, handling those already
+// stored by opts.OnConflict. Whatever was logged before is checkpointed
+// first, so the batch needs no log of its own: a crash leaves either all of
+// it or none.
+func (s *PatientService) ImportPatients(patients []Patient, opts ImportOptions) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range patients {
+		if _, err := NewPatient(p); err != nil {
+			return nil, err
+		}
+	}
+	patients, conflicts, err := resolveConflicts(patients, opts.OnConflict, func(ci string) (bool, error) {
+		return s.isIndexed(ci), nil
+	})
+	if err != nil || opts.DryRun || len(patients) == 0 {
+		return conflicts, err
+	}
+	records := make([]C.Patient, len(patients))
+	for i, p := range patients {
+		records[i], _ = NewPatient(p)
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	// The batch is built on a copy of the loaded patients, so a failed
+	// commit leaves them, the index and the files as they were
+	var batch C.PatientList
+	defer func() { C.FreePatientList(&batch) }()
+	errCode, errno := C.ReservePatients(&batch, s.patients.count+C.size_t(len(records)))
+	if errCode != 0 {
+		return nil, codeError("import patients", "", errCode, errno)
+	}
+	// Room was reserved for the whole batch, so the appends can't fail
+	for i := range s.patientSlice() {
+		C.AppendPatient(&batch, &s.patientSlice()[i])
+	}
+	added := map[string]int{}
+	for i := range records {
+		ci := C.GoString(&records[i].ci[0])
+		position, ok := added[ci]
+		if indexed, found := s.position(&records[i].ci[0]); found {
+			position, ok = indexed, true
+		}
+		if ok {
+			unsafe.Slice(batch.items, batch.count)[position] = records[i]
+			continue
+		}
+		added[ci] = int(batch.count)
+		C.AppendPatient(&batch, &records[i])
+	}
+
+	errorCode, errno := C.CompactPatients(&s.db, &batch, &s.index, &s.free)
 	if errorCode != 0 {
-		return fmt.Errorf("Error loading patients: %d", errorCode)
+		return nil, codeError("import patients", "", errorCode, errno)
 	}
-	return nil
+	s.patients, batch = batch, s.patients
+	return conflicts, nil
 }
 
-func (s *PatientService) LoadIndex() error {
-	errorCode := C.LoadIndex(&s.index)
-	if errorCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errorCode))
-		return fmt.Errorf("Error loading index: %s", errMsg)
+// position returns the record position the index holds for ci.
+func (s *PatientService) position(ci *C.char) (int, bool) {
+	var slot C.size_t
+	if C.FindPatientIndex(&slot, &s.index, ci) != 0 {
+		return 0, false
+	}
+	return int(s.indexSlice()[slot].position), true
+}
+
+// storeLoaded puts p, just written to the patients file, into the loaded
+// patients at its indexed position, as LoadPatients would read it back.
+func (s *PatientService) storeLoaded(p *C.Patient) error {
+	position, ok := s.position(&p.ci[0])
+	if !ok {
+		return &NotFoundError{Op: "store patient", CI: C.GoString(&p.ci[0])}
+	}
+	var buf [C.ENCODED_PATIENT_SIZE]C.uchar
+	var record C.Patient
+	C.EncodePatient(&buf[0], p)
+	C.DecodePatient(&record, &buf[0])
+
+	if position < int(s.patients.count) {
+		s.patientSlice()[position] = record
+		return nil
+	}
+	errCode, errno := C.AppendPatient(&s.patients, &record)
+	if errCode != 0 {
+		return codeError("store patient", C.GoString(&p.ci[0]), errCode, errno)
 	}
 	return nil
 }
 
-func (s *PatientService) Load() error {
-	if err := s.LoadPatients(); err != nil {
-		return fmt.Errorf("failed to load patients: %w", err)
+func (s *PatientService) isIndexed(ci string) bool {
+	cci := C.CString(ci)
+	defer C.free(unsafe.Pointer(cci))
+
+	var slot C.size_t
+	return C.FindPatientIndex(&slot, &s.index, cci) == 0
+}
+
+// indexSlice exposes the C index buckets as a Go slice without copying them.
+func (s *PatientService) indexSlice() []C.PatientIndex {
+	if s.index.entries == nil {
+		return nil
 	}
+	return unsafe.Slice(s.index.entries, s.index.capacity)
+}
 
-	if err := s.LoadIndex(); err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
+// patientSlice exposes the C patient list as a Go slice without copying it.
+func (s *PatientService) patientSlice() []C.Patient {
+	if s.patients.items == nil {
+		return nil
 	}
+	return unsafe.Slice(s.patients.items, s.patients.count)
+}
 
-	return nil
+func (s *PatientService) LoadPatients() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadPatients()
 }
 
-func (s *PatientService) Save() error {
-	errorCode := C.SavePatients(&s.patients[0], s.count_patients)
+func (s *PatientService) loadPatients() error {
+	errorCode, errno := C.LoadPatients(&s.db, &s.patients)
 	if errorCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errorCode))
-		return fmt.Errorf("error saving patients: %s", errMsg)
+		return codeError("load patients", "", errorCode, errno)
 	}
-
-	// Save the index after saving patients
-	errorCode = C.SaveIndex(&s.index)
+	errorCode, errno = C.BuildFreeList(&s.free, &s.patients)
 	if errorCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errorCode))
-		return fmt.Errorf("error saving index: %s", errMsg)
+		return codeError("collect free slots", "", errorCode, errno)
 	}
+	return nil
+}
+
+// Compact rewrites patients.bin without the holes left by deleted
+// patients and moves the index to the new positions.
+func (s *PatientService) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	errorCode, errno := C.CompactPatients(&s.db, &s.patients, &s.index, &s.free)
+	if errorCode != 0 {
+		return codeError("compact patients", "", errorCode, errno)
+	}
 	return nil
 }
 
-func (s *PatientService) CreateIndex() error {
-	for i := C.size_t(0); i < s.count_patients; i++ {
-		if s.patients[i].age == 0 {
-			return fmt.Errorf("patient at index %d is uninitialized", i)
-		}
+func (s *PatientService) LoadIndex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadIndex()
+}
 
-		// Create a new index entry
-		errCode := C.NewPatientIndex(&s.index, &s.patients[i].ci[0], i)
-		if errCode != 0 {
-			errMsg := C.GoString(C.ErrorDescription(errCode))
-			return fmt.Errorf("error creating index for patient %d: %s", i, errMsg)
-		}
+func (s *PatientService) loadIndex() error {
+	errorCode, errno := C.LoadIndex(&s.db, &s.index)
+	if errorCode != 0 {
+		return codeError("load index", "", errorCode, errno)
 	}
+	return nil
+}
 
-	fmt.Printf("Index created with %d entries.\n", s.count_patients)
+// Recover completes or discards a save that was interrupted by a crash, so
+// patients.bin and index.dat always come from the same commit.
+func (s *PatientService) Recover() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recoverFiles()
+}
+
+func (s *PatientService) recoverFiles() error {
+	errorCode, errno := C.RecoverFiles(&s.db)
+	if errorCode != 0 {
+		return codeError("recover data files", "", errorCode, errno)
+	}
 	return nil
 }
 
-func (s *PatientService) SaveIndex() error {
-	errorCode := C.SaveIndex(&s.index)
+// Migrate upgrades patients.bin to the current file format, keeping
+// every record at its position so index.dat stays valid.
+func (s *PatientService) Migrate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.migrate()
+}
+
+func (s *PatientService) migrate() error {
+	var from C.int
+	errorCode, errno := C.MigratePatientsFile(&s.db, &from)
 	if errorCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errorCode))
-		return fmt.Errorf("error saving index: %s", errMsg)
+		return codeError("migrate patients file", "", errorCode, errno)
+	}
+	if from != C.PATIENT_FORMAT_VERSION {
+		notef("Migrated patients file from version %d to %d.\n", from, C.PATIENT_FORMAT_VERSION)
 	}
 	return nil
 }
 
-func (s *PatientService) WriteIndexToFile() error {
-	file, err := os.Create("index_log.txt")
+// Open gets the service ready on its database directory: it finishes an
+// interrupted save, migrates the patients file, loads the patients and their
+// index and replays the log. A missing data directory or patients file is an
+// empty database.
+// If the patients can't be loaded, e.g. because a record is corrupt, the
+// error is returned and the index is read from index.dat instead, leaving
+// the service good enough to Verify the files but not to use them.
+func (s *PatientService) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.DataDir(), 0o755); err != nil {
+		return &IOError{Op: "create data directory", Errno: errnoOf(err)}
+	}
+	if err := s.recoverFiles(); err != nil {
+		return err
+	}
+	if err := s.migrate(); err != nil {
+		return err
+	}
+	if err := s.appointments.open(s.DataDir()); err != nil {
+		return err
+	}
+
+	err := s.loadPatients()
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil // nothing saved yet
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create index file: %w", err)
+		if indexErr := s.loadIndex(); indexErr != nil && !errors.Is(indexErr, fs.ErrNotExist) {
+			return errors.Join(err, indexErr)
+		}
+		return err
 	}
-	defer file.Close()
 
-	for i := 0; i < C.MAX_INDEX; i++ {
-		if s.index[i].ci[0] == 0 {
-			continue // Skip uninitialized index entries
+	if err := s.openIndex(); err != nil {
+		return err
+	}
+	return s.replayLog()
+}
+
+// openIndex loads index.dat, which the last save wrote along with
+// patients.bin. The index is rebuilt from the loaded patients instead when
+// the file is missing, can't be parsed or doesn't match them, as happens
+// when patients were changed in place after that save.
+func (s *PatientService) openIndex() error {
+	err := s.loadIndex()
+	if err == nil && s.indexMatches() {
+		return nil
+	}
+	if errors.Is(err, ErrIO) && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	C.FreeIndex(&s.index)
+	return s.createIndex()
+}
+
+// indexMatches reports whether the index holds every loaded patient, and
+// only them, at their own positions.
+func (s *PatientService) indexMatches() bool {
+	patients := s.patientSlice()
+	live := 0
+	for i := range patients {
+		if C.IsEmptyPatient(&patients[i]) == 0 {
+			live++
 		}
-		_, err := fmt.Fprintf(file, "%d -> |%s|%d|\n", i, C.GoString(&s.index[i].ci[0]), s.index[i].position)
-		if err != nil {
-			return fmt.Errorf("failed to write index entry: %w", err)
+	}
+	if live != int(s.index.count) {
+		return false
+	}
+	buckets := s.indexSlice()
+	for i := range buckets {
+		if buckets[i].ci[0] == 0 || buckets[i].deleted != 0 {
+			continue
+		}
+		position := buckets[i].position
+		if position >= s.patients.count || C.strcmp(&buckets[i].ci[0], &patients[position].ci[0]) != 0 {
+			return false
 		}
 	}
+	return true
+}
 
-	return nil
+func (s *PatientService) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
 }
 
-func (s *PatientService) Run() error {
-	err := s.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load data: %w", err)
+func (s *PatientService) load() error {
+	if err := s.recoverFiles(); err != nil {
+		return err
 	}
 
-	fmt.Printf("Loaded %d patients.\n", s.count_patients)
+	if err := s.migrate(); err != nil {
+		return err
+	}
 
-	for _, cPatient := range s.patients {
-		//patient := ParseCPatient(&cPatient)
-		if cPatient.age == 0 {
-			continue // Skip uninitialized patients
-		}
-		C.ShowPatient(&cPatient)
+	if err := s.loadPatients(); err != nil {
+		return fmt.Errorf("failed to load patients: %w", err)
 	}
 
-	err = s.CreateIndex()
-	if err != nil {
-		return fmt.Errorf("failed to create index: %w", err)
-	}
-
-	fmt.Printf("\n\n\n\n")
-
-	// // Add a patient for testing
-	// testPatient := Patient{
-	// 	ID:              "31668000",
-	// 	Name:            "Test Patient",
-	// 	Age:             30,
-	// 	Diagnosis:       "Test Diagnosis",
-	// 	Gender:          'M',
-	// 	Disability:      false,
-	// 	DocSpecialty:    "General",
-	// 	AppointmentDate: "2023-10-01",
-	// }
-
-	// err = s.AddPatient(testPatient)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to add test patient: %w", err)
-	// }
-	// fmt.Printf("Test patient added successfully.\n")
-
-	// // Update a patient for testing
-	// testPatient := Patient{
-	// 	ID:              "31668000",
-	// 	Name:            "Ricardo Martinez",
-	// 	Age:             31,
-	// 	Diagnosis:       "Updated Diagnosis",
-	// 	Gender:          'M',
-	// 	Disability:      false,
-	// 	DocSpecialty:    "General",
-	// 	AppointmentDate: "2023-10-01",
-	// }
-
-	// err = s.UpdatePatient(testPatient)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to update test patient: %w", err)
-	// }
-	// fmt.Printf("Test patient updated successfully.\n")
-
-	// // Delete a patient for testing
-	// err = s.DeletePatient("31668000")
-	// if err != nil {
-	// 	return fmt.Errorf("failed to delete test patient: %w", err)
-	// }
-	// fmt.Printf("Test patient deleted successfully.\n")
-
-	// // Test scheduling an appointment
-	// testCI := "77889900"
-	// testDate := "2025-12-24"
-	// err = s.ScheduleAppointment(testCI, testDate)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to schedule appointment for CI %s on date %s: %w", testCI, testDate, err)
-	// }
-	// fmt.Printf("Appointment scheduled successfully for CI %s on date %s.\n", testCI, testDate)
-
-	// Save the patients after loading them
-	errorCode := C.SavePatients(&s.patients[0], s.count_patients)
-	if errorCode != 0 {
-		errMsg := C.GoString(C.ErrorDescription(errorCode))
-		return fmt.Errorf("error saving patients: %s", errMsg)
+	if err := s.loadIndex(); err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
 	}
 
-	// Save the index after creating it
-	err = s.SaveIndex()
-	if err != nil {
-		return fmt.Errorf("failed to save index: %w", err)
+	return s.replayLog()
+}
+
+func (s *PatientService) CreateIndex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createIndex()
+}
+
+func (s *PatientService) createIndex() error {
+	if err := s.indexPatients(); err != nil {
+		return err
 	}
-	fmt.Printf("Index saved successfully.\n")
 
-	for _, index := range s.index {
-		if index.ci[0] == 0 {
-			continue // Skip uninitialized index entries
+	notef("Index created with %d entries.\n", s.index.count)
+	return nil
+}
+
+func (s *PatientService) indexPatients() error {
+	patients := s.patientSlice()
+	for i := range patients {
+		if C.IsEmptyPatient(&patients[i]) != 0 {
+			continue // Skip slots left by deleted patients
 		}
-		fmt.Printf("Index CI: %s, Position: %d\n", C.GoString(&index.ci[0]), index.position)
-		GetPatientResponse, err := s.GetPatient(C.GoString(&index.ci[0]))
-		if err != nil {
-			return fmt.Errorf("failed to get patient: %w", err)
+
+		// Create a new index entry
+		errCode, errno := C.NewPatientIndex(&s.index, &patients[i].ci[0], C.size_t(i))
+		if errCode == C.ERR_DUPLICATE {
+			// Left over from before duplicates were rejected; the first one
+			// wins, as it always did, and the next save drops the rest
+			notef("Skipping duplicate patient %s at %d.\n", C.GoString(&patients[i].ci[0]), i)
+			continue
+		}
+		if errCode != 0 {
+			return codeError("index patient", C.GoString(&patients[i].ci[0]), errCode, errno)
 		}
-		litter.Dump(GetPatientResponse.Patient)
-		fmt.Printf("\n")
 	}
+	return nil
+}
 
+func (s *PatientService) SaveIndex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveIndex()
+}
+
+func (s *PatientService) saveIndex() error {
+	errorCode, errno := C.SaveIndex(&s.db, &s.index)
+	if errorCode != 0 {
+		return codeError("save index", "", errorCode, errno)
+	}
 	return nil
 }
 
@@ -0,0 +1,314 @@
+//go:build cgo
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patientModel runs steps against a file backend and a map of what it
+// should hold, checking GetPatient for every CI after each one.
+type patientModel struct {
+	t       *testing.T
+	backend string
+	store   PatientStore
+	want    map[string]Patient
+	cis     []string // every CI the steps use
+	version int
+}
+
+func newPatientModel(t *testing.T, backend string, cis []string) *patientModel {
+	return &patientModel{
+		t:       t,
+		backend: backend,
+		store:   openStore(t, backend, t.TempDir()),
+		want:    map[string]Patient{},
+		cis:     cis,
+	}
+}
+
+// patient makes a new version of the patient ci, so a stale record shows.
+func (m *patientModel) patient(ci string) Patient {
+	m.version++
+	return Patient{
+		ID:              ci,
+		Name:            fmt.Sprintf("Patient %s v%d", ci, m.version),
+		Age:             m.version % 90,
+		Diagnosis:       "Checkup",
+		Gender:          "MF"[m.version%2],
+		DocSpecialty:    "General",
+		AppointmentDate: "2024-01-01",
+	}
+}
+
+func (m *patientModel) add(ci string) {
+	m.t.Helper()
+	p := m.patient(ci)
+	if err := m.store.AddPatient(p); err != nil {
+		m.t.Fatalf("add %s: %v", ci, err)
+	}
+	m.want[ci] = p
+	m.check("add " + ci)
+}
+
+func (m *patientModel) update(ci string) {
+	m.t.Helper()
+	p := m.patient(ci)
+	if err := m.store.UpdatePatient(p); err != nil {
+		m.t.Fatalf("update %s: %v", ci, err)
+	}
+	m.want[ci] = p
+	m.check("update " + ci)
+}
+
+func (m *patientModel) delete(ci string) {
+	m.t.Helper()
+	if err := m.store.DeletePatient(ci); err != nil {
+		m.t.Fatalf("delete %s: %v", ci, err)
+	}
+	delete(m.want, ci)
+	m.check("delete " + ci)
+}
+
+func (m *patientModel) save() {
+	m.t.Helper()
+	if err := m.store.Save(); err != nil {
+		m.t.Fatalf("save: %v", err)
+	}
+	m.check("save")
+}
+
+// reopen closes the store, saved or not, and opens the files again.
+func (m *patientModel) reopen() {
+	m.t.Helper()
+	m.store = reopen(m.t, m.store, m.backend)
+	m.check("reopen")
+}
+
+func (m *patientModel) check(step string) {
+	m.t.Helper()
+	for _, ci := range m.cis {
+		got, err := m.store.GetPatient(ci)
+		want, ok := m.want[ci]
+		switch {
+		case !ok && !errors.Is(err, ErrNotFound):
+			m.t.Fatalf("after %s: get %s = %v, %v, want ErrNotFound", step, ci, got, err)
+		case ok && err != nil:
+			m.t.Fatalf("after %s: get %s: %v", step, ci, err)
+		case ok && got.Patient != want:
+			m.t.Fatalf("after %s: get %s = %+v, want %+v", step, ci, got.Patient, want)
+		}
+	}
+}
+
+func forEachFileBackend(t *testing.T, test func(t *testing.T, backend string)) {
+	for _, backend := range []string{"cgo", "go"} {
+		t.Run(backend, func(t *testing.T) { test(t, backend) })
+	}
+}
+
+func TestDeleteInCollisionChain(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		m := newPatientModel(t, backend, chainCIs)
+		for _, ci := range chainCIs {
+			m.add(ci)
+		}
+		m.save()
+		m.delete(chainCIs[0])
+		m.reopen()
+		m.delete(chainCIs[2])
+		m.save()
+		m.reopen()
+		// Both freed slots are reused, out of their old order
+		m.add(chainCIs[2])
+		m.add(chainCIs[0])
+		m.update(chainCIs[3])
+		m.reopen()
+		m.save()
+		m.reopen()
+	})
+}
+
+func TestReAddIntoFreedSlots(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		cis := append([]string{"20000002", "30000003", "40000004"}, chainCIs...)
+		m := newPatientModel(t, backend, cis)
+		for _, ci := range cis {
+			m.add(ci)
+		}
+		m.save()
+		for _, ci := range cis {
+			m.delete(ci)
+		}
+		m.save()
+		m.reopen()
+		for i := len(cis) - 1; i >= 0; i-- {
+			m.add(cis[i])
+		}
+		m.reopen()
+		m.save()
+		m.reopen()
+	})
+}
+
+func TestAppendAfterTornLog(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		for _, logged := range []bool{false, true} {
+			t.Run(fmt.Sprintf("logged=%v", logged), func(t *testing.T) {
+				m := newPatientModel(t, backend, []string{alice.ID, bob.ID, carla.ID})
+				dir := m.store.DataDir()
+				m.add(carla.ID)
+				m.save()
+				if logged {
+					m.add(alice.ID)
+				}
+				m.store.Close()
+				log, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := log.Write([]byte{1, 2, 3, 4, 5}); err != nil {
+					t.Fatal(err)
+				}
+				log.Close()
+
+				m.store = openStore(t, backend, dir)
+				m.check("open over a torn log")
+				// Lose the in-place write, as if it crashed right after
+				// logging, so the add has to come back from the log
+				saved := map[string][]byte{}
+				for _, name := range []string{patientFileName, indexFileName} {
+					if saved[name], err = os.ReadFile(filepath.Join(dir, name)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				m.add(bob.ID)
+				m.store.Close()
+				for name, data := range saved {
+					if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				m.store = openStore(t, backend, dir)
+				m.check("replay after a torn log")
+			})
+		}
+	})
+}
+
+func TestDeleteWhenLogFails(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		s := openStore(t, backend, t.TempDir())
+		addPatients(t, s, alice)
+		if _, err := s.ScheduleAppointment(Appointment{CI: alice.ID, Date: "2024-04-20", Time: "11:30"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+		want, err := s.GetPatient(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A directory in its place makes every append fail
+		if err := os.Mkdir(filepath.Join(s.DataDir(), walFileName), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeletePatient(alice.ID); !errors.Is(err, ErrIO) {
+			t.Fatalf("delete = %v, want ErrIO", err)
+		}
+		checkStored(t, s, want.Patient)
+		checkAppointments(t, s, alice.ID, AppointmentScheduled)
+	})
+}
+
+func TestScheduleWhenWriteFails(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		s := openStore(t, backend, t.TempDir())
+		addPatients(t, s, alice)
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+		// A directory in its place makes writing the patient fail
+		path := filepath.Join(s.DataDir(), patientFileName)
+		if err := os.Rename(path, path+".saved"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		a, err := s.ScheduleAppointment(Appointment{CI: alice.ID, Date: "2024-04-20", Time: "11:30"})
+		if err == nil || a != (Appointment{}) {
+			t.Fatalf("schedule = %+v, %v, want an error", a, err)
+		}
+		checkAppointments(t, s, alice.ID)
+
+		s.Close()
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".saved", path); err != nil {
+			t.Fatal(err)
+		}
+		s = openStore(t, backend, s.DataDir())
+		checkStored(t, s, alice)
+		checkAppointments(t, s, alice.ID)
+	})
+}
+
+func TestScheduleWhenIndexFails(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		s := openStore(t, backend, t.TempDir())
+		addPatients(t, s, alice)
+		// The index is left stale, but the appointment is made
+		tmpPath := filepath.Join(s.DataDir(), appointmentIndexFileName+tmpSuffix)
+		if err := os.Mkdir(tmpPath, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		a, err := s.ScheduleAppointment(Appointment{CI: alice.ID, Date: "2024-04-20", Time: "11:30"})
+		if err != nil || a.ID != 1 {
+			t.Fatalf("schedule = %+v, %v, want appointment 1", a, err)
+		}
+		checkAppointments(t, s, alice.ID, AppointmentScheduled)
+
+		if err := os.Remove(tmpPath); err != nil {
+			t.Fatal(err)
+		}
+		s = reopen(t, s, backend)
+		checkAppointments(t, s, alice.ID, AppointmentScheduled)
+	})
+}
+
+func TestRandomPatientSteps(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		cis := append([]string{"20000002", "30000003", "40000004", "50000005"}, chainCIs...)
+		m := newPatientModel(t, backend, cis)
+		random := rand.New(rand.NewSource(1))
+		for step := 0; step < 300; step++ {
+			ci := cis[random.Intn(len(cis))]
+			_, stored := m.want[ci]
+			switch choice := random.Intn(10); {
+			case choice < 4 && !stored:
+				m.add(ci)
+			case choice < 4:
+				m.delete(ci)
+			case choice < 6 && stored:
+				m.update(ci)
+			case choice < 8:
+				m.save()
+			default:
+				m.reopen()
+			}
+		}
+		m.save()
+		report, err := m.store.Verify()
+		if err != nil || !report.OK() || report.Indexed != len(m.want) {
+			t.Errorf("verify = %v, %v, want OK with %d indexed", report, err, len(m.want))
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// slotsFileName is the optional slot configuration of a data directory.
+const slotsFileName = "slots.json"
+
+// SlotRule is how the appointments of a specialty are booked.
+type SlotRule struct {
+	// Capacity is how many appointments may overlap at any moment, such as
+	// the number of doctors on duty.
+	Capacity int `json:"capacity"`
+	// Duration is the length in minutes of a timed appointment made without
+	// one.
+	Duration int `json:"duration"`
+}
+
+// SlotConfig is the slots.json of a data directory, for example
+//
+//	{
+//	  "default": {"capacity": 1, "duration": 30},
+//	  "specialties": {"Cardiology": {"capacity": 3, "duration": 20}}
+//	}
+//
+// Specialties not listed, and fields left out or 0, follow Default.
+type SlotConfig struct {
+	Default     SlotRule            `json:"default"`
+	Specialties map[string]SlotRule `json:"specialties,omitempty"`
+}
+
+// DefaultSlotConfig is used when the data directory has no slots.json: one
+// patient at a time in every specialty, for half an hour.
+var DefaultSlotConfig = SlotConfig{Default: SlotRule{Capacity: 1, Duration: 30}}
+
+// Rule returns the rule for specialty.
+func (c SlotConfig) Rule(specialty string) SlotRule {
+	rule := c.Specialties[specialty]
+	if rule.Capacity == 0 {
+		rule.Capacity = c.Default.Capacity
+	}
+	if rule.Duration == 0 {
+		rule.Duration = c.Default.Duration
+	}
+	return rule
+}
+
+// validate rejects negative values and, in Default, zero ones.
+func (c SlotConfig) validate() error {
+	check := func(name string, rule SlotRule, zeroOK bool) error {
+		if rule.Capacity < 0 || rule.Duration < 0 || rule.Duration > minutesPerDay ||
+			!zeroOK && (rule.Capacity == 0 || rule.Duration == 0) {
+			return fmt.Errorf("%s: invalid rule for %s: capacity %d, duration %d",
+				slotsFileName, name, rule.Capacity, rule.Duration)
+		}
+		return nil
+	}
+	if err := check("default", c.Default, false); err != nil {
+		return err
+	}
+	for specialty, rule := range c.Specialties {
+		if err := check(fmt.Sprintf("%q", specialty), rule, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadSlotConfig reads slots.json from dataDir, or returns
+// DefaultSlotConfig if there is none. Unknown keys are an error, so a
+// misspelled setting isn't silently ignored.
+func LoadSlotConfig(dataDir string) (SlotConfig, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, slotsFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultSlotConfig, nil
+	}
+	if err != nil {
+		return SlotConfig{}, ioError("load "+slotsFileName, err)
+	}
+	config := DefaultSlotConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return SlotConfig{}, fmt.Errorf("%s: %w", slotsFileName, err)
+	}
+	if err := config.validate(); err != nil {
+		return SlotConfig{}, err
+	}
+	return config, nil
+}
+
+// checkBooking refuses a, a new timed appointment, if it overlaps one the
+// patient already has, or if at some moment during it the specialty would
+// have more than its capacity. sameDay are the stored appointments on a's
+// date; cancelled ones and those without a time take no room.
+func checkBooking(a Appointment, sameDay []Appointment, slots SlotConfig, op string) error {
+	if a.Time == "" {
+		return nil
+	}
+	op = fmt.Sprintf("%s on %s at %s", op, a.Date, a.Time)
+	start, end := clockMinutes(a.Time), a.end()
+	var overlapping []Appointment
+	for _, other := range sameDay {
+		if other.Status != AppointmentScheduled || other.Time == "" || other.Date != a.Date {
+			continue
+		}
+		if clockMinutes(other.Time) >= end || other.end() <= start {
+			continue
+		}
+		if other.CI == a.CI {
+			return &BookingError{Op: op, CI: a.CI, Code: codeAppointmentConflict}
+		}
+		if other.Specialty == a.Specialty {
+			overlapping = append(overlapping, other)
+		}
+	}
+
+	// The busiest moment is when a or one of the overlapping appointments
+	// starts
+	capacity := slots.Rule(a.Specialty).Capacity
+	for _, moment := range append([]Appointment{a}, overlapping...) {
+		at := max(clockMinutes(moment.Time), start)
+		busy := 0
+		for _, other := range overlapping {
+			if clockMinutes(other.Time) <= at && at < other.end() {
+				busy++
+			}
+		}
+		if busy >= capacity {
+			return &BookingError{Op: op, CI: a.CI, Code: codeSlotFull}
+		}
+	}
+	return nil
+}
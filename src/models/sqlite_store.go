@@ -0,0 +1,561 @@
+//go:build cgo
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteFileName is the database file inside the data directory.
+const sqliteFileName = "patients.db"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS patients (
+	ci               TEXT PRIMARY KEY CHECK (length(ci) = 8),
+	name             TEXT NOT NULL,
+	age              INTEGER NOT NULL CHECK (age >= 0),
+	diagnosis        TEXT NOT NULL,
+	gender           TEXT NOT NULL CHECK (gender IN ('M', 'F')),
+	disability       INTEGER NOT NULL CHECK (disability IN (0, 1)),
+	doc_specialty    TEXT NOT NULL,
+	appointment_date TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS patients_appointment_date ON patients (appointment_date);
+CREATE INDEX IF NOT EXISTS patients_doc_specialty ON patients (doc_specialty);
+CREATE TABLE IF NOT EXISTS appointments (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	ci        TEXT NOT NULL,
+	date      TEXT NOT NULL,
+	time      TEXT NOT NULL,
+	duration  INTEGER NOT NULL DEFAULT 0 CHECK (duration >= 0),
+	specialty TEXT NOT NULL,
+	status    TEXT NOT NULL CHECK (status IN ('S', 'C'))
+);
+CREATE INDEX IF NOT EXISTS appointments_ci ON appointments (ci);
+CREATE INDEX IF NOT EXISTS appointments_date ON appointments (date);
+`
+
+const patientColumns = "ci, name, age, diagnosis, gender, disability, doc_specialty, appointment_date"
+
+// SQLitePatientStore keeps the patients in a patients.db SQLite database in
+// the data directory, one row per patient, so they can be queried with plain
+// SQL and backed up with the usual SQLite tools. Every change is committed
+// as it is made. Fields are checked and truncated as by the C engine, so
+// patients move between backends unchanged.
+type SQLitePatientStore struct {
+	dir   string
+	path  string
+	db    *sql.DB
+	slots SlotConfig
+}
+
+var (
+	_ PatientStore = (*SQLitePatientStore)(nil)
+	_ StoreMirror  = (*SQLitePatientStore)(nil)
+)
+
+func init() {
+	backends["sqlite"] = func(dataDir string) (PatientStore, error) {
+		return NewSQLitePatientStore(dataDir), nil
+	}
+}
+
+// NewSQLitePatientStore creates a store for the patients.db database in
+// dataDir. The database is not touched until Open.
+func NewSQLitePatientStore(dataDir string) *SQLitePatientStore {
+	return &SQLitePatientStore{dir: dataDir, path: filepath.Join(dataDir, sqliteFileName)}
+}
+
+func (s *SQLitePatientStore) DataDir() string {
+	return s.dir
+}
+
+// sqliteError wraps a database error with the operation that hit it.
+func sqliteError(op string, err error) error {
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// Open creates the data directory, the database and its schema as needed,
+// and loads the slot configuration.
+func (s *SQLitePatientStore) Open() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return &IOError{Op: "create data directory", Errno: errnoOf(err)}
+	}
+	slots, err := LoadSlotConfig(s.dir)
+	if err != nil {
+		return err
+	}
+	s.slots = slots
+	db, err := sql.Open("sqlite3", "file:"+s.path+"?_busy_timeout=5000")
+	if err != nil {
+		return sqliteError("open patients database", err)
+	}
+	// A single connection serializes writers instead of failing them with
+	// "database is locked"
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return sqliteError("create patients schema", err)
+	}
+	if err := addAppointmentDuration(db); err != nil {
+		db.Close()
+		return sqliteError("add appointment duration", err)
+	}
+	s.db = db
+	return nil
+}
+
+// addAppointmentDuration adds the duration column to appointments tables
+// made before appointments had one.
+func addAppointmentDuration(db *sql.DB) error {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('appointments') WHERE name = 'duration'").Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE appointments ADD COLUMN duration INTEGER NOT NULL DEFAULT 0 CHECK (duration >= 0)")
+	return err
+}
+
+func (s *SQLitePatientStore) Close() {
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPatient(row rowScanner) (Patient, int64, error) {
+	var p Patient
+	var rowid int64
+	var gender string
+	err := row.Scan(&rowid, &p.ID, &p.Name, &p.Age, &p.Diagnosis, &gender, &p.Disability, &p.DocSpecialty, &p.AppointmentDate)
+	if gender != "" {
+		p.Gender = gender[0]
+	}
+	return p, rowid, err
+}
+
+func patientArgs(p Patient) []any {
+	return []any{p.ID, p.Name, p.Age, p.Diagnosis, string(p.Gender), p.Disability, p.DocSpecialty, p.AppointmentDate}
+}
+
+// GetPatient returns the patient with its rowid as the Index.
+func (s *SQLitePatientStore) GetPatient(ci string) (*PatientResponse, error) {
+	row := s.db.QueryRow("SELECT rowid, "+patientColumns+" FROM patients WHERE ci = ?", ci)
+	p, rowid, err := scanPatient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &NotFoundError{Op: "get patient", CI: ci}
+	}
+	if err != nil {
+		return nil, sqliteError("get patient", err)
+	}
+	return &PatientResponse{Patient: p, Index: uint(rowid)}, nil
+}
+
+func isConstraint(err error, code sqlite3.ErrNoExtended) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == code
+}
+
+func (s *SQLitePatientStore) AddPatient(p Patient) error {
+	if err := validatePatient(p); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("INSERT INTO patients ("+patientColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)", patientArgs(stored(p))...)
+	if isConstraint(err, sqlite3.ErrConstraintPrimaryKey) {
+		return &DuplicateError{CI: p.ID}
+	}
+	if err != nil {
+		return sqliteError("add patient", err)
+	}
+	return nil
+}
+
+// execOne runs a statement meant to change the row of ci.
+func (s *SQLitePatientStore) execOne(op string, ci string, query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return sqliteError(op, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return &NotFoundError{Op: op, CI: ci}
+	}
+	return nil
+}
+
+func (s *SQLitePatientStore) UpdatePatient(p Patient) error {
+	if err := validatePatient(p); err != nil {
+		return err
+	}
+	args := patientArgs(stored(p))
+	return s.execOne("update patient", p.ID,
+		`UPDATE patients SET name = ?, age = ?, diagnosis = ?, gender = ?, disability = ?,
+			doc_specialty = ?, appointment_date = ? WHERE ci = ?`,
+		append(args[1:], args[0])...)
+}
+
+// ScheduleAppointment books the appointment a and makes its date the
+// patient's appointment date, in one transaction.
+func (s *SQLitePatientStore) ScheduleAppointment(a Appointment) (Appointment, error) {
+	if err := requireTime(a, "schedule appointment"); err != nil {
+		return Appointment{}, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Appointment{}, sqliteError("schedule appointment", err)
+	}
+	defer tx.Rollback()
+	a, err = s.prepareAppointment(tx, a, "schedule appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	if _, err := tx.Exec("UPDATE patients SET appointment_date = ? WHERE ci = ?", a.Date, a.CI); err != nil {
+		return Appointment{}, sqliteError("schedule appointment", err)
+	}
+	a, err = insertAppointment(tx, a)
+	if err != nil {
+		return Appointment{}, sqliteError("schedule appointment", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Appointment{}, sqliteError("schedule appointment", err)
+	}
+	return a, nil
+}
+
+// DeletePatient removes the patient and cancels their scheduled
+// appointments in one transaction.
+func (s *SQLitePatientStore) DeletePatient(ci string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return sqliteError("delete patient", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("DELETE FROM patients WHERE ci = ?", ci)
+	if err != nil {
+		return sqliteError("delete patient", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return &NotFoundError{Op: "delete patient", CI: ci}
+	}
+	if _, err := tx.Exec("UPDATE appointments SET status = ? WHERE ci = ? AND status = ?",
+		string(AppointmentCancelled), ci, string(AppointmentScheduled)); err != nil {
+		return sqliteError("delete patient", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return sqliteError("delete patient", err)
+	}
+	return nil
+}
+
+// ImportPatients adds the patients in one transaction, handling those
+// already stored by opts.OnConflict.
+func (s *SQLitePatientStore) ImportPatients(patients []Patient, opts ImportOptions) ([]string, error) {
+	for _, p := range patients {
+		if err := validatePatient(p); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, sqliteError("import patients", err)
+	}
+	defer tx.Rollback()
+	patients, conflicts, err := resolveConflicts(patients, opts.OnConflict, func(ci string) (bool, error) {
+		var found int
+		err := tx.QueryRow("SELECT 1 FROM patients WHERE ci = ?", ci).Scan(&found)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil {
+			return false, sqliteError("import patients", err)
+		}
+		return true, nil
+	})
+	if err != nil || opts.DryRun || len(patients) == 0 {
+		return conflicts, err
+	}
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO patients (" + patientColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, sqliteError("import patients", err)
+	}
+	defer stmt.Close()
+	for _, p := range patients {
+		if _, err := stmt.Exec(patientArgs(stored(p))...); err != nil {
+			return nil, sqliteError("import patient "+p.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, sqliteError("import patients", err)
+	}
+	return conflicts, nil
+}
+
+// MirrorFrom replaces the database contents with the patients of the file
+// backend src and its whole appointment history, deleted patients'
+// included, in one transaction.
+func (s *SQLitePatientStore) MirrorFrom(src PatientStore) (int, int, error) {
+	patients, err := src.ListPatients()
+	if err != nil {
+		return 0, 0, err
+	}
+	appointments, _, err := readAppointmentsFile(filepath.Join(src.DataDir(), appointmentFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, sqliteError("mirror patients", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM appointments; DELETE FROM patients"); err != nil {
+		return 0, 0, sqliteError("mirror patients", err)
+	}
+	for _, p := range patients {
+		if _, err := tx.Exec("INSERT INTO patients ("+patientColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)", patientArgs(stored(p))...); err != nil {
+			return 0, 0, sqliteError("mirror patient "+p.ID, err)
+		}
+	}
+	for _, a := range appointments {
+		a = storedAppointment(a)
+		if _, err := tx.Exec("INSERT INTO appointments ("+appointmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+			a.ID, a.CI, a.Date, a.Time, a.Duration, a.Specialty, string(a.Status)); err != nil {
+			return 0, 0, sqliteError(fmt.Sprintf("mirror appointment %d", a.ID), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, sqliteError("mirror patients", err)
+	}
+	return len(patients), len(appointments), nil
+}
+
+const appointmentColumns = "id, ci, date, time, duration, specialty, status"
+
+func scanAppointment(row rowScanner) (Appointment, error) {
+	var a Appointment
+	var status string
+	err := row.Scan(&a.ID, &a.CI, &a.Date, &a.Time, &a.Duration, &a.Specialty, &status)
+	if status != "" {
+		a.Status = AppointmentStatus(status[0])
+	}
+	return a, err
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// queryAppointments returns the appointments matching `where`.
+func queryAppointments(q querier, op string, where string, args ...any) ([]Appointment, error) {
+	rows, err := q.Query("SELECT "+appointmentColumns+" FROM appointments WHERE "+where, args...)
+	if err != nil {
+		return nil, sqliteError(op, err)
+	}
+	defer rows.Close()
+
+	result := []Appointment{}
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, sqliteError(op, err)
+		}
+		result = append(result, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError(op, err)
+	}
+	return result, nil
+}
+
+// prepareAppointment looks up the patient of a and the appointments on its
+// date within tx, and prepares it against them.
+func (s *SQLitePatientStore) prepareAppointment(tx *sql.Tx, a Appointment, op string) (Appointment, error) {
+	var specialty string
+	err := tx.QueryRow("SELECT doc_specialty FROM patients WHERE ci = ?", a.CI).Scan(&specialty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Appointment{}, &NotFoundError{Op: op, CI: a.CI}
+	}
+	if err != nil {
+		return Appointment{}, sqliteError(op, err)
+	}
+	sameDay, err := queryAppointments(tx, op, "date = ? ORDER BY id", a.Date)
+	if err != nil {
+		return Appointment{}, err
+	}
+	return prepareAppointment(a, Patient{ID: a.CI, DocSpecialty: specialty}, sameDay, s.slots, op)
+}
+
+// insertAppointment adds a to the appointments table and returns it with
+// its ID.
+func insertAppointment(tx *sql.Tx, a Appointment) (Appointment, error) {
+	a = storedAppointment(a)
+	result, err := tx.Exec("INSERT INTO appointments (ci, date, time, duration, specialty, status) VALUES (?, ?, ?, ?, ?, ?)",
+		a.CI, a.Date, a.Time, a.Duration, a.Specialty, string(a.Status))
+	if err != nil {
+		return Appointment{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Appointment{}, err
+	}
+	a.ID = uint64(id)
+	return a, nil
+}
+
+// ListAppointments returns the history of a patient, oldest first.
+func (s *SQLitePatientStore) ListAppointments(ci string) ([]Appointment, error) {
+	if _, err := s.GetPatient(ci); err != nil {
+		return nil, err
+	}
+	return queryAppointments(s.db, "list appointments", "ci = ? ORDER BY date, time, id", ci)
+}
+
+func (s *SQLitePatientStore) CreateAppointment(a Appointment) (Appointment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Appointment{}, sqliteError("create appointment", err)
+	}
+	defer tx.Rollback()
+	a, err = s.prepareAppointment(tx, a, "create appointment")
+	if err != nil {
+		return Appointment{}, err
+	}
+	a, err = insertAppointment(tx, a)
+	if err != nil {
+		return Appointment{}, sqliteError("create appointment", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Appointment{}, sqliteError("create appointment", err)
+	}
+	return a, nil
+}
+
+func (s *SQLitePatientStore) CancelAppointment(id uint64) error {
+	op := fmt.Sprintf("cancel appointment %d", id)
+	var status string
+	err := s.db.QueryRow("SELECT status FROM appointments WHERE id = ?", id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &NotFoundError{Op: op}
+	}
+	if err != nil {
+		return sqliteError(op, err)
+	}
+	if status == string(AppointmentCancelled) {
+		return &CodeError{Op: op + ", already cancelled", Code: codeInvalidArg}
+	}
+	if _, err := s.db.Exec("UPDATE appointments SET status = ? WHERE id = ?", string(AppointmentCancelled), id); err != nil {
+		return sqliteError(op, err)
+	}
+	return nil
+}
+
+// list returns the patients matching `where`, in insertion order.
+func (s *SQLitePatientStore) list(op string, where string, args ...any) ([]Patient, error) {
+	rows, err := s.db.Query("SELECT rowid, "+patientColumns+" FROM patients WHERE "+where+" ORDER BY rowid", args...)
+	if err != nil {
+		return nil, sqliteError(op, err)
+	}
+	defer rows.Close()
+
+	result := []Patient{}
+	for rows.Next() {
+		p, _, err := scanPatient(rows)
+		if err != nil {
+			return nil, sqliteError(op, err)
+		}
+		result = append(result, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError(op, err)
+	}
+	return result, nil
+}
+
+func (s *SQLitePatientStore) ListPatients() ([]Patient, error) {
+	return s.list("list patients", "1")
+}
+
+func (s *SQLitePatientStore) ListDisabledPatients() ([]Patient, error) {
+	return s.list("list disabled patients", "disability = 1")
+}
+
+func (s *SQLitePatientStore) ListPatientsByAppointmentDate(date string) ([]Patient, error) {
+	return s.list("list patients by appointment date", "appointment_date = ?", date)
+}
+
+func (s *SQLitePatientStore) ListPatientsBySpecialty(specialty string) ([]Patient, error) {
+	return s.list("list patients by specialty", "doc_specialty = ?", specialty)
+}
+
+func (s *SQLitePatientStore) ListFemalePatients() ([]Patient, error) {
+	return s.list("list female patients", "gender = 'F'")
+}
+
+func (s *SQLitePatientStore) ListMalePatients() ([]Patient, error) {
+	return s.list("list male patients", "gender = 'M'")
+}
+
+func (s *SQLitePatientStore) ListPatientsUnderAge(ageLimit int) ([]Patient, error) {
+	// Ages of 0 or less are invalid and skipped, as in patient_metrics.c
+	return s.list(fmt.Sprintf("list patients under age %d", ageLimit), "age > 0 AND age < ?", ageLimit)
+}
+
+// Verify runs SQLite's integrity check. Problems with the database file
+// come back as an error matching ErrCorrupt; the report only counts rows.
+func (s *SQLitePatientStore) Verify() (*VerifyReport, error) {
+	rows, err := s.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, sqliteError("verify patients database", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, sqliteError("verify patients database", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("verify patients database", err)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("verify patients database: %w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+
+	report := &VerifyReport{}
+	if err := s.db.QueryRow("SELECT count(*) FROM patients").Scan(&report.Records); err != nil {
+		return nil, sqliteError("verify patients database", err)
+	}
+	report.Indexed = report.Records
+	return report, nil
+}
+
+// Compact rebuilds the database file without its free pages.
+func (s *SQLitePatientStore) Compact() error {
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return sqliteError("compact patients database", err)
+	}
+	return nil
+}
+
+// Save has nothing to do: every change was committed when it was made.
+func (s *SQLitePatientStore) Save() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build cgo
+
+package models
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMirrorFrom(t *testing.T) {
+	forEachFileBackend(t, func(t *testing.T, backend string) {
+		dir := t.TempDir()
+		src := openStore(t, backend, dir)
+		addPatients(t, src, alice, bob, carla)
+		for _, a := range []Appointment{
+			{CI: alice.ID, Date: "2024-04-20", Time: "11:30"},
+			{CI: bob.ID, Date: "2024-04-21"},
+			{CI: carla.ID, Date: "2024-04-22"},
+		} {
+			if _, err := src.CreateAppointment(a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := src.CancelAppointment(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.DeletePatient(carla.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// What the database held before is replaced, not merged
+		dst := openStore(t, "sqlite", dir)
+		stale := carla
+		stale.Name = "Carla Stale"
+		addPatients(t, dst, stale)
+		if _, err := dst.CreateAppointment(Appointment{CI: stale.ID, Date: "2024-05-01"}); err != nil {
+			t.Fatal(err)
+		}
+
+		patients, appointments, err := dst.(StoreMirror).MirrorFrom(src)
+		if err != nil || patients != 2 || appointments != 3 {
+			t.Fatalf("mirror = %d, %d, %v, want 2 patients and 3 appointments", patients, appointments, err)
+		}
+		list, err := dst.ListPatients()
+		checkCIs(t, "list patients", list, err, alice.ID, bob.ID)
+		for _, p := range []Patient{alice, bob} {
+			want, err := src.GetPatient(p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStored(t, dst, want.Patient)
+			wantAppointments, err := src.ListAppointments(p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := dst.ListAppointments(p.ID)
+			if err != nil || !slices.Equal(got, wantAppointments) {
+				t.Errorf("appointments of %s = %v, %v, want %v", p.ID, got, err, wantAppointments)
+			}
+		}
+		// Carla's history came along with its ID, cancelled by the delete
+		if err := dst.CancelAppointment(3); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("cancel appointment 3 = %v, want it already cancelled", err)
+		}
+		if a, err := dst.CreateAppointment(Appointment{CI: alice.ID, Date: "2024-06-01"}); err != nil || a.ID != 4 {
+			t.Errorf("create after mirror = %+v, %v, want appointment 4", a, err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package models
+
+// PatientStats summarizes a list of patients.
+type PatientStats struct {
+	Total             int            `json:"total"`
+	Disabled          int            `json:"disabled"`
+	Female            int            `json:"female"`
+	Male              int            `json:"male"`
+	AverageAge        float64        `json:"average_age"`
+	BySpecialty       map[string]int `json:"by_specialty"`
+	ByAppointmentDate map[string]int `json:"by_appointment_date"`
+}
+
+// ComputeStats counts patients the way the List filters select them.
+// AverageAge leaves out the ages of 0 or less that ListPatientsUnderAge
+// treats as invalid.
+func ComputeStats(patients []Patient) PatientStats {
+	stats := PatientStats{
+		Total:             len(patients),
+		BySpecialty:       map[string]int{},
+		ByAppointmentDate: map[string]int{},
+	}
+	ageSum, aged := 0, 0
+	for _, p := range patients {
+		if p.Disability {
+			stats.Disabled++
+		}
+		switch p.Gender {
+		case 'F':
+			stats.Female++
+		case 'M':
+			stats.Male++
+		}
+		if p.Age > 0 {
+			ageSum += p.Age
+			aged++
+		}
+		stats.BySpecialty[p.DocSpecialty]++
+		stats.ByAppointmentDate[p.AppointmentDate]++
+	}
+	if aged > 0 {
+		stats.AverageAge = float64(ageSum) / float64(aged)
+	}
+	return stats
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Notes receives what the stores do on their own while opening, such as
+// rebuilding an index or migrating an old file. It is io.Discard unless the
+// caller wants them, as main does with -verbose.
+var Notes io.Writer = io.Discard
+
+func notef(format string, args ...any) {
+	fmt.Fprintf(Notes, format, args...)
+}
+
+// PatientStore is a patient database kept in one directory. Implementations
+// share the on-disk formats, so a directory written by one opens with any
+// other.
+type PatientStore interface {
+	// Open finishes an interrupted save, migrates old files and loads the
+	// patients. A missing directory or patients file is an empty database.
+	// If the patients can't be loaded the error is returned but the store
+	// can still Verify the files.
+	Open() error
+	// Close releases what the store holds; it does not save.
+	Close()
+	// DataDir is the directory holding the data files.
+	DataDir() string
+
+	GetPatient(ci string) (*PatientResponse, error)
+	AddPatient(p Patient) error
+	UpdatePatient(p Patient) error
+	// ScheduleAppointment books a time slot for the patient a.CI, like
+	// CreateAppointment but with a.Time required, and makes a.Date the
+	// patient's appointment date.
+	ScheduleAppointment(a Appointment) (Appointment, error)
+	// DeletePatient removes a patient and cancels their scheduled
+	// appointments, which stay in the history.
+	DeletePatient(ci string) error
+
+	// ListAppointments returns a patient's appointments, cancelled ones
+	// included, by date and time.
+	ListAppointments(ci string) ([]Appointment, error)
+	// CreateAppointment adds an appointment for the patient a.CI and returns
+	// it with its ID. The specialty defaults to the patient's and the
+	// duration to the specialty's slot length. One with a time is refused
+	// with a BookingError if it overlaps another of the patient's or its
+	// specialty has no capacity left then, see SlotConfig.
+	CreateAppointment(a Appointment) (Appointment, error)
+	// CancelAppointment marks an appointment cancelled; it stays in the
+	// history.
+	CancelAppointment(id uint64) error
+
+	ListPatients() ([]Patient, error)
+	ListDisabledPatients() ([]Patient, error)
+	ListPatientsByAppointmentDate(date string) ([]Patient, error)
+	ListPatientsBySpecialty(specialty string) ([]Patient, error)
+	ListFemalePatients() ([]Patient, error)
+	ListMalePatients() ([]Patient, error)
+	ListPatientsUnderAge(ageLimit int) ([]Patient, error)
+
+	Verify() (*VerifyReport, error)
+	// Compact drops the slots left by deleted patients from the patients file.
+	Compact() error
+	// Save commits the patients and index files and clears the mutation log.
+	Save() error
+	// ImportPatients adds many patients at once. Those whose CI is already
+	// in the store are handled by opts.OnConflict, checked under the same
+	// lock as the write, and their CIs are returned in batch order; under
+	// ConflictFail any of them rejects the batch with a *DuplicateError.
+	// Either all of the batch is stored or, on error, none.
+	ImportPatients(patients []Patient, opts ImportOptions) (conflicts []string, err error)
+}
+
+// StoreMirror is a store that can be made to hold exactly what a file
+// backend holds, as migrate-sqlite does with the sqlite backend.
+type StoreMirror interface {
+	// MirrorFrom replaces everything stored with the patients of src and
+	// every appointment in its appointments.bin, keeping their IDs, and
+	// returns how many of each it now holds.
+	MirrorFrom(src PatientStore) (patients, appointments int, err error)
+}
+
+// Backends by name. "go" is always there; "cgo" and "sqlite" register
+// themselves when the package is built with cgo.
+var backends = map[string]func(dataDir string) (PatientStore, error){
+	"go": func(dataDir string) (PatientStore, error) {
+		return NewGoPatientStore(dataDir), nil
+	},
+}
+
+// Backends lists the names accepted by NewPatientStore.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultBackend is the C engine when it is built in, the Go one otherwise.
+func DefaultBackend() string {
+	if _, ok := backends["cgo"]; ok {
+		return "cgo"
+	}
+	return "go"
+}
+
+// NewPatientStore creates a store of the named backend for the database in
+// dataDir. The files are not touched until Open.
+func NewPatientStore(backend string, dataDir string) (PatientStore, error) {
+	newStore, ok := backends[backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q, want one of %v", backend, Backends())
+	}
+	return newStore(dataDir)
+}
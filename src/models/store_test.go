@@ -0,0 +1,568 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	alice = Patient{ID: "12345678", Name: "Alice Johnson", Age: 34, Diagnosis: "Hypertension", Gender: 'F', DocSpecialty: "Cardiology", AppointmentDate: "2024-02-15"}
+	bob   = Patient{ID: "87654321", Name: "Bob Smith", Age: 47, Diagnosis: "Diabetes", Gender: 'M', Disability: true, DocSpecialty: "Endocrinology", AppointmentDate: "2024-03-10"}
+	carla = Patient{ID: "11223344", Name: "Carla Gomez", Age: 9, Diagnosis: "Asthma", Gender: 'F', DocSpecialty: "Pulmonology", AppointmentDate: "2024-02-15"}
+)
+
+// openStore opens a store of backend on dir, closed when the test ends.
+func openStore(t *testing.T, backend string, dir string) PatientStore {
+	t.Helper()
+	s, err := NewPatientStore(backend, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(); err != nil {
+		s.Close()
+		t.Fatalf("open %s store: %v", backend, err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// reopen closes s and opens its directory again with backend.
+func reopen(t *testing.T, s PatientStore, backend string) PatientStore {
+	t.Helper()
+	s.Close()
+	return openStore(t, backend, s.DataDir())
+}
+
+func addPatients(t *testing.T, s PatientStore, patients ...Patient) {
+	t.Helper()
+	for _, p := range patients {
+		if err := s.AddPatient(p); err != nil {
+			t.Fatalf("add %s: %v", p.ID, err)
+		}
+	}
+}
+
+func checkStored(t *testing.T, s PatientStore, want Patient) {
+	t.Helper()
+	got, err := s.GetPatient(want.ID)
+	if err != nil {
+		t.Fatalf("get %s: %v", want.ID, err)
+	}
+	if got.Patient != want {
+		t.Errorf("get %s = %+v, want %+v", want.ID, got.Patient, want)
+	}
+}
+
+func checkGone(t *testing.T, s PatientStore, ci string) {
+	t.Helper()
+	if _, err := s.GetPatient(ci); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get %s = %v, want ErrNotFound", ci, err)
+	}
+}
+
+// checkCIs compares the CIs of patients, in any order, with want.
+func checkCIs(t *testing.T, what string, patients []Patient, err error, want ...string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	var got []string
+	for _, p := range patients {
+		got = append(got, p.ID)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func checkAppointments(t *testing.T, s PatientStore, ci string, want ...AppointmentStatus) []Appointment {
+	t.Helper()
+	list, err := s.ListAppointments(ci)
+	if err != nil {
+		t.Fatalf("list appointments of %s: %v", ci, err)
+	}
+	var got []AppointmentStatus
+	for _, a := range list {
+		got = append(got, a.Status)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("appointments of %s = %v, want %v", ci, list, want)
+	}
+	return list
+}
+
+func checkVerify(t *testing.T, s PatientStore, indexed int) {
+	t.Helper()
+	report, err := s.Verify()
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Indexed != indexed {
+		t.Errorf("verify = %+v, want OK with %d indexed", report, indexed)
+	}
+}
+
+// datLine formats p as a line of patients.dat.
+func datLine(p Patient) string {
+	disability := "0"
+	if p.Disability {
+		disability = "1"
+	}
+	return strings.Join([]string{p.ID, p.Name, strconv.Itoa(p.Age), p.Diagnosis, string(p.Gender), disability, p.DocSpecialty, p.AppointmentDate}, "|")
+}
+
+// checkReport compares the counts of an import report and the lines of its
+// errors, each matching its sentinel, with want.
+func checkReport(t *testing.T, report *ImportReport, added, updated, skipped int, want map[int]error) {
+	t.Helper()
+	if report.Added != added || report.Updated != updated || report.Skipped != skipped {
+		t.Errorf("report = %d added, %d updated, %d skipped, want %d, %d, %d",
+			report.Added, report.Updated, report.Skipped, added, updated, skipped)
+	}
+	var lines []int
+	for _, lineErr := range report.Errors {
+		lines = append(lines, lineErr.Line)
+		if !errors.Is(lineErr, want[lineErr.Line]) {
+			t.Errorf("%v, want %v", lineErr, want[lineErr.Line])
+		}
+	}
+	if len(lines) != len(want) || !slices.IsSorted(lines) {
+		t.Errorf("errors on lines %v, want %d errors in order", lines, len(want))
+	}
+}
+
+var storeTests = []struct {
+	name string
+	test func(t *testing.T, s PatientStore, backend string)
+}{
+	{"add and get", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob)
+		checkStored(t, s, alice)
+		checkStored(t, s, bob)
+		checkGone(t, s, carla.ID)
+		if err := s.AddPatient(alice); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("adding %s again = %v, want ErrDuplicate", alice.ID, err)
+		}
+		bad := carla
+		bad.ID = "1234"
+		var validationErr *ValidationError
+		if err := s.AddPatient(bad); !errors.As(err, &validationErr) || validationErr.Code != codeFieldCIFormat {
+			t.Errorf("adding CI %q = %v, want code %d", bad.ID, err, codeFieldCIFormat)
+		}
+		bad = carla
+		bad.Gender = 'X'
+		if err := s.AddPatient(bad); !errors.As(err, &validationErr) || validationErr.Code != codeFieldGenderInvalid {
+			t.Errorf("adding gender X = %v, want code %d", err, codeFieldGenderInvalid)
+		}
+		checkGone(t, s, carla.ID)
+	}},
+	{"update", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice)
+		updated := alice
+		updated.Name = "Alice Smith"
+		updated.Age = 35
+		if err := s.UpdatePatient(updated); err != nil {
+			t.Fatal(err)
+		}
+		checkStored(t, s, updated)
+		if err := s.UpdatePatient(bob); !errors.Is(err, ErrNotFound) {
+			t.Errorf("updating %s = %v, want ErrNotFound", bob.ID, err)
+		}
+		updated.Name = ""
+		if err := s.UpdatePatient(updated); !errors.Is(err, ErrValidation) {
+			t.Errorf("updating with no name = %v, want ErrValidation", err)
+		}
+	}},
+	{"delete and re-add", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob, carla)
+		if err := s.DeletePatient(bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		checkGone(t, s, bob.ID)
+		if err := s.DeletePatient(bob.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting %s again = %v, want ErrNotFound", bob.ID, err)
+		}
+		patients, err := s.ListPatients()
+		checkCIs(t, "list", patients, err, alice.ID, carla.ID)
+		addPatients(t, s, bob)
+		checkStored(t, s, bob)
+		checkStored(t, s, carla)
+	}},
+	{"list filters", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob, carla)
+		patients, err := s.ListFemalePatients()
+		checkCIs(t, "female", patients, err, alice.ID, carla.ID)
+		patients, err = s.ListMalePatients()
+		checkCIs(t, "male", patients, err, bob.ID)
+		patients, err = s.ListDisabledPatients()
+		checkCIs(t, "disabled", patients, err, bob.ID)
+		patients, err = s.ListPatientsByAppointmentDate("2024-02-15")
+		checkCIs(t, "by date", patients, err, alice.ID, carla.ID)
+		patients, err = s.ListPatientsBySpecialty("Endocrinology")
+		checkCIs(t, "by specialty", patients, err, bob.ID)
+		patients, err = s.ListPatientsUnderAge(18)
+		checkCIs(t, "under 18", patients, err, carla.ID)
+	}},
+	{"appointments", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob)
+		first, err := s.CreateAppointment(Appointment{CI: alice.ID, Date: "2024-05-02", Time: "09:00"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.ID == 0 || first.Specialty != alice.DocSpecialty || first.Duration != DefaultSlotConfig.Default.Duration || first.Status != AppointmentScheduled {
+			t.Errorf("created %+v, want an ID and the patient's defaults", first)
+		}
+		// Alice is busy then, and Cardiology has one place per slot
+		clash := Appointment{CI: alice.ID, Date: "2024-05-02", Time: "09:15", Specialty: "Dermatology"}
+		if _, err := s.CreateAppointment(clash); !errors.Is(err, ErrBooking) {
+			t.Errorf("overlapping appointment = %v, want ErrBooking", err)
+		}
+		full := Appointment{CI: bob.ID, Date: "2024-05-02", Time: "09:00", Specialty: "Cardiology"}
+		if _, err := s.CreateAppointment(full); !errors.Is(err, ErrBooking) {
+			t.Errorf("appointment in a full slot = %v, want ErrBooking", err)
+		}
+		if _, err := s.CreateAppointment(Appointment{CI: carla.ID, Date: "2024-05-02", Time: "10:00"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("appointment for a missing patient = %v, want ErrNotFound", err)
+		}
+
+		scheduled, err := s.ScheduleAppointment(Appointment{CI: alice.ID, Date: "2024-04-20", Time: "11:30"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ScheduleAppointment(Appointment{CI: alice.ID, Date: "2024-04-21"}); err == nil {
+			t.Error("scheduling without a time succeeded")
+		}
+		moved := alice
+		moved.AppointmentDate = "2024-04-20"
+		checkStored(t, s, moved)
+		list := checkAppointments(t, s, alice.ID, AppointmentScheduled, AppointmentScheduled)
+		if list[0].ID != scheduled.ID || list[1].ID != first.ID {
+			t.Errorf("appointments of %s = %v, want them by date", alice.ID, list)
+		}
+
+		if err := s.CancelAppointment(first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CancelAppointment(first.ID); err == nil {
+			t.Error("cancelling twice succeeded")
+		}
+		if err := s.CancelAppointment(999); !errors.Is(err, ErrNotFound) {
+			t.Errorf("cancelling a missing appointment = %v, want ErrNotFound", err)
+		}
+		// The cancelled slot is free again
+		if _, err := s.CreateAppointment(full); err != nil {
+			t.Errorf("booking a freed slot: %v", err)
+		}
+		checkAppointments(t, s, alice.ID, AppointmentScheduled, AppointmentCancelled)
+
+		if err := s.DeletePatient(alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		addPatients(t, s, alice)
+		checkAppointments(t, s, alice.ID, AppointmentCancelled, AppointmentCancelled)
+	}},
+	{"import", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice)
+		changed := alice
+		changed.Diagnosis = "Arrhythmia"
+		batch := []Patient{changed, bob}
+
+		conflicts, err := s.ImportPatients(batch, ImportOptions{OnConflict: ConflictFail})
+		if !errors.Is(err, ErrDuplicate) || !slices.Equal(conflicts, []string{alice.ID}) {
+			t.Errorf("import failing on conflicts = %v, %v", conflicts, err)
+		}
+		checkGone(t, s, bob.ID)
+		if _, err := s.ImportPatients(batch, ImportOptions{OnConflict: ConflictOverwrite, DryRun: true}); err != nil {
+			t.Fatal(err)
+		}
+		checkGone(t, s, bob.ID)
+		if _, err := s.ImportPatients(batch, ImportOptions{OnConflict: ConflictSkip}); err != nil {
+			t.Fatal(err)
+		}
+		checkStored(t, s, alice)
+		checkStored(t, s, bob)
+		if _, err := s.ImportPatients(batch, ImportOptions{OnConflict: ConflictOverwrite}); err != nil {
+			t.Fatal(err)
+		}
+		checkStored(t, s, changed)
+	}},
+	{"import dat", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice)
+		changed := alice
+		changed.Diagnosis = "Arrhythmia"
+		badAge := strings.Replace(datLine(carla), "|9|", "|nine|", 1)
+		badDisability := strings.Replace(datLine(carla), "|F|0|", "|F|2|", 1)
+		badDate := strings.Replace(datLine(carla), "2024-02-15", "2024-2-15", 1)
+		dat := strings.Join([]string{
+			datLine(changed), // 1: already stored
+			"",
+			datLine(bob),
+			"12345679|Short line", // 4
+			badAge,
+			datLine(bob), // 6: also on line 3
+			badDisability,
+			badDate,
+			datLine(carla),
+		}, "\n") + "\n"
+		want := map[int]error{1: ErrDuplicate, 4: ErrCorrupt, 5: ErrValidation, 6: ErrDuplicate, 7: ErrCorrupt, 8: ErrValidation}
+
+		report, err := ImportPatientsDat(s, strings.NewReader(dat), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReport(t, report, 2, 0, 0, want)
+		checkStored(t, s, alice)
+		checkGone(t, s, bob.ID)
+		checkGone(t, s, carla.ID)
+
+		report, err = ImportPatientsDat(s, strings.NewReader(dat), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReport(t, report, 2, 0, 0, want)
+		checkStored(t, s, alice)
+		checkStored(t, s, bob)
+		checkStored(t, s, carla)
+	}},
+	{"import csv", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice)
+		changed := alice
+		changed.Diagnosis = "Arrhythmia, mild"
+		quoted := bob
+		quoted.Diagnosis = "Diabetes, type 2\nfollow up"
+		var buf bytes.Buffer
+		if err := WritePatientsCSV(&buf, []Patient{changed, quoted}); err != nil {
+			t.Fatal(err)
+		}
+		importCSV := func(policy ConflictPolicy, dryRun bool) (*ImportReport, error) {
+			t.Helper()
+			report, err := ImportPatientsCSV(s, bytes.NewReader(buf.Bytes()), CSVImportOptions{OnConflict: policy, DryRun: dryRun})
+			if report == nil {
+				t.Fatalf("import under %s: %v", policy, err)
+			}
+			return report, err
+		}
+
+		// The conflict is rejected, so Bob isn't imported either
+		report, err := importCSV(ConflictFail, false)
+		if !errors.Is(err, ErrImportRejected) {
+			t.Errorf("import failing on conflicts = %v, want ErrImportRejected", err)
+		}
+		checkReport(t, report, 1, 0, 0, map[int]error{2: ErrDuplicate})
+		checkGone(t, s, quoted.ID)
+
+		for _, policy := range []ConflictPolicy{ConflictSkip, ConflictOverwrite, ConflictFail} {
+			report, err := importCSV(policy, true)
+			switch policy {
+			case ConflictSkip:
+				checkReport(t, report, 1, 0, 1, nil)
+			case ConflictOverwrite:
+				checkReport(t, report, 1, 1, 0, nil)
+			case ConflictFail:
+				checkReport(t, report, 1, 0, 0, map[int]error{2: ErrDuplicate})
+			}
+			if (err != nil) != (policy == ConflictFail) {
+				t.Errorf("dry run under %s = %v", policy, err)
+			}
+			checkStored(t, s, alice)
+			checkGone(t, s, quoted.ID)
+		}
+
+		report, err = importCSV(ConflictSkip, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReport(t, report, 1, 0, 1, nil)
+		checkStored(t, s, alice)
+		checkStored(t, s, quoted)
+
+		report, err = importCSV(ConflictOverwrite, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReport(t, report, 0, 2, 0, nil)
+		checkStored(t, s, changed)
+
+		// One bad row and nothing is imported, its line counted past the
+		// quoted newline
+		bad := buf.String() + "11223344,Carla Gomez,nine,Asthma,F,0,Pulmonology,2024-02-15\n" + datLine(carla) + "\n"
+		report, err = ImportPatientsCSV(s, strings.NewReader(bad), CSVImportOptions{OnConflict: ConflictOverwrite})
+		if !errors.Is(err, ErrImportRejected) {
+			t.Errorf("import with a bad row = %v, want ErrImportRejected", err)
+		}
+		checkReport(t, report, 0, 2, 0, map[int]error{5: ErrValidation, 6: ErrCorrupt})
+		checkGone(t, s, carla.ID)
+	}},
+	{"save and reopen", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob, carla)
+		if err := s.DeletePatient(bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ScheduleAppointment(Appointment{CI: carla.ID, Date: "2024-06-01", Time: "08:00"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+		// Changes after the save are only in the log until the next one
+		updated := alice
+		updated.Age = 40
+		if err := s.UpdatePatient(updated); err != nil {
+			t.Fatal(err)
+		}
+
+		s = reopen(t, s, backend)
+		checkStored(t, s, updated)
+		checkGone(t, s, bob.ID)
+		moved := carla
+		moved.AppointmentDate = "2024-06-01"
+		checkStored(t, s, moved)
+		checkAppointments(t, s, carla.ID, AppointmentScheduled)
+		patients, err := s.ListPatients()
+		checkCIs(t, "list", patients, err, alice.ID, carla.ID)
+
+		if err := s.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		s = reopen(t, s, backend)
+		checkStored(t, s, updated)
+		checkStored(t, s, moved)
+	}},
+	{"verify", func(t *testing.T, s PatientStore, backend string) {
+		addPatients(t, s, alice, bob, carla)
+		if err := s.DeletePatient(alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		// index.dat only catches up on Save
+		if report, err := s.Verify(); err != nil || !report.OK() {
+			t.Errorf("verify before saving = %v, %v", report, err)
+		}
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+		checkVerify(t, s, 2)
+		s = reopen(t, s, backend)
+		checkVerify(t, s, 2)
+		if backend == "sqlite" {
+			return
+		}
+
+		// A flipped byte in a saved record fails its checksum
+		file, err := os.OpenFile(filepath.Join(s.DataDir(), patientFileName), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteAt([]byte{'#'}, recordOffset(1)+20); err != nil {
+			t.Fatal(err)
+		}
+		report, err := s.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.CorruptRecords) != 1 || report.CorruptRecords[0].Position != 1 {
+			t.Errorf("verify after damage = %+v, want record 1 corrupt", report)
+		}
+	}},
+}
+
+func TestImportCSVHeaders(t *testing.T) {
+	row := "\n12345678,Alice Johnson,34,Hypertension,F,0,Cardiology,2024-02-15\n"
+	tests := []struct {
+		name    string
+		csv     string
+		added   int
+		refused bool // as a corrupt file, before any row is read
+	}{
+		{name: "export header", csv: strings.Join(csvHeader, ",") + row, added: 1},
+		{name: "any order and case", csv: "Name,CI,age,Diagnosis,gender,disability,doc_specialty,appointment_date" +
+			"\nAlice Johnson,12345678,34,Hypertension,F,0,Cardiology,2024-02-15\n", added: 1},
+		{name: "byte order mark", csv: "\ufeff" + strings.Join(csvHeader, ",") + row, added: 1},
+		{name: "padded names", csv: strings.Join(csvHeader, " , ") + row, added: 1},
+		{name: "header only", csv: strings.Join(csvHeader, ",") + "\n"},
+		{name: "empty file", csv: "", refused: true},
+		{name: "unknown column", csv: strings.Join(csvHeader, ",") + ",notes" + strings.TrimSuffix(row, "\n") + ",x\n", refused: true},
+		{name: "repeated column", csv: "ci,name,age,diagnosis,gender,disability,doc_specialty,ci" + row, refused: true},
+		{name: "missing column", csv: "ci,name,age,diagnosis,gender,disability,doc_specialty" +
+			"\n12345678,Alice Johnson,34,Hypertension,F,0,Cardiology\n", refused: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := openStore(t, "go", t.TempDir())
+			report, err := ImportPatientsCSV(s, strings.NewReader(test.csv), CSVImportOptions{OnConflict: ConflictFail})
+			switch {
+			case test.refused && (report != nil || !errors.Is(err, ErrCorrupt)):
+				t.Fatalf("import = %+v, %v, want the file refused as corrupt", report, err)
+			case !test.refused && (err != nil || report.Added != test.added || len(report.Errors) > 0):
+				t.Fatalf("import = %+v, %v, want %d added", report, err, test.added)
+			}
+			list, err := s.ListPatients()
+			if err != nil || len(list) != test.added {
+				t.Errorf("stored %v, %v, want %d patients", list, err, test.added)
+			}
+		})
+	}
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range Backends() {
+		for _, tt := range storeTests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				tt.test(t, openStore(t, backend, t.TempDir()), backend)
+			})
+		}
+	}
+}
+
+// The file backends share patients.bin, index.dat and patients.wal, so each
+// must open what the other wrote, saved or still in the log.
+func TestFileBackendsOpenEachOther(t *testing.T) {
+	if !slices.Contains(Backends(), "cgo") {
+		t.Skip("built without cgo")
+	}
+	for _, pair := range [][2]string{{"go", "cgo"}, {"cgo", "go"}} {
+		writer, reader := pair[0], pair[1]
+		t.Run(writer+" to "+reader, func(t *testing.T) {
+			s := openStore(t, writer, t.TempDir())
+			addPatients(t, s, alice, bob, carla)
+			if err := s.DeletePatient(alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateAppointment(Appointment{CI: bob.ID, Date: "2024-07-01", Time: "10:00"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Save(); err != nil {
+				t.Fatal(err)
+			}
+			updated := carla
+			updated.Diagnosis = "Bronchitis"
+			if err := s.UpdatePatient(updated); err != nil {
+				t.Fatal(err)
+			}
+			addPatients(t, s, alice)
+
+			s = reopen(t, s, reader)
+			checkStored(t, s, alice)
+			checkStored(t, s, bob)
+			checkStored(t, s, updated)
+			checkAppointments(t, s, bob.ID, AppointmentScheduled)
+			checkVerify(t, s, 3)
+
+			// And back, after the reader has saved
+			if err := s.Save(); err != nil {
+				t.Fatal(err)
+			}
+			s = reopen(t, s, writer)
+			checkStored(t, s, updated)
+			checkVerify(t, s, 3)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type Gender byte
+
+func (g Gender) String() string {
+	switch g {
+	case 'M':
+		return "Male"
+	case 'F':
+		return "Female"
+	default:
+		return "Unknown"
+	}
+}
+
+type Patient struct {
+	ID              string
+	Name            string
+	Age             int
+	Diagnosis       string
+	Gender          byte
+	Disability      bool
+	DocSpecialty    string
+	AppointmentDate string
+}
+
+type PatientIndex struct {
+	CI       string // up to 8 characters
+	Position uint   // index in the patients slice
+}
+
+type PatientResponse struct {
+	Patient Patient
+	Index   uint
+}
+
+// ValidateAppointmentDate checks that date is a real YYYY-MM-DD day, as
+// appointments and the list filter by date need.
+func ValidateAppointmentDate(date string) error {
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return &ValidationError{Op: "schedule appointment", Field: "AppointmentDate", Code: codeFieldAppointmentDateFormat}
+	}
+	return nil
+}
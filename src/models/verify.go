@@ -0,0 +1,40 @@
+package models
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../csrc -DCGO_BUILD
+#include "patient.h"
+#include "errors.h"
+#include <stdlib.h>
+*/
+import "C"
+
+// Verify checks every record of patients.bin against its checksum and
+// every entry of index.dat against the record it points at.
+func (s *PatientService) Verify() (*VerifyReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v := newVerifier()
+	if err := v.indexFile(C.GoString(&s.db.index_file[0]), C.GoString(&s.db.wal_file[0])); err != nil {
+		return nil, err
+	}
+
+	var page [C.PAGE_SIZE]C.Patient
+	var status [C.PAGE_SIZE]C.int
+	for offset := C.size_t(0); ; {
+		var read C.size_t
+		errCode, errno := C.LoadPatientsPageChecked(&s.db, &page[0], &status[0], offset, C.PAGE_SIZE, &read)
+		if errCode != 0 {
+			return nil, codeError("read patients page", "", errCode, errno)
+		}
+		if read == 0 {
+			break
+		}
+		for i := 0; i < int(read); i++ {
+			v.record(int(offset)+i, C.GoString(&page[i].ci[0]), status[i] != 0)
+		}
+		offset += read
+	}
+
+	return v.finish(), nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// CorruptRecord is a record of patients.bin that failed its checksum.
+type CorruptRecord struct {
+	Position int
+	CI       string // as stored, may itself be garbled
+}
+
+// IndexIssue is an index entry that doesn't lead to the patient it names.
+type IndexIssue struct {
+	CI       string
+	Position int
+	Problem  string
+}
+
+// VerifyReport is the result of PatientService.Verify.
+type VerifyReport struct {
+	Records        int
+	Indexed        int
+	CorruptRecords []CorruptRecord
+	IndexIssues    []IndexIssue
+}
+
+// OK reports whether no problems were found.
+func (r VerifyReport) OK() bool {
+	return len(r.CorruptRecords) == 0 && len(r.IndexIssues) == 0
+}
+
+func (r VerifyReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %d records and %d index entries.\n", r.Records, r.Indexed)
+	if r.OK() {
+		b.WriteString("No problems found.\n")
+		return b.String()
+	}
+	if len(r.CorruptRecords) > 0 {
+		fmt.Fprintf(&b, "%d corrupt records:\n", len(r.CorruptRecords))
+		for _, c := range r.CorruptRecords {
+			fmt.Fprintf(&b, "  record %d (CI %q): checksum mismatch\n", c.Position, c.CI)
+		}
+	}
+	if len(r.IndexIssues) > 0 {
+		fmt.Fprintf(&b, "%d bad index entries:\n", len(r.IndexIssues))
+		for _, i := range r.IndexIssues {
+			fmt.Fprintf(&b, "  CI %s -> record %d: %s\n", i.CI, i.Position, i.Problem)
+		}
+	}
+	return b.String()
+}
+
+// verifier builds a VerifyReport as the records of patients.bin go by, so
+// each backend only has to feed it the entries of index.dat and then the
+// records.
+type verifier struct {
+	report   VerifyReport
+	expected map[int][]string // index entries still to check, by position
+}
+
+func newVerifier() *verifier {
+	return &verifier{expected: map[int][]string{}}
+}
+
+// indexFile registers every entry of the index.dat at path, as written. A
+// missing file has none. Entries of patients deleted in the log at walPath
+// are skipped: index.dat only catches up with those on the next save.
+func (v *verifier) indexFile(path string, walPath string) error {
+	_, entries, err := readIndexLines(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	logged, err := readWal(walPath)
+	if err != nil {
+		return err
+	}
+	deleted := map[string]bool{}
+	for _, entry := range logged {
+		if entry.op == walDelete {
+			deleted[entry.patient.ID] = true
+		}
+	}
+	for _, entry := range entries {
+		if !deleted[entry.ci] {
+			v.indexed(entry.ci, entry.position)
+		}
+	}
+	return nil
+}
+
+// indexed registers an index entry.
+func (v *verifier) indexed(ci string, position int) {
+	v.report.Indexed++
+	v.expected[position] = append(v.expected[position], ci)
+}
+
+// record checks the record stored at position against the entries pointing
+// at it. Records must be fed after every index entry.
+func (v *verifier) record(position int, ci string, corrupt bool) {
+	v.report.Records++
+	if corrupt {
+		v.report.CorruptRecords = append(v.report.CorruptRecords, CorruptRecord{Position: position, CI: ci})
+	}
+	for _, want := range v.expected[position] {
+		switch {
+		case corrupt:
+			v.report.IndexIssues = append(v.report.IndexIssues, IndexIssue{want, position, "record is corrupt"})
+		case ci == "":
+			v.report.IndexIssues = append(v.report.IndexIssues, IndexIssue{want, position, "record is empty"})
+		case ci != want:
+			v.report.IndexIssues = append(v.report.IndexIssues, IndexIssue{want, position, fmt.Sprintf("record holds CI %s", ci)})
+		}
+	}
+	delete(v.expected, position)
+}
+
+// finish reports the entries left over, which point past the end of the file.
+func (v *verifier) finish() *VerifyReport {
+	var past []IndexIssue
+	for pos, cis := range v.expected {
+		for _, want := range cis {
+			past = append(past, IndexIssue{want, pos, "position past the end of the file"})
+		}
+	}
+	sort.Slice(past, func(i, j int) bool { return past[i].Position < past[j].Position })
+	v.report.IndexIssues = append(v.report.IndexIssues, past...)
+	return &v.report
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+)
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../csrc -DCGO_BUILD
+#include "patient.h"
+#include "errors.h"
+#include "patient_wal.h"
+#include <stdlib.h>
+*/
+import "C"
+
+// logMutation journals a change in patients.wal before it is applied.
+func (s *PatientService) logMutation(op C.int, p *C.Patient) error {
+	errCode, errno := C.AppendWal(&s.db, op, p)
+	if errCode != 0 {
+		return codeError("write patient log", C.GoString(&p.ci[0]), errCode, errno)
+	}
+	return nil
+}
+
+// unlogMutation takes back the entry logMutation last wrote.
+func (s *PatientService) unlogMutation() error {
+	return dropWalEntry(C.GoString(&s.db.wal_file[0]))
+}
+
+// ReplayLog re-applies the mutations logged since the last checkpoint and,
+// if a log was left, checkpoints them into the data files.
+func (s *PatientService) ReplayLog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replayLog()
+}
+
+func (s *PatientService) replayLog() error {
+	var replayed C.size_t
+	errCode, errno := C.ReplayWal(&s.db, &s.patients.count, &s.index, &s.free, &replayed)
+	if errCode != 0 {
+		return codeError("replay patient log", "", errCode, errno)
+	}
+	if replayed == 0 {
+		// A torn tail is all that's left; checkpoint anyway to clear it
+		if left, err := walExists(C.GoString(&s.db.wal_file[0])); err != nil || !left {
+			return err
+		}
+		return s.save()
+	}
+
+	if err := s.loadPatients(); err != nil {
+		return fmt.Errorf("failed to reload patients after replaying the log: %w", err)
+	}
+	return s.save()
+}
+
+// Save writes the patients and index files atomically as a single commit and
+// clears the mutation log they now include.
+func (s *PatientService) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+func (s *PatientService) save() error {
+	errorCode, errno := C.CheckpointWal(&s.db, &s.patients, &s.index, &s.free)
+	if errorCode != 0 {
+		return codeError("save patients and index", "", errorCode, errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package patientpb holds the protobuf messages and gRPC stubs generated
+// from patient.proto.
+package patientpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative patient.proto
@@ -0,0 +1,884 @@
+// Patient lookups and scheduling over gRPC, mirroring the PatientStore
+// operations. Regenerate the Go code with `go generate ./src/rpc/...`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: patient.proto
+
+package patientpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Gender int32
+
+const (
+	Gender_GENDER_UNSPECIFIED Gender = 0
+	Gender_GENDER_MALE        Gender = 1
+	Gender_GENDER_FEMALE      Gender = 2
+)
+
+// Enum value maps for Gender.
+var (
+	Gender_name = map[int32]string{
+		0: "GENDER_UNSPECIFIED",
+		1: "GENDER_MALE",
+		2: "GENDER_FEMALE",
+	}
+	Gender_value = map[string]int32{
+		"GENDER_UNSPECIFIED": 0,
+		"GENDER_MALE":        1,
+		"GENDER_FEMALE":      2,
+	}
+)
+
+func (x Gender) Enum() *Gender {
+	p := new(Gender)
+	*p = x
+	return p
+}
+
+func (x Gender) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Gender) Descriptor() protoreflect.EnumDescriptor {
+	return file_patient_proto_enumTypes[0].Descriptor()
+}
+
+func (Gender) Type() protoreflect.EnumType {
+	return &file_patient_proto_enumTypes[0]
+}
+
+func (x Gender) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Gender.Descriptor instead.
+func (Gender) EnumDescriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{0}
+}
+
+type Patient struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Ci           string                 `protobuf:"bytes,1,opt,name=ci,proto3" json:"ci,omitempty"`
+	Name         string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Age          int32                  `protobuf:"varint,3,opt,name=age,proto3" json:"age,omitempty"`
+	Diagnosis    string                 `protobuf:"bytes,4,opt,name=diagnosis,proto3" json:"diagnosis,omitempty"`
+	Gender       Gender                 `protobuf:"varint,5,opt,name=gender,proto3,enum=medappoint.patient.v1.Gender" json:"gender,omitempty"`
+	Disability   bool                   `protobuf:"varint,6,opt,name=disability,proto3" json:"disability,omitempty"`
+	DocSpecialty string                 `protobuf:"bytes,7,opt,name=doc_specialty,json=docSpecialty,proto3" json:"doc_specialty,omitempty"`
+	// YYYY-MM-DD
+	AppointmentDate string `protobuf:"bytes,8,opt,name=appointment_date,json=appointmentDate,proto3" json:"appointment_date,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Patient) Reset() {
+	*x = Patient{}
+	mi := &file_patient_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Patient) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Patient) ProtoMessage() {}
+
+func (x *Patient) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Patient.ProtoReflect.Descriptor instead.
+func (*Patient) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Patient) GetCi() string {
+	if x != nil {
+		return x.Ci
+	}
+	return ""
+}
+
+func (x *Patient) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Patient) GetAge() int32 {
+	if x != nil {
+		return x.Age
+	}
+	return 0
+}
+
+func (x *Patient) GetDiagnosis() string {
+	if x != nil {
+		return x.Diagnosis
+	}
+	return ""
+}
+
+func (x *Patient) GetGender() Gender {
+	if x != nil {
+		return x.Gender
+	}
+	return Gender_GENDER_UNSPECIFIED
+}
+
+func (x *Patient) GetDisability() bool {
+	if x != nil {
+		return x.Disability
+	}
+	return false
+}
+
+func (x *Patient) GetDocSpecialty() string {
+	if x != nil {
+		return x.DocSpecialty
+	}
+	return ""
+}
+
+func (x *Patient) GetAppointmentDate() string {
+	if x != nil {
+		return x.AppointmentDate
+	}
+	return ""
+}
+
+type GetPatientRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ci            string                 `protobuf:"bytes,1,opt,name=ci,proto3" json:"ci,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPatientRequest) Reset() {
+	*x = GetPatientRequest{}
+	mi := &file_patient_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPatientRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPatientRequest) ProtoMessage() {}
+
+func (x *GetPatientRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPatientRequest.ProtoReflect.Descriptor instead.
+func (*GetPatientRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetPatientRequest) GetCi() string {
+	if x != nil {
+		return x.Ci
+	}
+	return ""
+}
+
+type AddPatientRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Patient       *Patient               `protobuf:"bytes,1,opt,name=patient,proto3" json:"patient,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddPatientRequest) Reset() {
+	*x = AddPatientRequest{}
+	mi := &file_patient_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddPatientRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddPatientRequest) ProtoMessage() {}
+
+func (x *AddPatientRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddPatientRequest.ProtoReflect.Descriptor instead.
+func (*AddPatientRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AddPatientRequest) GetPatient() *Patient {
+	if x != nil {
+		return x.Patient
+	}
+	return nil
+}
+
+type UpdatePatientRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Patient       *Patient               `protobuf:"bytes,1,opt,name=patient,proto3" json:"patient,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePatientRequest) Reset() {
+	*x = UpdatePatientRequest{}
+	mi := &file_patient_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePatientRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePatientRequest) ProtoMessage() {}
+
+func (x *UpdatePatientRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePatientRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePatientRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UpdatePatientRequest) GetPatient() *Patient {
+	if x != nil {
+		return x.Patient
+	}
+	return nil
+}
+
+type DeletePatientRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ci            string                 `protobuf:"bytes,1,opt,name=ci,proto3" json:"ci,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeletePatientRequest) Reset() {
+	*x = DeletePatientRequest{}
+	mi := &file_patient_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeletePatientRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeletePatientRequest) ProtoMessage() {}
+
+func (x *DeletePatientRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeletePatientRequest.ProtoReflect.Descriptor instead.
+func (*DeletePatientRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeletePatientRequest) GetCi() string {
+	if x != nil {
+		return x.Ci
+	}
+	return ""
+}
+
+type DeletePatientResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeletePatientResponse) Reset() {
+	*x = DeletePatientResponse{}
+	mi := &file_patient_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeletePatientResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeletePatientResponse) ProtoMessage() {}
+
+func (x *DeletePatientResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeletePatientResponse.ProtoReflect.Descriptor instead.
+func (*DeletePatientResponse) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{5}
+}
+
+type ScheduleAppointmentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ci    string                 `protobuf:"bytes,1,opt,name=ci,proto3" json:"ci,omitempty"`
+	// YYYY-MM-DD
+	Date string `protobuf:"bytes,2,opt,name=date,proto3" json:"date,omitempty"`
+	// HH:MM
+	Time string `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	// Minutes; 0 for the specialty's slot length.
+	DurationMinutes int32 `protobuf:"varint,4,opt,name=duration_minutes,json=durationMinutes,proto3" json:"duration_minutes,omitempty"`
+	// Empty for the patient's specialty.
+	Specialty     string `protobuf:"bytes,5,opt,name=specialty,proto3" json:"specialty,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScheduleAppointmentRequest) Reset() {
+	*x = ScheduleAppointmentRequest{}
+	mi := &file_patient_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleAppointmentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleAppointmentRequest) ProtoMessage() {}
+
+func (x *ScheduleAppointmentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleAppointmentRequest.ProtoReflect.Descriptor instead.
+func (*ScheduleAppointmentRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ScheduleAppointmentRequest) GetCi() string {
+	if x != nil {
+		return x.Ci
+	}
+	return ""
+}
+
+func (x *ScheduleAppointmentRequest) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *ScheduleAppointmentRequest) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *ScheduleAppointmentRequest) GetDurationMinutes() int32 {
+	if x != nil {
+		return x.DurationMinutes
+	}
+	return 0
+}
+
+func (x *ScheduleAppointmentRequest) GetSpecialty() string {
+	if x != nil {
+		return x.Specialty
+	}
+	return ""
+}
+
+type ListPatientsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Filter:
+	//
+	//	*ListPatientsRequest_Disabled
+	//	*ListPatientsRequest_Gender
+	//	*ListPatientsRequest_AppointmentDate
+	//	*ListPatientsRequest_Specialty
+	//	*ListPatientsRequest_UnderAge
+	Filter        isListPatientsRequest_Filter `protobuf_oneof:"filter"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPatientsRequest) Reset() {
+	*x = ListPatientsRequest{}
+	mi := &file_patient_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPatientsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPatientsRequest) ProtoMessage() {}
+
+func (x *ListPatientsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPatientsRequest.ProtoReflect.Descriptor instead.
+func (*ListPatientsRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListPatientsRequest) GetFilter() isListPatientsRequest_Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *ListPatientsRequest) GetDisabled() bool {
+	if x != nil {
+		if x, ok := x.Filter.(*ListPatientsRequest_Disabled); ok {
+			return x.Disabled
+		}
+	}
+	return false
+}
+
+func (x *ListPatientsRequest) GetGender() Gender {
+	if x != nil {
+		if x, ok := x.Filter.(*ListPatientsRequest_Gender); ok {
+			return x.Gender
+		}
+	}
+	return Gender_GENDER_UNSPECIFIED
+}
+
+func (x *ListPatientsRequest) GetAppointmentDate() string {
+	if x != nil {
+		if x, ok := x.Filter.(*ListPatientsRequest_AppointmentDate); ok {
+			return x.AppointmentDate
+		}
+	}
+	return ""
+}
+
+func (x *ListPatientsRequest) GetSpecialty() string {
+	if x != nil {
+		if x, ok := x.Filter.(*ListPatientsRequest_Specialty); ok {
+			return x.Specialty
+		}
+	}
+	return ""
+}
+
+func (x *ListPatientsRequest) GetUnderAge() int32 {
+	if x != nil {
+		if x, ok := x.Filter.(*ListPatientsRequest_UnderAge); ok {
+			return x.UnderAge
+		}
+	}
+	return 0
+}
+
+type isListPatientsRequest_Filter interface {
+	isListPatientsRequest_Filter()
+}
+
+type ListPatientsRequest_Disabled struct {
+	// Only true is accepted.
+	Disabled bool `protobuf:"varint,1,opt,name=disabled,proto3,oneof"`
+}
+
+type ListPatientsRequest_Gender struct {
+	Gender Gender `protobuf:"varint,2,opt,name=gender,proto3,enum=medappoint.patient.v1.Gender,oneof"`
+}
+
+type ListPatientsRequest_AppointmentDate struct {
+	AppointmentDate string `protobuf:"bytes,3,opt,name=appointment_date,json=appointmentDate,proto3,oneof"`
+}
+
+type ListPatientsRequest_Specialty struct {
+	Specialty string `protobuf:"bytes,4,opt,name=specialty,proto3,oneof"`
+}
+
+type ListPatientsRequest_UnderAge struct {
+	UnderAge int32 `protobuf:"varint,5,opt,name=under_age,json=underAge,proto3,oneof"`
+}
+
+func (*ListPatientsRequest_Disabled) isListPatientsRequest_Filter() {}
+
+func (*ListPatientsRequest_Gender) isListPatientsRequest_Filter() {}
+
+func (*ListPatientsRequest_AppointmentDate) isListPatientsRequest_Filter() {}
+
+func (*ListPatientsRequest_Specialty) isListPatientsRequest_Filter() {}
+
+func (*ListPatientsRequest_UnderAge) isListPatientsRequest_Filter() {}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_patient_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{8}
+}
+
+type Stats struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Total             int32                  `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Disabled          int32                  `protobuf:"varint,2,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	Female            int32                  `protobuf:"varint,3,opt,name=female,proto3" json:"female,omitempty"`
+	Male              int32                  `protobuf:"varint,4,opt,name=male,proto3" json:"male,omitempty"`
+	AverageAge        float64                `protobuf:"fixed64,5,opt,name=average_age,json=averageAge,proto3" json:"average_age,omitempty"`
+	BySpecialty       map[string]int32       `protobuf:"bytes,6,rep,name=by_specialty,json=bySpecialty,proto3" json:"by_specialty,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	ByAppointmentDate map[string]int32       `protobuf:"bytes,7,rep,name=by_appointment_date,json=byAppointmentDate,proto3" json:"by_appointment_date,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_patient_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_patient_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_patient_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Stats) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Stats) GetDisabled() int32 {
+	if x != nil {
+		return x.Disabled
+	}
+	return 0
+}
+
+func (x *Stats) GetFemale() int32 {
+	if x != nil {
+		return x.Female
+	}
+	return 0
+}
+
+func (x *Stats) GetMale() int32 {
+	if x != nil {
+		return x.Male
+	}
+	return 0
+}
+
+func (x *Stats) GetAverageAge() float64 {
+	if x != nil {
+		return x.AverageAge
+	}
+	return 0
+}
+
+func (x *Stats) GetBySpecialty() map[string]int32 {
+	if x != nil {
+		return x.BySpecialty
+	}
+	return nil
+}
+
+func (x *Stats) GetByAppointmentDate() map[string]int32 {
+	if x != nil {
+		return x.ByAppointmentDate
+	}
+	return nil
+}
+
+var File_patient_proto protoreflect.FileDescriptor
+
+const file_patient_proto_rawDesc = "" +
+	"\n" +
+	"\rpatient.proto\x12\x15medappoint.patient.v1\"\x84\x02\n" +
+	"\aPatient\x12\x0e\n" +
+	"\x02ci\x18\x01 \x01(\tR\x02ci\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x10\n" +
+	"\x03age\x18\x03 \x01(\x05R\x03age\x12\x1c\n" +
+	"\tdiagnosis\x18\x04 \x01(\tR\tdiagnosis\x125\n" +
+	"\x06gender\x18\x05 \x01(\x0e2\x1d.medappoint.patient.v1.GenderR\x06gender\x12\x1e\n" +
+	"\n" +
+	"disability\x18\x06 \x01(\bR\n" +
+	"disability\x12#\n" +
+	"\rdoc_specialty\x18\a \x01(\tR\fdocSpecialty\x12)\n" +
+	"\x10appointment_date\x18\b \x01(\tR\x0fappointmentDate\"#\n" +
+	"\x11GetPatientRequest\x12\x0e\n" +
+	"\x02ci\x18\x01 \x01(\tR\x02ci\"M\n" +
+	"\x11AddPatientRequest\x128\n" +
+	"\apatient\x18\x01 \x01(\v2\x1e.medappoint.patient.v1.PatientR\apatient\"P\n" +
+	"\x14UpdatePatientRequest\x128\n" +
+	"\apatient\x18\x01 \x01(\v2\x1e.medappoint.patient.v1.PatientR\apatient\"&\n" +
+	"\x14DeletePatientRequest\x12\x0e\n" +
+	"\x02ci\x18\x01 \x01(\tR\x02ci\"\x17\n" +
+	"\x15DeletePatientResponse\"\x9d\x01\n" +
+	"\x1aScheduleAppointmentRequest\x12\x0e\n" +
+	"\x02ci\x18\x01 \x01(\tR\x02ci\x12\x12\n" +
+	"\x04date\x18\x02 \x01(\tR\x04date\x12\x12\n" +
+	"\x04time\x18\x03 \x01(\tR\x04time\x12)\n" +
+	"\x10duration_minutes\x18\x04 \x01(\x05R\x0fdurationMinutes\x12\x1c\n" +
+	"\tspecialty\x18\x05 \x01(\tR\tspecialty\"\xe2\x01\n" +
+	"\x13ListPatientsRequest\x12\x1c\n" +
+	"\bdisabled\x18\x01 \x01(\bH\x00R\bdisabled\x127\n" +
+	"\x06gender\x18\x02 \x01(\x0e2\x1d.medappoint.patient.v1.GenderH\x00R\x06gender\x12+\n" +
+	"\x10appointment_date\x18\x03 \x01(\tH\x00R\x0fappointmentDate\x12\x1e\n" +
+	"\tspecialty\x18\x04 \x01(\tH\x00R\tspecialty\x12\x1d\n" +
+	"\tunder_age\x18\x05 \x01(\x05H\x00R\bunderAgeB\b\n" +
+	"\x06filter\"\x11\n" +
+	"\x0fGetStatsRequest\"\xc3\x03\n" +
+	"\x05Stats\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x05R\x05total\x12\x1a\n" +
+	"\bdisabled\x18\x02 \x01(\x05R\bdisabled\x12\x16\n" +
+	"\x06female\x18\x03 \x01(\x05R\x06female\x12\x12\n" +
+	"\x04male\x18\x04 \x01(\x05R\x04male\x12\x1f\n" +
+	"\vaverage_age\x18\x05 \x01(\x01R\n" +
+	"averageAge\x12P\n" +
+	"\fby_specialty\x18\x06 \x03(\v2-.medappoint.patient.v1.Stats.BySpecialtyEntryR\vbySpecialty\x12c\n" +
+	"\x13by_appointment_date\x18\a \x03(\v23.medappoint.patient.v1.Stats.ByAppointmentDateEntryR\x11byAppointmentDate\x1a>\n" +
+	"\x10BySpecialtyEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\x1aD\n" +
+	"\x16ByAppointmentDateEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01*D\n" +
+	"\x06Gender\x12\x16\n" +
+	"\x12GENDER_UNSPECIFIED\x10\x00\x12\x0f\n" +
+	"\vGENDER_MALE\x10\x01\x12\x11\n" +
+	"\rGENDER_FEMALE\x10\x022\xa4\x05\n" +
+	"\x0ePatientService\x12V\n" +
+	"\n" +
+	"GetPatient\x12(.medappoint.patient.v1.GetPatientRequest\x1a\x1e.medappoint.patient.v1.Patient\x12V\n" +
+	"\n" +
+	"AddPatient\x12(.medappoint.patient.v1.AddPatientRequest\x1a\x1e.medappoint.patient.v1.Patient\x12\\\n" +
+	"\rUpdatePatient\x12+.medappoint.patient.v1.UpdatePatientRequest\x1a\x1e.medappoint.patient.v1.Patient\x12j\n" +
+	"\rDeletePatient\x12+.medappoint.patient.v1.DeletePatientRequest\x1a,.medappoint.patient.v1.DeletePatientResponse\x12h\n" +
+	"\x13ScheduleAppointment\x121.medappoint.patient.v1.ScheduleAppointmentRequest\x1a\x1e.medappoint.patient.v1.Patient\x12\\\n" +
+	"\fListPatients\x12*.medappoint.patient.v1.ListPatientsRequest\x1a\x1e.medappoint.patient.v1.Patient0\x01\x12P\n" +
+	"\bGetStats\x12&.medappoint.patient.v1.GetStatsRequest\x1a\x1c.medappoint.patient.v1.StatsB\x1cZ\x1affi-test/src/rpc/patientpbb\x06proto3"
+
+var (
+	file_patient_proto_rawDescOnce sync.Once
+	file_patient_proto_rawDescData []byte
+)
+
+func file_patient_proto_rawDescGZIP() []byte {
+	file_patient_proto_rawDescOnce.Do(func() {
+		file_patient_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_patient_proto_rawDesc), len(file_patient_proto_rawDesc)))
+	})
+	return file_patient_proto_rawDescData
+}
+
+var file_patient_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_patient_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_patient_proto_goTypes = []any{
+	(Gender)(0),                        // 0: medappoint.patient.v1.Gender
+	(*Patient)(nil),                    // 1: medappoint.patient.v1.Patient
+	(*GetPatientRequest)(nil),          // 2: medappoint.patient.v1.GetPatientRequest
+	(*AddPatientRequest)(nil),          // 3: medappoint.patient.v1.AddPatientRequest
+	(*UpdatePatientRequest)(nil),       // 4: medappoint.patient.v1.UpdatePatientRequest
+	(*DeletePatientRequest)(nil),       // 5: medappoint.patient.v1.DeletePatientRequest
+	(*DeletePatientResponse)(nil),      // 6: medappoint.patient.v1.DeletePatientResponse
+	(*ScheduleAppointmentRequest)(nil), // 7: medappoint.patient.v1.ScheduleAppointmentRequest
+	(*ListPatientsRequest)(nil),        // 8: medappoint.patient.v1.ListPatientsRequest
+	(*GetStatsRequest)(nil),            // 9: medappoint.patient.v1.GetStatsRequest
+	(*Stats)(nil),                      // 10: medappoint.patient.v1.Stats
+	nil,                                // 11: medappoint.patient.v1.Stats.BySpecialtyEntry
+	nil,                                // 12: medappoint.patient.v1.Stats.ByAppointmentDateEntry
+}
+var file_patient_proto_depIdxs = []int32{
+	0,  // 0: medappoint.patient.v1.Patient.gender:type_name -> medappoint.patient.v1.Gender
+	1,  // 1: medappoint.patient.v1.AddPatientRequest.patient:type_name -> medappoint.patient.v1.Patient
+	1,  // 2: medappoint.patient.v1.UpdatePatientRequest.patient:type_name -> medappoint.patient.v1.Patient
+	0,  // 3: medappoint.patient.v1.ListPatientsRequest.gender:type_name -> medappoint.patient.v1.Gender
+	11, // 4: medappoint.patient.v1.Stats.by_specialty:type_name -> medappoint.patient.v1.Stats.BySpecialtyEntry
+	12, // 5: medappoint.patient.v1.Stats.by_appointment_date:type_name -> medappoint.patient.v1.Stats.ByAppointmentDateEntry
+	2,  // 6: medappoint.patient.v1.PatientService.GetPatient:input_type -> medappoint.patient.v1.GetPatientRequest
+	3,  // 7: medappoint.patient.v1.PatientService.AddPatient:input_type -> medappoint.patient.v1.AddPatientRequest
+	4,  // 8: medappoint.patient.v1.PatientService.UpdatePatient:input_type -> medappoint.patient.v1.UpdatePatientRequest
+	5,  // 9: medappoint.patient.v1.PatientService.DeletePatient:input_type -> medappoint.patient.v1.DeletePatientRequest
+	7,  // 10: medappoint.patient.v1.PatientService.ScheduleAppointment:input_type -> medappoint.patient.v1.ScheduleAppointmentRequest
+	8,  // 11: medappoint.patient.v1.PatientService.ListPatients:input_type -> medappoint.patient.v1.ListPatientsRequest
+	9,  // 12: medappoint.patient.v1.PatientService.GetStats:input_type -> medappoint.patient.v1.GetStatsRequest
+	1,  // 13: medappoint.patient.v1.PatientService.GetPatient:output_type -> medappoint.patient.v1.Patient
+	1,  // 14: medappoint.patient.v1.PatientService.AddPatient:output_type -> medappoint.patient.v1.Patient
+	1,  // 15: medappoint.patient.v1.PatientService.UpdatePatient:output_type -> medappoint.patient.v1.Patient
+	6,  // 16: medappoint.patient.v1.PatientService.DeletePatient:output_type -> medappoint.patient.v1.DeletePatientResponse
+	1,  // 17: medappoint.patient.v1.PatientService.ScheduleAppointment:output_type -> medappoint.patient.v1.Patient
+	1,  // 18: medappoint.patient.v1.PatientService.ListPatients:output_type -> medappoint.patient.v1.Patient
+	10, // 19: medappoint.patient.v1.PatientService.GetStats:output_type -> medappoint.patient.v1.Stats
+	13, // [13:20] is the sub-list for method output_type
+	6,  // [6:13] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_patient_proto_init() }
+func file_patient_proto_init() {
+	if File_patient_proto != nil {
+		return
+	}
+	file_patient_proto_msgTypes[7].OneofWrappers = []any{
+		(*ListPatientsRequest_Disabled)(nil),
+		(*ListPatientsRequest_Gender)(nil),
+		(*ListPatientsRequest_AppointmentDate)(nil),
+		(*ListPatientsRequest_Specialty)(nil),
+		(*ListPatientsRequest_UnderAge)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_patient_proto_rawDesc), len(file_patient_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_patient_proto_goTypes,
+		DependencyIndexes: file_patient_proto_depIdxs,
+		EnumInfos:         file_patient_proto_enumTypes,
+		MessageInfos:      file_patient_proto_msgTypes,
+	}.Build()
+	File_patient_proto = out.File
+	file_patient_proto_goTypes = nil
+	file_patient_proto_depIdxs = nil
+}
@@ -0,0 +1,254 @@
+// Package rpc serves the patient store over gRPC, as described in
+// patientpb/patient.proto.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"ffi-test/src/models"
+	"ffi-test/src/rpc/patientpb"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the ErrorInfo domain of errors carrying a csrc/errors.h code.
+const errorDomain = "medappoint"
+
+// Server implements patientpb.PatientServiceServer on a store. Changes go
+// through the store's own logging; saving it is left to the caller.
+type Server struct {
+	patientpb.UnimplementedPatientServiceServer
+	store models.PatientStore
+}
+
+// NewServer creates the gRPC service for store.
+func NewServer(store models.PatientStore) *Server {
+	return &Server{store: store}
+}
+
+// Register adds the service for store to s.
+func Register(s grpc.ServiceRegistrar, store models.PatientStore) {
+	patientpb.RegisterPatientServiceServer(s, NewServer(store))
+}
+
+// statusError converts a store error to a gRPC status: InvalidArgument for
+// fields NewPatient rejects, NotFound and AlreadyExists for unknown and
+// duplicate CIs, FailedPrecondition for slots that can't be booked, DataLoss
+// for damaged files and Internal for the rest. An
+// ErrorInfo detail carries the errors.h name as its reason, and validation
+// errors also get a BadRequest naming the field.
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, models.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, models.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, models.ErrDuplicate):
+		code = codes.AlreadyExists
+	case errors.Is(err, models.ErrBooking):
+		code = codes.FailedPrecondition
+	case errors.Is(err, models.ErrCorrupt):
+		code = codes.DataLoss
+	}
+	st := status.New(code, err.Error())
+
+	errorCode := models.ErrorCode(err)
+	if errorCode == 0 {
+		return st.Err()
+	}
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason:   models.CodeName(errorCode),
+		Domain:   errorDomain,
+		Metadata: map[string]string{"code": strconv.Itoa(errorCode)},
+	}}
+	var validation *models.ValidationError
+	if errors.As(err, &validation) {
+		details = append(details, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       validation.Field,
+				Description: err.Error(),
+			}},
+		})
+	}
+	if withDetails, detailErr := st.WithDetails(details...); detailErr == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func toProto(p models.Patient) *patientpb.Patient {
+	gender := patientpb.Gender_GENDER_UNSPECIFIED
+	switch p.Gender {
+	case 'M':
+		gender = patientpb.Gender_GENDER_MALE
+	case 'F':
+		gender = patientpb.Gender_GENDER_FEMALE
+	}
+	return &patientpb.Patient{
+		Ci:              p.ID,
+		Name:            p.Name,
+		Age:             int32(p.Age),
+		Diagnosis:       p.Diagnosis,
+		Gender:          gender,
+		Disability:      p.Disability,
+		DocSpecialty:    p.DocSpecialty,
+		AppointmentDate: p.AppointmentDate,
+	}
+}
+
+// fromProto converts a patient message. An unspecified gender becomes the
+// zero byte, which NewPatient rejects.
+func fromProto(p *patientpb.Patient) models.Patient {
+	var gender byte
+	switch p.GetGender() {
+	case patientpb.Gender_GENDER_MALE:
+		gender = 'M'
+	case patientpb.Gender_GENDER_FEMALE:
+		gender = 'F'
+	}
+	return models.Patient{
+		ID:              p.GetCi(),
+		Name:            p.GetName(),
+		Age:             int(p.GetAge()),
+		Diagnosis:       p.GetDiagnosis(),
+		Gender:          gender,
+		Disability:      p.GetDisability(),
+		DocSpecialty:    p.GetDocSpecialty(),
+		AppointmentDate: p.GetAppointmentDate(),
+	}
+}
+
+// stored returns the patient as the store kept it, after truncation.
+func (s *Server) stored(ci string) (*patientpb.Patient, error) {
+	response, err := s.store.GetPatient(ci)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toProto(response.Patient), nil
+}
+
+func (s *Server) GetPatient(ctx context.Context, req *patientpb.GetPatientRequest) (*patientpb.Patient, error) {
+	return s.stored(req.GetCi())
+}
+
+func (s *Server) AddPatient(ctx context.Context, req *patientpb.AddPatientRequest) (*patientpb.Patient, error) {
+	if req.GetPatient() == nil {
+		return nil, status.Error(codes.InvalidArgument, "patient is required")
+	}
+	p := fromProto(req.GetPatient())
+	if err := s.store.AddPatient(p); err != nil {
+		return nil, statusError(err)
+	}
+	return s.stored(p.ID)
+}
+
+func (s *Server) UpdatePatient(ctx context.Context, req *patientpb.UpdatePatientRequest) (*patientpb.Patient, error) {
+	if req.GetPatient() == nil {
+		return nil, status.Error(codes.InvalidArgument, "patient is required")
+	}
+	p := fromProto(req.GetPatient())
+	if err := s.store.UpdatePatient(p); err != nil {
+		return nil, statusError(err)
+	}
+	return s.stored(p.ID)
+}
+
+func (s *Server) DeletePatient(ctx context.Context, req *patientpb.DeletePatientRequest) (*patientpb.DeletePatientResponse, error) {
+	if err := s.store.DeletePatient(req.GetCi()); err != nil {
+		return nil, statusError(err)
+	}
+	return &patientpb.DeletePatientResponse{}, nil
+}
+
+func (s *Server) ScheduleAppointment(ctx context.Context, req *patientpb.ScheduleAppointmentRequest) (*patientpb.Patient, error) {
+	_, err := s.store.ScheduleAppointment(models.Appointment{
+		CI:        req.GetCi(),
+		Date:      req.GetDate(),
+		Time:      req.GetTime(),
+		Duration:  int(req.GetDurationMinutes()),
+		Specialty: req.GetSpecialty(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return s.stored(req.GetCi())
+}
+
+// list runs the List method picked by the request's filter.
+func (s *Server) list(req *patientpb.ListPatientsRequest) ([]models.Patient, error) {
+	switch filter := req.GetFilter().(type) {
+	case nil:
+		return s.store.ListPatients()
+	case *patientpb.ListPatientsRequest_Disabled:
+		if !filter.Disabled {
+			return nil, status.Error(codes.InvalidArgument, "the disabled filter only takes true")
+		}
+		return s.store.ListDisabledPatients()
+	case *patientpb.ListPatientsRequest_Gender:
+		switch filter.Gender {
+		case patientpb.Gender_GENDER_FEMALE:
+			return s.store.ListFemalePatients()
+		case patientpb.Gender_GENDER_MALE:
+			return s.store.ListMalePatients()
+		}
+		return nil, status.Error(codes.InvalidArgument, "the gender filter must be male or female")
+	case *patientpb.ListPatientsRequest_AppointmentDate:
+		if err := models.ValidateAppointmentDate(filter.AppointmentDate); err != nil {
+			return nil, err
+		}
+		return s.store.ListPatientsByAppointmentDate(filter.AppointmentDate)
+	case *patientpb.ListPatientsRequest_Specialty:
+		return s.store.ListPatientsBySpecialty(filter.Specialty)
+	case *patientpb.ListPatientsRequest_UnderAge:
+		return s.store.ListPatientsUnderAge(int(filter.UnderAge))
+	}
+	return nil, status.Error(codes.InvalidArgument, "unknown filter")
+}
+
+// ListPatients sends the patients one message at a time, so a long list
+// never has to fit in a single message.
+func (s *Server) ListPatients(req *patientpb.ListPatientsRequest, stream grpc.ServerStreamingServer[patientpb.Patient]) error {
+	patients, err := s.list(req)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return statusError(err)
+	}
+	for _, p := range patients {
+		if err := stream.Send(toProto(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) GetStats(ctx context.Context, req *patientpb.GetStatsRequest) (*patientpb.Stats, error) {
+	patients, err := s.store.ListPatients()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	stats := models.ComputeStats(patients)
+	out := &patientpb.Stats{
+		Total:             int32(stats.Total),
+		Disabled:          int32(stats.Disabled),
+		Female:            int32(stats.Female),
+		Male:              int32(stats.Male),
+		AverageAge:        stats.AverageAge,
+		BySpecialty:       map[string]int32{},
+		ByAppointmentDate: map[string]int32{},
+	}
+	for specialty, n := range stats.BySpecialty {
+		out.BySpecialty[specialty] = int32(n)
+	}
+	for date, n := range stats.ByAppointmentDate {
+		out.ByAppointmentDate[date] = int32(n)
+	}
+	return out, nil
+}
@@ -0,0 +1,278 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"ffi-test/src/models"
+	"ffi-test/src/rpc/patientpb"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// listSize is more patients than a page of the C patient list holds.
+const listSize = 250
+
+func alice() *patientpb.Patient {
+	return &patientpb.Patient{
+		Ci:              "12345678",
+		Name:            "Alice Johnson",
+		Age:             34,
+		Diagnosis:       "Hypertension",
+		Gender:          patientpb.Gender_GENDER_FEMALE,
+		DocSpecialty:    "Cardiology",
+		AppointmentDate: "2024-02-15",
+	}
+}
+
+// newTestClient serves the default backend, on a fresh directory, over an
+// in-process connection.
+func newTestClient(t *testing.T) (patientpb.PatientServiceClient, models.PatientStore) {
+	t.Helper()
+	store, err := models.NewPatientStore(models.DefaultBackend(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	Register(server, store)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return patientpb.NewPatientServiceClient(conn), store
+}
+
+// checkStatus checks that err is a status with code and, if reason isn't
+// empty, an ErrorInfo naming it.
+func checkStatus(t *testing.T, what string, err error, code codes.Code, reason string) *status.Status {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != code {
+		t.Errorf("%s = %v, want %s", what, err, code)
+		return st
+	}
+	if reason == "" {
+		return st
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetReason() == reason && info.GetDomain() == errorDomain {
+			return st
+		}
+	}
+	t.Errorf("%s details = %v, want ErrorInfo %s", what, st.Details(), reason)
+	return st
+}
+
+func TestUnaryRPCs(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	added, err := client.AddPatient(ctx, &patientpb.AddPatientRequest{Patient: alice()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.GetName() != "Alice Johnson" || added.GetGender() != patientpb.Gender_GENDER_FEMALE {
+		t.Errorf("added %v", added)
+	}
+
+	changed := alice()
+	changed.Age = 35
+	changed.Disability = true
+	updated, err := client.UpdatePatient(ctx, &patientpb.UpdatePatientRequest{Patient: changed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.GetAge() != 35 || !updated.GetDisability() {
+		t.Errorf("updated %v", updated)
+	}
+
+	scheduled, err := client.ScheduleAppointment(ctx, &patientpb.ScheduleAppointmentRequest{Ci: "12345678", Date: "2024-05-02", Time: "09:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduled.GetAppointmentDate() != "2024-05-02" {
+		t.Errorf("scheduled %v", scheduled)
+	}
+	got, err := client.GetPatient(ctx, &patientpb.GetPatientRequest{Ci: "12345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetAge() != 35 || got.GetAppointmentDate() != "2024-05-02" {
+		t.Errorf("got %v", got)
+	}
+
+	stats, err := client.GetStats(ctx, &patientpb.GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.GetTotal() != 1 || stats.GetFemale() != 1 || stats.GetDisabled() != 1 || stats.GetBySpecialty()["Cardiology"] != 1 {
+		t.Errorf("stats %v", stats)
+	}
+
+	if _, err := client.DeletePatient(ctx, &patientpb.DeletePatientRequest{Ci: "12345678"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetPatient(ctx, &patientpb.GetPatientRequest{Ci: "12345678"})
+	checkStatus(t, "get after delete", err, codes.NotFound, "ERR_NOT_FOUND")
+}
+
+func TestStatusCodes(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+	if _, err := client.AddPatient(ctx, &patientpb.AddPatientRequest{Patient: alice()}); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := alice()
+	missing.Ci = "99999999"
+	_, err := client.GetPatient(ctx, &patientpb.GetPatientRequest{Ci: missing.Ci})
+	checkStatus(t, "get a missing patient", err, codes.NotFound, "ERR_NOT_FOUND")
+	_, err = client.UpdatePatient(ctx, &patientpb.UpdatePatientRequest{Patient: missing})
+	checkStatus(t, "update a missing patient", err, codes.NotFound, "ERR_NOT_FOUND")
+	_, err = client.DeletePatient(ctx, &patientpb.DeletePatientRequest{Ci: missing.Ci})
+	checkStatus(t, "delete a missing patient", err, codes.NotFound, "ERR_NOT_FOUND")
+	_, err = client.ScheduleAppointment(ctx, &patientpb.ScheduleAppointmentRequest{Ci: missing.Ci, Date: "2024-05-02", Time: "09:00"})
+	checkStatus(t, "schedule for a missing patient", err, codes.NotFound, "ERR_NOT_FOUND")
+
+	_, err = client.AddPatient(ctx, &patientpb.AddPatientRequest{Patient: alice()})
+	checkStatus(t, "add a duplicate", err, codes.AlreadyExists, "ERR_DUPLICATE")
+	_, err = client.AddPatient(ctx, &patientpb.AddPatientRequest{})
+	checkStatus(t, "add without a patient", err, codes.InvalidArgument, "")
+
+	for _, tt := range []struct {
+		change func(p *patientpb.Patient)
+		reason string
+		field  string
+	}{
+		{func(p *patientpb.Patient) { p.Ci = "1234" }, "ERR_FIELD_CI_FORMAT", "ID"},
+		{func(p *patientpb.Patient) { p.Name = "" }, "ERR_FIELD_NAME_NULL", "Name"},
+		{func(p *patientpb.Patient) { p.Age = -1 }, "ERR_FIELD_AGE_INVALID", "Age"},
+		{func(p *patientpb.Patient) { p.Gender = patientpb.Gender_GENDER_UNSPECIFIED }, "ERR_FIELD_GENDER_INVALID", "Gender"},
+		{func(p *patientpb.Patient) { p.AppointmentDate = "soon" }, "ERR_FIELD_APPOINTMENT_DATE_FORMAT", "AppointmentDate"},
+	} {
+		p := alice()
+		p.Ci = "55555555"
+		tt.change(p)
+		_, err := client.AddPatient(ctx, &patientpb.AddPatientRequest{Patient: p})
+		st := checkStatus(t, "add with a bad "+tt.field, err, codes.InvalidArgument, tt.reason)
+		var field string
+		for _, detail := range st.Details() {
+			if bad, ok := detail.(*errdetails.BadRequest); ok && len(bad.GetFieldViolations()) == 1 {
+				field = bad.GetFieldViolations()[0].GetField()
+			}
+		}
+		if field != tt.field {
+			t.Errorf("add with a bad %s: BadRequest names %q", tt.field, field)
+		}
+	}
+
+	_, err = client.ScheduleAppointment(ctx, &patientpb.ScheduleAppointmentRequest{Ci: "12345678", Date: "2024-05-02"})
+	checkStatus(t, "schedule without a time", err, codes.InvalidArgument, "ERR_FIELD_APPOINTMENT_TIME_FORMAT")
+	if _, err := client.ScheduleAppointment(ctx, &patientpb.ScheduleAppointmentRequest{Ci: "12345678", Date: "2024-05-02", Time: "09:00"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.ScheduleAppointment(ctx, &patientpb.ScheduleAppointmentRequest{Ci: "12345678", Date: "2024-05-02", Time: "09:10"})
+	checkStatus(t, "schedule an overlapping slot", err, codes.FailedPrecondition, "ERR_APPOINTMENT_CONFLICT")
+}
+
+// listAll drains a ListPatients stream.
+func listAll(t *testing.T, client patientpb.PatientServiceClient, req *patientpb.ListPatientsRequest) ([]*patientpb.Patient, error) {
+	t.Helper()
+	stream, err := client.ListPatients(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	var patients []*patientpb.Patient
+	for {
+		p, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return patients, nil
+		}
+		if err != nil {
+			return patients, err
+		}
+		patients = append(patients, p)
+	}
+}
+
+func TestListPatientsStream(t *testing.T) {
+	client, store := newTestClient(t)
+	patients := make([]models.Patient, listSize)
+	for i := range patients {
+		patients[i] = models.Patient{
+			ID:              fmt.Sprintf("%08d", 10000000+i),
+			Name:            fmt.Sprintf("Patient %d", i),
+			Age:             i % 80,
+			Diagnosis:       "Checkup",
+			Gender:          "FM"[i%2],
+			Disability:      i%5 == 0,
+			DocSpecialty:    []string{"Cardiology", "Pulmonology"}[i%2],
+			AppointmentDate: fmt.Sprintf("2024-01-%02d", 1+i%28),
+		}
+	}
+	if _, err := store.ImportPatients(patients, models.ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		req  *patientpb.ListPatientsRequest
+		keep func(p models.Patient) bool
+	}{
+		{"all", &patientpb.ListPatientsRequest{}, func(p models.Patient) bool { return true }},
+		{"female", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_Gender{Gender: patientpb.Gender_GENDER_FEMALE}}, func(p models.Patient) bool { return p.Gender == 'F' }},
+		{"male", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_Gender{Gender: patientpb.Gender_GENDER_MALE}}, func(p models.Patient) bool { return p.Gender == 'M' }},
+		{"disabled", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_Disabled{Disabled: true}}, func(p models.Patient) bool { return p.Disability }},
+		{"date", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_AppointmentDate{AppointmentDate: "2024-01-03"}}, func(p models.Patient) bool { return p.AppointmentDate == "2024-01-03" }},
+		{"specialty", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_Specialty{Specialty: "Pulmonology"}}, func(p models.Patient) bool { return p.DocSpecialty == "Pulmonology" }},
+		{"under age", &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_UnderAge{UnderAge: 10}}, func(p models.Patient) bool { return p.Age > 0 && p.Age < 10 }},
+	} {
+		got, err := listAll(t, client, tt.req)
+		if err != nil {
+			t.Errorf("list %s: %v", tt.name, err)
+			continue
+		}
+		want := map[string]bool{}
+		for _, p := range patients {
+			if tt.keep(p) {
+				want[p.ID] = true
+			}
+		}
+		for _, p := range got {
+			if !want[p.GetCi()] {
+				t.Errorf("list %s sent %s", tt.name, p.GetCi())
+			}
+			delete(want, p.GetCi())
+		}
+		if len(want) > 0 {
+			t.Errorf("list %s left out %d patients", tt.name, len(want))
+		}
+	}
+
+	_, err := listAll(t, client, &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_Disabled{Disabled: false}})
+	checkStatus(t, "list with disabled=false", err, codes.InvalidArgument, "")
+	_, err = listAll(t, client, &patientpb.ListPatientsRequest{Filter: &patientpb.ListPatientsRequest_AppointmentDate{AppointmentDate: "2024-02-30"}})
+	checkStatus(t, "list by a bad date", err, codes.InvalidArgument, "ERR_FIELD_APPOINTMENT_DATE_FORMAT")
+}
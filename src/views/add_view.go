@@ -1,7 +1,7 @@
 package views
 
 import (
-	"ffi-test/global"
+	"errors"
 	"ffi-test/src/models"
 	"ffi-test/src/utils"
 
@@ -10,14 +10,16 @@ import (
 )
 
 type AddModel struct {
+	service PatientService
 	BaseModel
 	focusIndex   int
 	inputPatient PatientInput
 	err          error
+	duplicateCI  string          // CI rejected as taken, flagged on the field until it changes
 	addedPatient *models.Patient // This will hold the patient added after validation
 }
 
-func NewAddModel(parent tea.Model, parentBase BaseModel) AddModel {
+func NewAddModel(service PatientService, parent tea.Model, parentBase BaseModel) AddModel {
 	inputs := NewPatientInput()
 	inputs.ID.Focus()
 	inputs.ID.PromptStyle = focusedStyle
@@ -25,6 +27,7 @@ func NewAddModel(parent tea.Model, parentBase BaseModel) AddModel {
 
 	breadcrumb := append(parentBase.Breadcrumb, "Add Patient")
 	return AddModel{
+		service: service,
 		BaseModel: BaseModel{
 			Parent:     parent,
 			Width:      parentBase.Width,
@@ -49,8 +52,11 @@ func (m AddModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc":
 			return m.Parent, nil
 		case "ctrl+c":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			cmd, err := SaveAndQuit(m.service)
+			if err != nil {
+				m.err = err
+			}
+			return m, cmd
 			// Set focus to next input
 		case "tab", "shift+tab", "enter", "up", "down":
 			if err := m.inputPatient.Validate(); err != nil {
@@ -66,8 +72,11 @@ func (m AddModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if s == "enter" {
 				if m.err == nil && m.focusIndex == len(inputList) {
 					patient := m.inputPatient.ToPatient()
-					err := global.PatientsService.AddPatient(patient)
-					if err != nil {
+					err := m.service.AddPatient(patient)
+					var dupErr *models.DuplicateError
+					if errors.As(err, &dupErr) {
+						m.duplicateCI = dupErr.CI
+					} else if err != nil {
 						m.err = err
 					} else {
 						m.addedPatient = &patient
@@ -141,7 +150,11 @@ func (m AddModel) View() string {
 	// Create the breadcrumb view
 	breadcrumbStr := utils.BreadcrumbView(m.Breadcrumb)
 	s := breadcrumbStr + "\n\n" + utils.AlignW("Add Patient Form", m.Width) + "\n"
-	s += utils.AlignW(PatientAddFormView(m.inputPatient.AsList(), m.focusIndex), m.Width) + "\n"
+	var fieldErrors map[int]string
+	if m.duplicateCI != "" && m.inputPatient.ID.Value() == m.duplicateCI {
+		fieldErrors = map[int]string{0: "already registered"}
+	}
+	s += utils.AlignW(PatientFormView(m.inputPatient.AsList(), m.focusIndex, fieldErrors), m.Width) + "\n"
 	if m.err != nil {
 		s += utils.AlignW(errorStyle.Render(m.err.Error()), m.Width) + "\n"
 	}
@@ -1,7 +1,6 @@
 package views
 
 import (
-	"ffi-test/global"
 	"ffi-test/src/models"
 	"ffi-test/src/utils"
 	"unicode"
@@ -11,6 +10,7 @@ import (
 )
 
 type DeleteModel struct {
+	service PatientService
 	BaseModel
 	focusSearchBar  bool
 	searchInput     textinput.Model
@@ -20,7 +20,7 @@ type DeleteModel struct {
 	deleted         bool // This will be set to true if the patient was deleted successfully
 }
 
-func NewDeleteModel(parent tea.Model, parentBase BaseModel) DeleteModel {
+func NewDeleteModel(service PatientService, parent tea.Model, parentBase BaseModel) DeleteModel {
 	ti := textinput.New()
 	ti.Placeholder = "Input ID to search"
 	ti.Focus()
@@ -28,6 +28,7 @@ func NewDeleteModel(parent tea.Model, parentBase BaseModel) DeleteModel {
 	ti.Width = 10
 
 	return DeleteModel{
+		service:     service,
 		searchInput: ti,
 		BaseModel: BaseModel{
 			Parent:     parent,
@@ -64,7 +65,7 @@ func (m DeleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			} else {
 				switch msg.String() {
 				case "enter":
-					patient, err := global.PatientsService.GetPatient(m.searchInput.Value())
+					patient, err := m.service.GetPatient(m.searchInput.Value())
 					if err != nil {
 						m.patientToDelete = nil
 						m.errSearch = error(err)
@@ -96,8 +97,11 @@ func (m DeleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc":
 			return m.Parent, nil
 		case "ctrl+c":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			cmd, err := SaveAndQuit(m.service)
+			if err != nil {
+				m.errDelete = err
+			}
+			return m, cmd
 			// Set focus to next input
 		case "tab", "shift+tab", "enter", "up", "down":
 			if m.deleted {
@@ -112,7 +116,7 @@ func (m DeleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// If so, exit.
 				if s == "enter" {
 					if !m.focusSearchBar {
-						err := global.PatientsService.DeletePatient(m.patientToDelete.ID)
+						err := m.service.DeletePatient(m.patientToDelete.ID)
 						if err != nil {
 							m.errDelete = err
 						} else {
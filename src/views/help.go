@@ -1,6 +1,7 @@
 package views
 
 import (
+	"ffi-test/global"
 	"fmt"
 
 	"github.com/charmbracelet/bubbles/help"
@@ -11,7 +12,7 @@ import (
 
 var (
 	labelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("63")).Bold(true)
-	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
+	errorStyle = global.ErrorStyle
 	valueStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
 	titleStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("33")).Bold(true).Underline(true)
 	boxStyle   = lipgloss.NewStyle().Border(lipgloss.NormalBorder()).Padding(1, 2)
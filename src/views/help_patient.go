@@ -11,6 +11,12 @@ import (
 )
 
 func PatientAddFormView(input []textinput.Model, focusIndex int) string {
+	return PatientFormView(input, focusIndex, nil)
+}
+
+// PatientFormView renders the patient form with fieldErrors, keyed by input
+// position, shown next to their fields.
+func PatientFormView(input []textinput.Model, focusIndex int, fieldErrors map[int]string) string {
 	// Find the max label width
 	labels := []string{
 		"CI:", "Name:", "Age:", "Gender:", "Diagnosis:", "Disability:", "Doc Speciality:", "Appointment-date:",
@@ -28,7 +34,11 @@ func PatientAddFormView(input []textinput.Model, focusIndex int) string {
 	}
 	// Create the lines for the patient form
 	for i, input := range input {
-		lines = append(lines, fmt.Sprintf("%s %s", labelStyle.Render(fmt.Sprintf("%-*s", maxLabelWidth, labels[i])), input.View()))
+		line := fmt.Sprintf("%s %s", labelStyle.Render(fmt.Sprintf("%-*s", maxLabelWidth, labels[i])), input.View())
+		if msg, ok := fieldErrors[i]; ok {
+			line += " " + errorStyle.Render(msg)
+		}
+		lines = append(lines, line)
 	}
 
 	button := blurredButton
@@ -13,14 +13,17 @@ import (
 )
 
 type listMenuModel struct {
+	service PatientService
 	choices []string
 	cursor  int
+	err     error
 	BaseModel
 }
 
 // "List Patients by Appointment Date", "List Patients by Specialty", "List Patients Under Age"
 
 type customTableModel struct {
+	service     PatientService
 	filterInput textinput.Model
 	filterType  string
 	err         error
@@ -28,7 +31,7 @@ type customTableModel struct {
 	BaseModel
 }
 
-func NewCustomTableModel(filterType string, patients []models.Patient, parent tea.Model, parentBase BaseModel) customTableModel {
+func NewCustomTableModel(service PatientService, filterType string, patients []models.Patient, parent tea.Model, parentBase BaseModel) customTableModel {
 	ti := textinput.New()
 	ti.Focus()
 	ti.Width = 20
@@ -37,6 +40,7 @@ func NewCustomTableModel(filterType string, patients []models.Patient, parent te
 	ti.Cursor.Style = cursorStyle
 
 	return customTableModel{
+		service:     service,
 		filterInput: ti,
 		filterType:  filterType,
 		tableModel:  NewTableModel(patients, parent, parentBase),
@@ -62,8 +66,11 @@ func (m customTableModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc", "q":
 			return m.Parent, nil
 		case "ctrl+c":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			cmd, err := SaveAndQuit(m.service)
+			if err != nil {
+				m.err = err
+			}
+			return m, cmd
 		case "enter":
 			if m.filterInput.Value() == "" {
 				m.err = fmt.Errorf("input cannot be empty")
@@ -79,9 +86,9 @@ func (m customTableModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						return m, nil
 					}
 
-					patients, err = global.PatientsService.ListPatientsByAppointmentDate(m.filterInput.Value())
+					patients, err = m.service.ListPatientsByAppointmentDate(m.filterInput.Value())
 				case "Specialty":
-					patients, err = global.PatientsService.ListPatientsBySpecialty(m.filterInput.Value())
+					patients, err = m.service.ListPatientsBySpecialty(m.filterInput.Value())
 					if err != nil {
 						m.err = err
 						return m, nil
@@ -94,7 +101,7 @@ func (m customTableModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						return m, nil
 					}
 
-					patients, err = global.PatientsService.ListPatientsUnderAge(age)
+					patients, err = m.service.ListPatientsUnderAge(age)
 					if err != nil {
 						m.err = err
 						return m, nil
@@ -130,14 +137,16 @@ func (m customTableModel) View() string {
 		s += utils.AlignW(errorStyle.Render(m.err.Error()), m.Width) + "\n" // 2 lines
 	}
 	s += "\n" // 1 line
-	s += utils.Center(m.tableModel.(tableModel).Table.View(), m.Width, m.Height-11) + "\n"
+	s += utils.Center(m.tableModel.(tableModel).Table.View(), m.Width, m.Height-12) + "\n"
 	s += utils.AlignW("Row Count: "+strconv.Itoa(len(m.tableModel.(tableModel).Table.Rows())), m.Width) + "\n"
+	s += m.tableModel.(tableModel).exportView()
 	return s
 }
 
-func NewListMenuModel(parent tea.Model, parentBase BaseModel) listMenuModel {
+func NewListMenuModel(service PatientService, parent tea.Model, parentBase BaseModel) listMenuModel {
 	breadCrumb := append(parentBase.Breadcrumb, "Select Patient List Menu")
 	return listMenuModel{
+		service: service,
 		choices: []string{
 			"List All Patients",
 			"List Disabled Patients",
@@ -183,8 +192,11 @@ func (m listMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc", "q":
 			return m.Parent, nil
 		case "ctrl+c":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			cmd, err := SaveAndQuit(m.service)
+			if err != nil {
+				m.err = err
+			}
+			return m, cmd
 		}
 	}
 	return m, nil
@@ -202,6 +214,9 @@ func (m listMenuModel) View() string {
 		}
 		menuStr += row + "\n"
 	}
+	if m.err != nil {
+		menuStr += "\n" + errorStyle.Render(m.err.Error()) + "\n"
+	}
 
 	s += utils.Center(menuStr, m.Width, m.Height-6)
 	return s
@@ -212,34 +227,34 @@ func (m *listMenuModel) handleSelection() (tea.Model, tea.Cmd) {
 	var patientList []models.Patient
 	switch m.cursor {
 	case 0:
-		patientList, err = global.PatientsService.ListPatients()
+		patientList, err = m.service.ListPatients()
 		if err != nil {
 			return m, nil
 		}
 	case 1:
-		patientList, err = global.PatientsService.ListDisabledPatients()
+		patientList, err = m.service.ListDisabledPatients()
 		if err != nil {
 			return m, nil
 		}
 	case 2:
-		t := NewCustomTableModel("Appointment Date", patientList, m, m.BaseModel)
+		t := NewCustomTableModel(m.service, "Appointment Date", patientList, m, m.BaseModel)
 		return t, t.Init()
 	case 3:
-		t := NewCustomTableModel("Specialty", patientList, m, m.BaseModel)
+		t := NewCustomTableModel(m.service, "Specialty", patientList, m, m.BaseModel)
 		return t, t.Init()
 
 	case 4:
-		patientList, err = global.PatientsService.ListFemalePatients()
+		patientList, err = m.service.ListFemalePatients()
 		if err != nil {
 			return m, nil
 		}
 	case 5:
-		patientList, err = global.PatientsService.ListMalePatients()
+		patientList, err = m.service.ListMalePatients()
 		if err != nil {
 			return m, nil
 		}
 	case 6:
-		t := NewCustomTableModel("Under Age", patientList, m, m.BaseModel)
+		t := NewCustomTableModel(m.service, "Under Age", patientList, m, m.BaseModel)
 		return t, t.Init()
 	default:
 		return m, tea.Printf("Invalid selection: %d\n", m.cursor)
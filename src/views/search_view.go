@@ -1,24 +1,31 @@
 package views
 
 import (
-	"ffi-test/global"
 	"ffi-test/src/models"
 	"ffi-test/src/utils"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
+// maxHistoryRows is how many appointments the history box shows, the most
+// recent ones.
+const maxHistoryRows = 10
+
 type SearchModel struct {
+	service PatientService
 	BaseModel
 	textInput textinput.Model
 	err       error
 	patient   *models.Patient
+	history   []models.Appointment
 }
 
-func NewSearchModel(parent tea.Model, parentBase BaseModel) SearchModel {
+func NewSearchModel(service PatientService, parent tea.Model, parentBase BaseModel) SearchModel {
 	ti := textinput.New()
 	ti.Placeholder = "Input ID to search"
 	ti.Focus()
@@ -27,6 +34,7 @@ func NewSearchModel(parent tea.Model, parentBase BaseModel) SearchModel {
 
 	breadcrumb := append(parentBase.Breadcrumb, "Search")
 	return SearchModel{
+		service: service,
 		BaseModel: BaseModel{
 			Parent:     parent,
 			Width:      parentBase.Width,
@@ -58,12 +66,14 @@ func (m SearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.err = error(fmt.Errorf("input cannot be empty"))
 			}
 
-			patient, err := global.PatientsService.GetPatient(m.textInput.Value())
+			patient, err := m.service.GetPatient(m.textInput.Value())
 			if err != nil {
 				m.err = error(err)
 				return m, textinput.Blink
 			}
 			m.patient = &patient.Patient
+			m.history, err = m.service.ListAppointments(patient.Patient.ID)
+			m.err = err
 			m.textInput.Reset()
 
 			return m, m.Init()
@@ -87,7 +97,8 @@ func (m SearchModel) View() string {
 
 	patientStr := ""
 	if m.patient != nil {
-		patientStr += PatientSummaryView(m.patient) + "\n"
+		patientStr += lipgloss.JoinHorizontal(lipgloss.Top,
+			PatientSummaryView(m.patient), " ", AppointmentHistoryView(m.history)) + "\n"
 	}
 	err := ""
 	if m.err != nil {
@@ -128,3 +139,44 @@ func PatientSummaryView(p *models.Patient) string {
 	content := strings.Join(lines, "\n")
 	return boxStyle.Render(content)
 }
+
+// AppointmentHistoryView lists a patient's appointments, oldest first,
+// keeping the most recent ones when there are too many to show.
+func AppointmentHistoryView(history []models.Appointment) string {
+	lines := []string{titleStyle.Render("Appointment History"), ""}
+	if len(history) == 0 {
+		lines = append(lines, valueStyle.Render("No appointments yet"))
+		return boxStyle.Render(strings.Join(lines, "\n"))
+	}
+
+	lines = append(lines, labelStyle.Render(fmt.Sprintf("%-5s %-10s %-11s %-20s %s", "ID", "Date", "Time", "Specialty", "Status")))
+	if hidden := len(history) - maxHistoryRows; hidden > 0 {
+		lines = append(lines, valueStyle.Render(fmt.Sprintf("... %d earlier", hidden)))
+		history = history[hidden:]
+	}
+	for _, a := range history {
+		specialty := a.Specialty
+		if len(specialty) > 20 {
+			specialty = specialty[:19] + "…"
+		}
+		row := fmt.Sprintf("%-5d %-10s %-11s %-20s %s", a.ID, a.Date, timeRange(a), specialty, a.Status)
+		if a.Status == models.AppointmentCancelled {
+			lines = append(lines, blurredStyle.Render(row))
+			continue
+		}
+		lines = append(lines, valueStyle.Render(row))
+	}
+	return boxStyle.Render(strings.Join(lines, "\n"))
+}
+
+// timeRange shows when an appointment starts and ends, as HH:MM-HH:MM.
+func timeRange(a models.Appointment) string {
+	if a.Time == "" {
+		return ""
+	}
+	start, err := time.Parse("15:04", a.Time)
+	if err != nil {
+		return a.Time
+	}
+	return a.Time + "-" + start.Add(time.Duration(a.Duration)*time.Minute).Format("15:04")
+}
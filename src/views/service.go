@@ -0,0 +1,38 @@
+package views
+
+import (
+	"ffi-test/src/models"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// PatientService is what the views need from the patient store. main passes
+// in the models.PatientStore picked at startup; anything else implementing
+// it, such as a fake for tests, works as well.
+type PatientService interface {
+	GetPatient(ci string) (*models.PatientResponse, error)
+	AddPatient(p models.Patient) error
+	UpdatePatient(p models.Patient) error
+	DeletePatient(ci string) error
+	ListPatients() ([]models.Patient, error)
+	ListDisabledPatients() ([]models.Patient, error)
+	ListPatientsByAppointmentDate(date string) ([]models.Patient, error)
+	ListPatientsBySpecialty(specialty string) ([]models.Patient, error)
+	ListFemalePatients() ([]models.Patient, error)
+	ListMalePatients() ([]models.Patient, error)
+	ListPatientsUnderAge(ageLimit int) ([]models.Patient, error)
+	ListAppointments(ci string) ([]models.Appointment, error)
+	Verify() (*models.VerifyReport, error)
+	Save() error
+}
+
+// SaveAndQuit saves the store and quits the program. If the save fails the
+// program keeps running, so the view can show the error and the user can try
+// again; nothing is lost meanwhile, the changes stay in the log.
+func SaveAndQuit(service PatientService) (tea.Cmd, error) {
+	if err := service.Save(); err != nil {
+		return nil, fmt.Errorf("could not save before quitting: %w", err)
+	}
+	return tea.Quit, nil
+}
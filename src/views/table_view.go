@@ -3,7 +3,10 @@ package views
 import (
 	"ffi-test/src/models"
 	"ffi-test/src/utils"
+	"fmt"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,7 +18,11 @@ var baseStyle = lipgloss.NewStyle().
 	BorderForeground(lipgloss.Color("240"))
 
 type tableModel struct {
-	Table table.Model
+	Table    table.Model
+	patients []models.Patient
+	// exportMsg reports the outcome of the last export
+	exportMsg string
+	exportErr error
 	BaseModel
 }
 
@@ -29,7 +36,8 @@ func NewTableModel(patients []models.Patient, parent tea.Model, parentBase BaseM
 			Width:      parentBase.Width,
 			Height:     parentBase.Height,
 		},
-		Table: t,
+		Table:    t,
+		patients: patients,
 	}
 }
 
@@ -54,6 +62,12 @@ func (m tableModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Batch(
 				tea.Printf("Let's go to %s!", m.Table.SelectedRow()[1]),
 			)
+		case "ctrl+s":
+			m.export(models.FormatCSV)
+			return m, nil
+		case "ctrl+o":
+			m.export(models.FormatJSON)
+			return m, nil
 		}
 	}
 	m.Table, cmd = m.Table.Update(msg)
@@ -63,14 +77,50 @@ func (m tableModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m tableModel) View() string {
 	s := utils.BreadcrumbView(m.Breadcrumb) + "\n\n"
 	s += "Patient List:\n\n"
-	actH := m.Height - 6 // Previous lines
+	actH := m.Height - 7 // Previous and following lines
 	tableStr := utils.Center(baseStyle.Render(m.Table.View()), m.Width, actH)
 
 	s += tableStr + "\n"
 	s += utils.AlignW("Row Count: "+strconv.Itoa(len(m.Table.Rows())), m.Width) + "\n"
+	s += m.exportView()
 	return s
 }
 
+// export writes the displayed rows to a new file in the working directory,
+// named after the time of the export.
+func (m *tableModel) export(format models.ExportFormat) {
+	path := fmt.Sprintf("patients-%s.%s", time.Now().Format("20060102-150405"), format)
+	m.exportMsg, m.exportErr = "", nil
+	if err := writeExport(path, format, m.patients); err != nil {
+		m.exportErr = err
+		return
+	}
+	m.exportMsg = fmt.Sprintf("Exported %d patients to %s", len(m.patients), path)
+}
+
+func writeExport(path string, format models.ExportFormat, patients []models.Patient) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := models.ExportPatients(file, format, patients); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// exportView is the export key hint, or the outcome of the last export.
+func (m tableModel) exportView() string {
+	switch {
+	case m.exportErr != nil:
+		return utils.AlignW(errorStyle.Render("Export failed: "+m.exportErr.Error()), m.Width) + "\n"
+	case m.exportMsg != "":
+		return utils.AlignW(m.exportMsg, m.Width) + "\n"
+	}
+	return utils.AlignW(helpStyle.Render("ctrl+s: export CSV • ctrl+o: export JSON"), m.Width) + "\n"
+}
+
 func NewPatientTable(patients []models.Patient) table.Model {
 	columns := []table.Column{
 		{Title: "ID", Width: 8},
@@ -1,7 +1,6 @@
 package views
 
 import (
-	"ffi-test/global"
 	"ffi-test/src/models"
 	"ffi-test/src/utils"
 	"unicode"
@@ -11,6 +10,7 @@ import (
 )
 
 type UpdateModel struct {
+	service PatientService
 	BaseModel
 	focusIndex     int
 	inputPatient   PatientInput
@@ -21,7 +21,7 @@ type UpdateModel struct {
 	wasUpdated     bool // This will be set to true if the patient was updated successfully
 }
 
-func NewUpdateModel(parent tea.Model, parentBase BaseModel) UpdateModel {
+func NewUpdateModel(service PatientService, parent tea.Model, parentBase BaseModel) UpdateModel {
 	ti := textinput.New()
 	ti.Placeholder = "Input ID to search"
 	ti.Focus()
@@ -31,6 +31,7 @@ func NewUpdateModel(parent tea.Model, parentBase BaseModel) UpdateModel {
 	inputs := NewPatientInput()
 	breadcrumb := append(parentBase.Breadcrumb, "Update Patient")
 	return UpdateModel{
+		service:     service,
 		searchInput: ti,
 		BaseModel: BaseModel{
 			Parent:     parent,
@@ -68,7 +69,7 @@ func (m UpdateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			} else {
 				switch msg.String() {
 				case "enter":
-					patient, err := global.PatientsService.GetPatient(m.searchInput.Value())
+					patient, err := m.service.GetPatient(m.searchInput.Value())
 					if err != nil {
 						m.updatedPatient = nil
 						m.errSearch = error(err)
@@ -101,8 +102,11 @@ func (m UpdateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc":
 			return m.Parent, nil
 		case "ctrl+c":
-			global.PatientsService.Save()
-			return m, tea.Quit
+			cmd, err := SaveAndQuit(m.service)
+			if err != nil {
+				m.err = err
+			}
+			return m, cmd
 			// Set focus to next input
 		case "tab", "shift+tab", "enter", "up", "down":
 			if m.wasUpdated {
@@ -125,7 +129,7 @@ func (m UpdateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if s == "enter" {
 					if m.err == nil && m.focusIndex == len(inputList) {
 						patient := m.inputPatient.ToPatient()
-						err := global.PatientsService.UpdatePatient(patient)
+						err := m.service.UpdatePatient(patient)
 						if err != nil {
 							m.err = err
 						} else {
@@ -226,9 +230,9 @@ func (m UpdateModel) View() string {
 
 	if m.updatedPatient != nil {
 		s += utils.AlignW(PatientAddFormView(m.inputPatient.AsList(), m.focusIndex), m.Width) + "\n"
-		if m.err != nil {
-			s += utils.AlignW(errorStyle.Render(m.err.Error()), m.Width) + "\n"
-		}
+	}
+	if m.err != nil {
+		s += utils.AlignW(errorStyle.Render(m.err.Error()), m.Width) + "\n"
 	}
 
 	return s
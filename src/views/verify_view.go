@@ -0,0 +1,68 @@
+package views
+
+import (
+	"ffi-test/src/models"
+	"ffi-test/src/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type VerifyModel struct {
+	service PatientService
+	BaseModel
+	report *models.VerifyReport
+	err    error
+}
+
+func NewVerifyModel(service PatientService, parent tea.Model, parentBase BaseModel) VerifyModel {
+	report, err := service.Verify()
+	return VerifyModel{
+		service: service,
+		BaseModel: BaseModel{
+			Parent:     parent,
+			Width:      parentBase.Width,
+			Height:     parentBase.Height,
+			Breadcrumb: append(parentBase.Breadcrumb, "Verify Data"),
+		},
+		report: report,
+		err:    err,
+	}
+}
+
+func (m VerifyModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m VerifyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.Width = msg.Width
+		m.Height = msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "ctrl+c", "q", "enter":
+			return m.Parent, nil
+		case "r":
+			m.report, m.err = m.service.Verify()
+		}
+	}
+	return m, nil
+}
+
+func (m VerifyModel) View() string {
+	s := utils.BreadcrumbView(m.Breadcrumb) + "\n\n" + utils.AlignW("Data Verification", m.Width) + "\n\n"
+
+	var body string
+	switch {
+	case m.err != nil:
+		body = errorStyle.Render(m.err.Error())
+	case m.report.OK():
+		body = boxStyle.Render(valueStyle.Render(m.report.String()))
+	default:
+		body = boxStyle.Render(errorStyle.Render(m.report.String()))
+	}
+	body += "\n\n" + helpStyle.Render("r: run again • esc: back")
+
+	s += utils.Center(body, m.Width, m.Height-4)
+	return s
+}